@@ -0,0 +1,168 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/bundle"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/pipeline"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/process"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// renderPlan what a render job would pass to ytt and where its output would go
+//
+// inputs: role and file name of every resource the job sees
+//
+// args: ytt file arguments, relative to the ytt file directory
+//
+// sources: image and tarball sources, fetched only when rendering
+//
+// outputs: resources receiving ytt output documents in order
+//
+// outputField: field of outputs ytt documents are written to
+//
+// secretFields: ytt output fields written to Secrets instead of outputs
+//
+// validations: rules ytt output documents are checked against before being written
+type renderPlan struct {
+	inputs       []process.PlannedInput
+	args         []string
+	sources      []config.YttSource
+	outputs      []*kyaml.RNode
+	outputField  string
+	secretFields []config.YttSecretField
+	validations  []config.YttValidation
+}
+
+// planRender resolves the render plan of resourceList the way YttProcessor.Process would, without running ytt
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - resourceList: resources and function config of the job
+//
+// Returns:
+//   - renderPlan: resolved plan
+//   - error: any error the render would fail with before running ytt
+func planRender(results *logger.Collector, resourceList *framework.ResourceList) (plan renderPlan, err error) {
+	if !resourceList.FunctionConfig.IsNilOrEmpty() {
+		if err := config.Configure(results, resourceList.FunctionConfig); err != nil {
+			return plan, err
+		}
+	}
+	redactor, err := logger.NewRedactor(config.YttRedactKeyPatterns)
+	if err != nil {
+		return plan, err
+	}
+	results.Redactor = redactor
+
+	// Resources of referenced packages are planned like package resources
+	packageItems, err := bundle.ReadPackageSources(results)
+	if err != nil {
+		return plan, err
+	}
+	inputItems := append(append([]*kyaml.RNode{}, resourceList.Items...), packageItems...)
+
+	// Violated consistency rules fail the render before any template is written
+	if err := process.CheckConsistency(results, inputItems...); err != nil {
+		return plan, err
+	}
+	plan.inputs, plan.args, err = process.PlanYttInputs(results, inputItems...)
+	if err != nil {
+		return plan, err
+	}
+
+	for _, source := range config.YttSources {
+		if source.Package == "" {
+			plan.sources = append(plan.sources, source)
+		}
+	}
+	for _, item := range resourceList.Items {
+		if process.IsOutputItem(item) {
+			plan.outputs = append(plan.outputs, item)
+		}
+	}
+	plan.outputField = config.YttOutputElementKey
+	if config.YttOutputDataKey != "" {
+		plan.outputField += "." + config.YttOutputDataKey
+	}
+	plan.secretFields = config.YttSecretFields
+	plan.validations = config.YttValidations
+	return plan, nil
+}
+
+// write prints the plan to out, one section per step of the render
+func (plan renderPlan) write(out io.Writer) error {
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "  inputs:")
+	for _, input := range plan.inputs {
+		fileName := input.FileName
+		if fileName == "" {
+			fileName = "-"
+		}
+		fmt.Fprintf(table, "    %s\t%s\t%s\t-> %s\n", input.Role, pipeline.ItemPath(input.Item), resourceID(input.Item), fileName)
+	}
+	if len(plan.sources) > 0 {
+		fmt.Fprintln(table, "  sources:")
+		for _, source := range plan.sources {
+			library := source.Library
+			if library == "" {
+				library = "-"
+			}
+			fmt.Fprintf(table, "    %s%s\tpath: %s\tlibrary: %s\n", source.Image, source.Tarball, path.Join("/", source.Path), library)
+		}
+	}
+	fmt.Fprintf(table, "  ytt args: %s\n", strings.Join(plan.args, " "))
+	fmt.Fprintln(table, "  outputs:")
+	for i, output := range plan.outputs {
+		fmt.Fprintf(table, "    document %d\t-> %s\t%s\t%s\n", i+1, pipeline.ItemPath(output), resourceID(output), plan.outputField)
+	}
+	if len(plan.outputs) == 0 {
+		fmt.Fprintln(table, "    none, the render would fail")
+	} else {
+		fmt.Fprintf(table, "    document %d and later\t-> none, the render would fail\n", len(plan.outputs)+1)
+	}
+	for _, field := range plan.secretFields {
+		key := field.Key
+		if key == "" {
+			key = field.Path[strings.LastIndex(field.Path, ".")+1:]
+		}
+		fmt.Fprintf(table, "    field %s\t-> Secret %s\tkey: %s\n", field.Path, field.Secret, key)
+	}
+	if len(plan.validations) > 0 {
+		fmt.Fprintln(table, "  validations:")
+		for _, validation := range plan.validations {
+			output := validation.Output
+			if output == "" {
+				output = "all outputs"
+			}
+			fmt.Fprintf(table, "    %s\t%s\n", validation.Expression, output)
+		}
+	}
+	return table.Flush()
+}
+
+// resourceID identifies a resource by apiVersion, kind and name
+func resourceID(item *kyaml.RNode) string {
+	return fmt.Sprintf("%s/%s/%s", item.GetApiVersion(), item.GetKind(), item.GetName())
+}
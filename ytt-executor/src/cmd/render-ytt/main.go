@@ -15,13 +15,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/bundle"
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/commandExec"
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/debugBundle"
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/pipeline"
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/process"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/renderTest"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/stats"
 	"sigs.k8s.io/kustomize/kyaml/fn/framework"
 	"sigs.k8s.io/kustomize/kyaml/fn/framework/command"
 	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
@@ -30,6 +41,7 @@ import (
 func main() {
 	yttProc := YttProcessor{}
 	cmd := command.Build(&yttProc, command.StandaloneEnabled, false)
+	cmd.AddCommand(newStandaloneCommands(&yttProc)...)
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -38,52 +50,196 @@ func main() {
 
 type YttProcessor struct{}
 
-func (yttProc *YttProcessor) Process(resourceList *framework.ResourceList) error {
+func (yttProc *YttProcessor) Process(resourceList *framework.ResourceList) (err error) {
+	// Collect results of this run only and hand them to kpt on every exit
+	results := logger.NewCollector()
+	defer func() {
+		resourceList.Results = results.Results
+
+		// Returned errors are printed as well and may quote ytt input
+		if err != nil && results.Redactor != nil {
+			err = errors.New(results.Redactor.Redact(err.Error()))
+		}
+	}()
+
 	// Check for config
 	if resourceList.FunctionConfig.IsNilOrEmpty() {
-		logger.LogWarning("No function config provided. Default values will be used.")
+		results.LogWarning("No function config provided. Default values will be used.")
 	} else {
 		// Get and parse config
-		err := config.Configure(resourceList.FunctionConfig)
+		err := config.Configure(results, resourceList.FunctionConfig)
 		if err != nil {
-			resourceList.Results = logger.LogStack
+			results.LogReferencedError(err.Error(), logger.Reference{Item: resourceList.FunctionConfig}, nil)
 			return err
 		}
 	}
 
+	// Mask sensitive values in every log from here on
+	redactor, err := logger.NewRedactor(config.YttRedactKeyPatterns)
+	if err != nil {
+		results.LogReferencedError(err.Error(), logger.Reference{Item: resourceList.FunctionConfig}, nil)
+		return err
+	}
+	results.Redactor = redactor
+
+	// Run test cases of render tests instead of rendering, as a validator leaving the package untouched
+	// Failures may quote package values, so sensitive fields of the package are registered first
+	if config.YttMode == config.ModeTest {
+		process.RegisterSensitiveFields(results, resourceList.Items...)
+		return renderTest.Run(results, yttProc, resourceList.Items)
+	}
+
+	// Record statistics of this render job, reported on every exit after config was read
+	render := stats.NewRender(pipeline.JobName(resourceList.FunctionConfig))
+	defer func() {
+		render.Succeeded = err == nil
+		results.LogDetailedInfo("Render statistics", render.Tags())
+		if config.YttMetricsFile != "" {
+			metricsFile := config.YttMetricsFile
+			if !filepath.IsAbs(metricsFile) {
+				metricsFile = filepath.Join(config.YttWorkDirectory, metricsFile)
+			}
+			if writeErr := render.WritePrometheus(metricsFile); writeErr != nil {
+				results.LogWarning(writeErr.Error())
+			}
+		}
+	}()
+
+	// Pin the ytt binary used for this render and check its version
+	yttBinary, err := commandExec.ResolveYttBinary(results)
+	if err != nil {
+		return err
+	}
+	config.YttBinaryName = yttBinary
+
+	// Read resources of referenced packages next to package resources
+	packageItems, err := bundle.ReadPackageSources(results)
+	if err != nil {
+		return err
+	}
+	inputItems := append(append([]*kyaml.RNode{}, resourceList.Items...), packageItems...)
+	process.RegisterSensitiveFields(results, inputItems...)
+	render.InputResources = len(inputItems)
+
+	// Check shared values of CIQs and other inputs before rendering any of them
+	if err := process.CheckConsistency(results, inputItems...); err != nil {
+		return err
+	}
+
 	// Write kpt input to file system
-	fileArgs, baseDir, err := process.ParseAndWriteKYamlRNodesAsYttTemplates(resourceList.Items...)
+	stopPhase := render.Measure(stats.PhaseWriteTemplates)
+	fileArgs, baseDir, err := process.ParseAndWriteKYamlRNodesAsYttTemplates(results, inputItems...)
+	stopPhase()
 	if err != nil {
-		resourceList.Results = logger.LogStack
 		return err
 	}
 
 	//Remove temporary directory of ytt files.
 	defer os.RemoveAll(baseDir)
 
-	// Execute ytt binary with given file arguments
-	yttOutputBuffer, err := commandExec.ExecuteYttForTemplate(fileArgs)
+	// Fetch templates and libraries from outside the package
+	sourceArgs, err := bundle.ResolveSources(results, baseDir)
 	if err != nil {
-		resourceList.Results = logger.LogStack
 		return err
 	}
+	fileArgs = append(fileArgs, sourceArgs...)
+	render.CountInputFiles(fileArgs)
+
+	// Capture ytt inputs and output to reproduce this render with plain ytt
+	var debug *debugBundle.Bundle
+	if config.YttDebugBundle != "" {
+		debug = debugBundle.New(render.Job)
+		if err := debug.AddArgs(fileArgs, baseDir); err != nil {
+			return err
+		}
+		defer func() {
+			writeDebugBundle(results, resourceList, debug, err)
+		}()
+	}
+
+	// Bound ytt execution by timeout and interrupts
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if config.YttTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, config.YttTimeout)
+		defer cancel()
+	}
 
 	// Collect output RNodes
 	// TODO: if expanding / changing move to process package
 	var outputItems []*kyaml.RNode
 	for _, item := range resourceList.Items {
-		if item.GetKind() == config.YttOutputFileKind {
+		if process.IsOutputItem(item) {
 			outputItems = append(outputItems, item)
 		}
 	}
+	outputOptions := process.OutputOptions{Secrets: process.FindSecrets(resourceList.Items)}
+	if config.YttOutputValidateSchema {
+		if outputOptions.Schemas, err = process.ReadOutputSchemas(results, inputItems...); err != nil {
+			return err
+		}
+	}
 
-	// Take ytt executable output and parse back to kyaml.RNode
-	err = process.UnmarshalYttOutput(yttOutputBuffer, outputItems)
-	if err != nil {
-		resourceList.Results = logger.LogStack
-		return err
+	// Execute ytt binary with given file arguments, parsing its output back to kyaml.RNode while it streams in
+	stopPhase = render.Measure(stats.PhaseExecuteYtt)
+	output, err := commandExec.ExecuteYttForTemplate(ctx, results, fileArgs, func(yttOutput io.Reader) error {
+		yttOutput, stopUnmarshal := render.MeasureReader(stats.PhaseUnmarshalOutput, yttOutput)
+		defer stopUnmarshal()
+		if debug != nil {
+			yttOutput = io.TeeReader(yttOutput, &debug.Output)
+		}
+		return process.UnmarshalYttOutput(results, yttOutput, outputItems, outputOptions)
+	})
+	stopPhase()
+	render.OutputBytes = output.Bytes
+	render.OutputDocuments = output.Documents
+	var interrupted *commandExec.InterruptedError
+	if errors.As(err, &interrupted) {
+		results.LogDetailedError(fmt.Sprintf("Render job: %s, %v", render.Job, err), map[string]string{
+			"job":     render.Job,
+			"timeout": config.YttTimeout.String(),
+			"elapsed": interrupted.Elapsed.String(),
+		})
+	}
+	return err
+}
+
+// writeDebugBundle writes the debug bundle of a render job to the tarball or resource set by config.YttDebugBundle
+// Failing to write it is reported as warning, as it must not fail the render
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - resourceList: kpt resource list receiving the RenderDebugBundle resource
+//   - debug: captured ytt inputs and output
+//   - renderErr: error the render job failed with, nil on success
+func writeDebugBundle(results *logger.Collector, resourceList *framework.ResourceList, debug *debugBundle.Bundle, renderErr error) {
+	if renderErr != nil {
+		debug.Error = renderErr.Error()
 	}
+	debug.Redact(results.Redactor)
 
-	resourceList.Results = logger.LogStack
-	return nil
+	// Emit bundle as resource of the package
+	if config.YttDebugBundle == debugBundle.ResourceTarget {
+		resource, err := debug.Resource()
+		if err != nil {
+			results.LogWarning(fmt.Sprintf("failed to create debug bundle: %v", err))
+			return
+		}
+		resourceList.Items = append(resourceList.Items, resource)
+		return
+	}
+
+	// Write bundle as tarball relative to the work directory
+	fileName := config.YttDebugBundle
+	if !filepath.IsAbs(fileName) {
+		fileName = filepath.Join(config.YttWorkDirectory, fileName)
+	}
+	if err := debug.WriteTarball(fileName); err != nil {
+		results.LogWarning(err.Error())
+		return
+	}
+	results.LogDetailedInfo("Wrote debug bundle", map[string]string{
+		"job":  debug.Job,
+		"file": fileName,
+	})
 }
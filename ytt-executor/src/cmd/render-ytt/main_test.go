@@ -16,16 +16,26 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/pipeline"
 	"github.com/stretchr/testify/assert"
 	"sigs.k8s.io/kustomize/kyaml/fn/framework"
 	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
 func TestYttProcessor_Process(t *testing.T) {
+	// ytt stand-ins are resolved to absolute paths, which show in their errors
+	catBinary, err := exec.LookPath("cat")
+	if err != nil {
+		t.Fatalf("cat stand-in not found: %v", err)
+	}
+
 	// Setup TempDir for testing
 	tempDir := t.TempDir()
 	if err := os.Chdir(tempDir); err != nil {
@@ -86,7 +96,7 @@ output:
 		// Test error catch in commandExec.ExecuteYttForTemplate
 		{
 			"Test fail on ExecuteYttForTemplate",
-			errors.New("ytt: exit status 1 (stderr: cat: invalid option -- 'f'\nTry 'cat --help' for more information.\n)"),
+			fmt.Errorf("ytt: exit status 1 (stderr: %s: invalid option -- 'f'\nTry '%[1]s --help' for more information.\n)", catBinary),
 			&framework.ResourceList{
 				Items: []*kyaml.RNode{
 					kyaml.MustParse(`
@@ -218,3 +228,194 @@ ytt_template_content:
 		})
 	}
 }
+
+func TestYttProcessor_ProcessTestMode(t *testing.T) {
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+
+	// The stand-in ytt always renders amf: 2, whatever the case inputs
+	packageDir := samplePackage(t, "amf: 2")
+	err := os.WriteFile(filepath.Join(packageDir, "tests.yaml"), []byte(`apiVersion: v1alpha1
+kind: YttRenderTest
+metadata:
+  name: amf-day0-tests
+spec:
+  function_config: amf-day0
+  cases:
+    - name: default
+      assertions:
+        - {output: amf-out, path: $.data.amf, value: 2}
+    - name: scaled
+      inputs:
+        - {apiVersion: v1alpha1, kind: YttTemplate, metadata: {name: amf-template}, ytt_template_content: {amf: 3}}
+      assertions:
+        - {cel: self.data.amf == 3, message: amf must follow the template}
+`), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write package file: %v", err)
+	}
+	_, items, _, err := pipeline.ReadPackage(packageDir, pipeline.DefaultImages)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	resourceList := &framework.ResourceList{
+		Items:          items,
+		FunctionConfig: kyaml.MustParse("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: validate\ndata:\n  mode: test\n"),
+	}
+
+	// Execute function
+	err = (&YttProcessor{}).Process(resourceList)
+
+	// Cases are reported one by one, the package is left untouched
+	assert.EqualError(t, err, "1 of 2 render test cases failed")
+	var messages []string
+	for _, result := range resourceList.Results {
+		messages = append(messages, fmt.Sprintf("%s %s", result.Severity, result.Message))
+	}
+	assert.Equal(t, []string{
+		"INFO Render test case passed: default",
+		"ERROR Render test case scaled failed: output amf-out: amf must follow the template",
+	}, messages)
+	assert.Equal(t, "tests.yaml", resourceList.Results[1].File.Path)
+	for _, item := range resourceList.Items {
+		if item.GetKind() == "AmfConfiguration" {
+			assert.Equal(t, "{}", item.Field("data").Value.MustString()[:2])
+		}
+	}
+}
+
+func TestYttProcessor_ProcessTestModeRedaction(t *testing.T) {
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+
+	// The case expects a render error quoting the password of a package Secret
+	packageDir := samplePackage(t, "amf: 2")
+	err := os.WriteFile(filepath.Join(packageDir, "secret.yaml"), []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: amf-credentials
+data:
+  password: czNjcjN0
+---
+apiVersion: v1alpha1
+kind: YttRenderTest
+metadata:
+  name: amf-day0-tests
+spec:
+  function_config: amf-day0
+  cases:
+    - name: wrong-password
+      error: s3cr3t
+`), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write package file: %v", err)
+	}
+	_, items, _, err := pipeline.ReadPackage(packageDir, pipeline.DefaultImages)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	resourceList := &framework.ResourceList{
+		Items:          items,
+		FunctionConfig: kyaml.MustParse("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: validate\ndata:\n  mode: test\n"),
+	}
+
+	// Execute function
+	err = (&YttProcessor{}).Process(resourceList)
+
+	// Secret values are masked in test results as in renders
+	assert.EqualError(t, err, "1 of 1 render test cases failed")
+	for _, result := range resourceList.Results {
+		assert.NotContains(t, result.Message, "s3cr3t")
+	}
+}
+
+func TestYttProcessor_ProcessTextTemplate(t *testing.T) {
+	yttBinary, err := exec.LookPath("ytt")
+	if err != nil {
+		t.Skip("ytt not found in PATH")
+	}
+	defer func() {
+		config.YttBinaryName = "ytt"
+		config.YttOutputFileKind = "Configuration"
+		config.YttOutputDataKey = ""
+		config.YttOutputFormat = config.OutputFormatYaml
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+
+	// A yaml template renders the text template library into a single string document
+	resourceList := &framework.ResourceList{
+		Items: []*kyaml.RNode{
+			kyaml.MustParse(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: amf-config
+  annotations:
+    config.kubernetes.io/path: "amf/config.yaml"
+data: {}
+`),
+			kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttDataValues
+metadata:
+  name: amf-values
+  annotations:
+    config.kubernetes.io/path: "amf/values.yaml"
+ytt_template_content:
+  port: 38412
+`),
+			kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: amf-ini
+  annotations:
+    config.kubernetes.io/path: "amf/ini.yaml"
+ytt_file_type: text-template
+ytt_file_name: amf
+ytt_template_content: |
+  (@ def render(port): -@)
+  [ngap]
+  port=(@= str(port) @)
+  (@ end @)
+`),
+			kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: amf-template
+  annotations:
+    config.kubernetes.io/path: "amf/template.yaml"
+ytt_template_content: |
+  #@ load("@ytt:data", "data")
+  #@ load("amf.lib.txt", "render")
+  --- #@ render(data.values.port)
+`),
+		},
+		FunctionConfig: kyaml.MustParse(`
+apiVersion: v1
+kind: RenderConfig
+metadata:
+  name: amf-day0
+output:
+  kind: ConfigMap
+  data_key: amf.ini
+  format: text
+debug:
+  bin_name: ` + yttBinary + `
+`),
+	}
+
+	// Execute function
+	err = (&YttProcessor{}).Process(resourceList)
+
+	// Rendered text ends up verbatim under the data key
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Equal(t, "[ngap]\nport=38412\n", resourceList.Items[0].Field("data").Value.Field("amf.ini").Value.YNode().Value)
+}
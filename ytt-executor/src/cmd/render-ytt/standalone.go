@@ -0,0 +1,196 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/pipeline"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/templateTest"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// newStandaloneCommands creates the render, check, explain, watch and test commands, which run the Kptfile pipeline
+// entries of this function against a package directory without kpt or containers
+func newStandaloneCommands(yttProc *YttProcessor) []*cobra.Command {
+	var images []string
+
+	render := &cobra.Command{
+		Use:   "render PKG_PATH",
+		Short: "Render a package directory and write outputs back",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			packageRW, items, jobs, err := pipeline.ReadPackage(args[0], images, templateTest.DefaultTestDataDirectory)
+			if err != nil {
+				return err
+			}
+			items, _, err = pipeline.Run(cmd.ErrOrStderr(), yttProc, items, jobs)
+			if err != nil {
+				return err
+			}
+			return packageRW.Write(items)
+		},
+	}
+
+	check := &cobra.Command{
+		Use:   "check PKG_PATH",
+		Short: "Render a package directory and fail when outputs are not up to date",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, items, jobs, err := pipeline.ReadPackage(args[0], images, templateTest.DefaultTestDataDirectory)
+			if err != nil {
+				return err
+			}
+			before, err := pipeline.SerializePackage(items)
+			if err != nil {
+				return err
+			}
+			items, _, err = pipeline.Run(cmd.ErrOrStderr(), yttProc, items, jobs)
+			if err != nil {
+				return err
+			}
+			after, err := pipeline.SerializePackage(items)
+			if err != nil {
+				return err
+			}
+			changed := pipeline.ChangedFiles(before, after)
+			for _, fileName := range changed {
+				fmt.Fprintf(cmd.OutOrStdout(), "would change: %s\n", fileName)
+			}
+			if len(changed) > 0 {
+				return fmt.Errorf("package is not up to date: %d files would change", len(changed))
+			}
+			return nil
+		},
+	}
+
+	explain := &cobra.Command{
+		Use:   "explain PKG_PATH",
+		Short: "Show the render plan of each job of a package directory without running ytt",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, items, jobs, err := pipeline.ReadPackage(args[0], images, templateTest.DefaultTestDataDirectory)
+			if err != nil {
+				return err
+			}
+			return explainPipeline(cmd.OutOrStdout(), cmd.ErrOrStderr(), items, jobs)
+		},
+	}
+
+	var interval time.Duration
+	watch := &cobra.Command{
+		Use:   "watch PKG_PATH",
+		Short: "Render a package directory and render affected jobs again whenever its files change",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			packageWatcher := &watcher{
+				out:         cmd.OutOrStdout(),
+				errOut:      cmd.ErrOrStderr(),
+				yttProc:     yttProc,
+				packagePath: args[0],
+				images:      images,
+			}
+			return packageWatcher.run(ctx, interval)
+		},
+	}
+	watch.Flags().DurationVar(&interval, "interval", 500*time.Millisecond, "time between checks for changed files")
+
+	var update bool
+	test := &cobra.Command{
+		Use:   "test PKG_PATH",
+		Short: "Render test cases of a package directory and compare outputs with their golden files",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			checker := &templateTest.GoldenChecker{
+				PackagePath:              args[0],
+				Images:                   images,
+				UpdateExpectedFromActual: update,
+				Processor:                func() framework.ResourceListProcessor { return yttProc },
+			}
+			results, err := checker.Run()
+			templateTest.WriteResults(cmd.OutOrStdout(), results)
+			if err != nil {
+				return err
+			}
+			failed := 0
+			for _, result := range results {
+				if !result.Passed() {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d test cases failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+	test.Flags().BoolVar(&update, "update", false, "write rendered outputs to golden files instead of comparing them")
+
+	commands := []*cobra.Command{render, check, explain, watch, test}
+	for _, command := range commands {
+		command.SilenceErrors = true
+		command.SilenceUsage = true
+		command.Flags().StringSliceVar(&images, "image", pipeline.DefaultImages, "image name parts identifying pipeline entries of this function")
+	}
+	return commands
+}
+
+// explainPipeline prints the render plan of every job to out and their results to errOut
+// Jobs are planned against the package as read, as outputs of earlier jobs are only known after running ytt
+//
+// Parameters:
+//   - out: writer receiving render plans
+//   - errOut: writer receiving results of every job
+//   - items: package resources
+//   - jobs: pipeline entries of this function
+//
+// Returns:
+//   - error: when any job would fail before running ytt
+func explainPipeline(out io.Writer, errOut io.Writer, items []*kyaml.RNode, jobs []pipeline.Job) error {
+	failed := 0
+	for _, job := range jobs {
+		resourceList := job.ResourceList(items)
+		config.Reset()
+		results := logger.NewCollector()
+		plan, err := planRender(results, resourceList)
+		pipeline.WriteResults(errOut, job, results.Results)
+		fmt.Fprintf(out, "%s: %s %s, config: %s\n", job.Name(), job.Stage, job.Image, job.ConfigSource)
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "  error: %v\n", err)
+			continue
+		}
+		if err := plan.write(out); err != nil {
+			return err
+		}
+	}
+	config.Reset()
+	if failed > 0 {
+		return fmt.Errorf("%d render jobs would fail", failed)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/internal/testUtil"
+	"github.com/stretchr/testify/assert"
+)
+
+// writePackage writes files to a new package directory, returning its path
+func writePackage(t *testing.T, files map[string]string) string {
+	packageDir := t.TempDir()
+	testUtil.WriteFiles(t, packageDir, files)
+	return packageDir
+}
+
+// samplePackage package rendering out.yaml with a stand-in ytt printing rendered as output document
+func samplePackage(t *testing.T, rendered string) string {
+	binDir := t.TempDir()
+	fakeYtt := filepath.Join(binDir, "ytt")
+	script := "#!/bin/sh\n[ \"$1\" = version ] && echo \"ytt version 0.50.0\" && exit 0\nprintf '" + rendered + "\\n'\n"
+	if err := os.WriteFile(fakeYtt, []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write stand-in binary: %v", err)
+	}
+
+	return writePackage(t, map[string]string{
+		"Kptfile": `apiVersion: kpt.dev/v1
+kind: Kptfile
+metadata:
+  name: amf
+pipeline:
+  mutators:
+    - image: gcr.io/kpt-fn/set-labels:v0.2
+      configMap:
+        app: amf
+    - image: localhost:5000/render-ytt:v0.1
+      configPath: fn.yaml
+`,
+		"fn.yaml": `apiVersion: v1
+kind: RenderConfig
+metadata:
+  name: amf-day0
+input:
+  template_selector: {kinds: [YttTemplate]}
+output:
+  kind: AmfConfiguration
+debug:
+  bin_name: ` + fakeYtt + `
+`,
+		"amf/template.yaml": `apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: amf-template
+ytt_template_content:
+  amf: 1
+`,
+		"amf/out.yaml": `apiVersion: v1
+kind: AmfConfiguration
+metadata:
+  name: amf-out
+data: {}
+`,
+	})
+}
+
+// runCommand runs a standalone command against packageDir with flags, returning its stdout and error
+func runCommand(name string, packageDir string, flags ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	for _, command := range newStandaloneCommands(&YttProcessor{}) {
+		if command.Name() != name {
+			continue
+		}
+		command.SetArgs(append([]string{packageDir}, flags...))
+		command.SetOut(&stdout)
+		command.SetErr(&stderr)
+		err := command.Execute()
+		return stdout.String(), err
+	}
+	return "", nil
+}
+
+func TestStandaloneCommands(t *testing.T) {
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	packageDir := samplePackage(t, "amf: 2")
+
+	// Explain lists jobs of this function only
+	stdout, err := runCommand("explain", packageDir)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Equal(t, "[2] amf-day0: mutators localhost:5000/render-ytt:v0.1, config: fn.yaml\n", strings.SplitAfter(stdout, "\n")[0])
+	assert.Contains(t, stdout, "template    amf/template.yaml  v1alpha1/YttTemplate/amf-template  -> amf/template.yaml\n")
+	assert.Contains(t, stdout, "unselected  Kptfile            kpt.dev/v1/Kptfile/amf             -> -\n")
+	assert.Contains(t, stdout, "ytt args: -f amf/template.yaml\n")
+	assert.Contains(t, stdout, "document 1            -> amf/out.yaml  v1/AmfConfiguration/amf-out  data\n")
+
+	// Check fails on outdated outputs without writing them
+	stdout, err = runCommand("check", packageDir)
+	assert.EqualError(t, err, "package is not up to date: 1 files would change")
+	assert.Equal(t, "would change: amf/out.yaml\n", stdout)
+	content, _ := os.ReadFile(filepath.Join(packageDir, "amf", "out.yaml"))
+	assert.Contains(t, string(content), "data: {}")
+
+	// Render writes outputs back, after which the package is up to date
+	if _, err := runCommand("render", packageDir); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	content, _ = os.ReadFile(filepath.Join(packageDir, "amf", "out.yaml"))
+	assert.Contains(t, string(content), "data: {amf: 2}")
+	if _, err := runCommand("check", packageDir); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+}
+
+func TestStandaloneCommandsErrors(t *testing.T) {
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+
+	// Directory without Kptfile
+	_, err := runCommand("render", t.TempDir())
+	assert.ErrorContains(t, err, "has no Kptfile")
+
+	// Kptfile without entries of this function
+	packageDir := writePackage(t, map[string]string{
+		"Kptfile": "apiVersion: kpt.dev/v1\nkind: Kptfile\nmetadata:\n  name: amf\npipeline:\n  mutators:\n    - image: set-labels\n",
+	})
+	_, err = runCommand("render", packageDir)
+	assert.ErrorContains(t, err, "has no pipeline entry with image matching [render-ytt ytt-executor]")
+
+	// Explain reports jobs failing before ytt runs
+	packageDir = samplePackage(t, "amf: 2")
+	fnConfig := filepath.Join(packageDir, "fn.yaml")
+	content, _ := os.ReadFile(fnConfig)
+	if err := os.WriteFile(fnConfig, append(content, []byte("limits:\n  max_documents: many\n")...), 0o644); err != nil {
+		t.Fatalf("failed to write package file: %v", err)
+	}
+	stdout, err := runCommand("explain", packageDir)
+	assert.EqualError(t, err, "1 render jobs would fail")
+	assert.Contains(t, stdout, "  error: ")
+
+	// Explain checks consistency rules like the render
+	packageDir = samplePackage(t, "amf: 2")
+	fnConfig = filepath.Join(packageDir, "fn.yaml")
+	content, _ = os.ReadFile(fnConfig)
+	rule := "consistency:\n  - name: shared-amf\n    resources:\n      template: {names: [amf-template]}\n      site: {names: [site-ciq]}\n    equal: [amf]\n"
+	if err := os.WriteFile(fnConfig, append(content, []byte(rule)...), 0o644); err != nil {
+		t.Fatalf("failed to write package file: %v", err)
+	}
+	stdout, err = runCommand("explain", packageDir)
+	assert.EqualError(t, err, "1 render jobs would fail")
+	assert.Contains(t, stdout, "  error: 1 of 1 consistency rules failed")
+
+	// Failing jobs leave the package untouched
+	packageDir = samplePackage(t, "- amf: 2")
+	_, err = runCommand("render", packageDir)
+	assert.ErrorContains(t, err, "[2] amf-day0: ")
+	content, _ = os.ReadFile(filepath.Join(packageDir, "amf", "out.yaml"))
+	assert.Contains(t, string(content), "data: {}")
+}
+
+func TestTestCommand(t *testing.T) {
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	packageDir := samplePackage(t, "amf: 2")
+	ciq := "apiVersion: v1alpha1\nkind: YttTemplate\nmetadata:\n  name: amf-template\nytt_template_content:\n  amf: 2\n"
+	if err := os.MkdirAll(filepath.Join(packageDir, "testdata", "day0"), 0o755); err != nil {
+		t.Fatalf("failed to create test case directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(packageDir, "testdata", "day0", "ciq.yaml"), []byte(ciq), 0o644); err != nil {
+		t.Fatalf("failed to write test case: %v", err)
+	}
+
+	// Cases without golden files fail
+	stdout, err := runCommand("test", packageDir)
+	assert.EqualError(t, err, "1 of 1 test cases failed")
+	assert.Contains(t, stdout, "FAIL day0\n")
+	assert.Contains(t, stdout, "+data: {amf: 2}\n")
+
+	// Update writes golden files, after which the case passes
+	stdout, err = runCommand("test", packageDir, "--update")
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Equal(t, "PASS day0\n  updated: expected/amf/out.yaml\n", stdout)
+	stdout, err = runCommand("test", packageDir)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Equal(t, "PASS day0\n", stdout)
+
+	// The package itself is left untouched
+	content, _ := os.ReadFile(filepath.Join(packageDir, "amf", "out.yaml"))
+	assert.Contains(t, string(content), "data: {}")
+}
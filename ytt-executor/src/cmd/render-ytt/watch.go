@@ -0,0 +1,283 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/pipeline"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/templateTest"
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// fileStamp modification time and size of a package file, a change of either marks the file changed
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// jobDependencies package files a render job reads and writes
+//
+// inputs: paths of its function config, templates, data values, libraries and Secrets
+//
+// outputs: paths of resources receiving its output
+type jobDependencies struct {
+	inputs  map[string]bool
+	outputs []string
+}
+
+// watcher re-renders jobs of a package directory affected by changed files
+//
+// out: writer receiving changed files and diffs of outputs
+//
+// errOut: writer receiving warnings and errors of jobs
+//
+// stamps: package files as of the last render
+type watcher struct {
+	out         io.Writer
+	errOut      io.Writer
+	yttProc     *YttProcessor
+	packagePath string
+	images      []string
+	stamps      map[string]fileStamp
+}
+
+// run renders all jobs once, then polls the package every interval until ctx is done
+// Failing renders are reported and watching continues
+func (w *watcher) run(ctx context.Context, interval time.Duration) error {
+	if err := w.poll(true); err != nil {
+		fmt.Fprintf(w.errOut, "error: %v\n", err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.poll(false); err != nil {
+				fmt.Fprintf(w.errOut, "error: %v\n", err)
+			}
+		}
+	}
+}
+
+// poll re-renders jobs affected by files changed since the last poll and writes their outputs back
+//
+// Parameters:
+//   - all: render all jobs, regardless of changed files
+//
+// Returns:
+//   - error: when the package cannot be read or a job fails, files are then left untouched
+func (w *watcher) poll(all bool) error {
+	stamps, err := scanPackage(w.packagePath)
+	if err != nil {
+		return err
+	}
+	changed := changedStamps(w.stamps, stamps)
+	if !all && len(changed) == 0 {
+		return nil
+	}
+
+	// Remember the files seen, so a failing render is retried on the next change only
+	w.stamps = stamps
+	paths := make([]string, 0, len(changed))
+	for changedPath := range changed {
+		paths = append(paths, changedPath)
+	}
+	sort.Strings(paths)
+	if !all {
+		fmt.Fprintf(w.out, "changed: %s\n", strings.Join(paths, ", "))
+	}
+
+	packageRW, items, jobs, err := pipeline.ReadPackage(w.packagePath, w.images, templateTest.DefaultTestDataDirectory)
+	if err != nil {
+		return err
+	}
+	if !all && !changed[config.KptfileName] {
+		jobs = affectedJobs(jobs, items, changed)
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	for _, job := range jobs {
+		fmt.Fprintf(w.out, "rendering: %s\n", job.Name())
+	}
+
+	before, err := pipeline.SerializePackage(items)
+	if err != nil {
+		return err
+	}
+	items, _, err = pipeline.Run(w.errOut, w.yttProc, items, jobs, framework.Warning, framework.Error)
+	if err != nil {
+		return err
+	}
+	after, err := pipeline.SerializePackage(items)
+	if err != nil {
+		return err
+	}
+	if len(pipeline.ChangedFiles(before, after)) == 0 {
+		return nil
+	}
+	if err := writeDiff(w.out, before, after); err != nil {
+		return err
+	}
+	if err := packageRW.Write(items); err != nil {
+		return err
+	}
+
+	// Outputs written back are not changes to render again
+	w.stamps, err = scanPackage(w.packagePath)
+	return err
+}
+
+// affectedJobs returns jobs reading a changed file, or reading outputs of an earlier affected job
+//
+// Parameters:
+//   - jobs: pipeline entries of this function in order
+//   - items: package resources
+//   - changed: package relative paths of changed files
+//
+// Returns:
+//   - []pipeline.Job: jobs to render again in order, jobs failing to plan are always rendered to report their error
+func affectedJobs(jobs []pipeline.Job, items []*kyaml.RNode, changed map[string]bool) []pipeline.Job {
+	stale := map[string]bool{}
+	for changedPath := range changed {
+		stale[changedPath] = true
+	}
+
+	var affected []pipeline.Job
+	for _, job := range jobs {
+		dependencies, err := planDependencies(job, items)
+		if err == nil && !dependencies.readsAny(stale) {
+			continue
+		}
+		affected = append(affected, job)
+		for _, output := range dependencies.outputs {
+			stale[output] = true
+		}
+	}
+	return affected
+}
+
+// planDependencies resolves files job reads and writes from its render plan
+func planDependencies(job pipeline.Job, items []*kyaml.RNode) (jobDependencies, error) {
+	dependencies := jobDependencies{inputs: map[string]bool{}}
+	if job.FnConfig != nil && job.ConfigSource != pipeline.ConfigMap {
+		dependencies.inputs[pipeline.ItemPath(job.FnConfig)] = true
+	}
+
+	resourceList := job.ResourceList(items)
+	config.Reset()
+	defer config.Reset()
+	plan, err := planRender(logger.NewCollector(), resourceList)
+	if err != nil {
+		return dependencies, err
+	}
+	for _, input := range plan.inputs {
+		if input.FileName != "" {
+			dependencies.inputs[pipeline.ItemPath(input.Item)] = true
+		}
+	}
+	for _, output := range plan.outputs {
+		dependencies.outputs = append(dependencies.outputs, pipeline.ItemPath(output))
+	}
+	return dependencies, nil
+}
+
+// readsAny checks whether any of paths is an input
+func (dependencies jobDependencies) readsAny(paths map[string]bool) bool {
+	for input := range dependencies.inputs {
+		if paths[input] {
+			return true
+		}
+	}
+	return false
+}
+
+// scanPackage stamps all files of the package at packagePath by package relative path
+func scanPackage(packagePath string) (map[string]fileStamp, error) {
+	stamps := map[string]fileStamp{}
+	err := filepath.WalkDir(packagePath, func(fileName string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if fileName != packagePath && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(packagePath, fileName)
+		if err != nil {
+			return err
+		}
+		stamps[filepath.ToSlash(relative)] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("package %s could not be read: %v", packagePath, err)
+	}
+	return stamps, nil
+}
+
+// changedStamps returns paths of files added, removed or changed in after
+func changedStamps(before, after map[string]fileStamp) map[string]bool {
+	changed := map[string]bool{}
+	for fileName, stamp := range after {
+		if previous, found := before[fileName]; !found || !previous.modTime.Equal(stamp.modTime) || previous.size != stamp.size {
+			changed[fileName] = true
+		}
+	}
+	for fileName := range before {
+		if _, found := after[fileName]; !found {
+			changed[fileName] = true
+		}
+	}
+	return changed
+}
+
+// writeDiff prints a unified diff with one line of context of every file changed from before to after
+func writeDiff(out io.Writer, before, after map[string]string) error {
+	for _, fileName := range pipeline.ChangedFiles(before, after) {
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(before[fileName]),
+			B:        difflib.SplitLines(after[fileName]),
+			FromFile: "a/" + fileName,
+			ToFile:   "b/" + fileName,
+			Context:  1,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(out, diff)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAffectedJobs(t *testing.T) {
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+
+	// Day0 renders amf/day0.yaml, which day1 reads as data values next to its own template
+	packageDir := writePackage(t, map[string]string{
+		"Kptfile": `apiVersion: kpt.dev/v1
+kind: Kptfile
+metadata:
+  name: amf
+pipeline:
+  mutators:
+    - image: render-ytt
+      configPath: day0.yaml
+    - image: render-ytt
+      configPath: day1.yaml
+    - image: render-ytt
+      configPath: smf.yaml
+`,
+		"day0.yaml":              "apiVersion: v1\nkind: RenderConfig\nmetadata:\n  name: day0\ninput:\n  template_selector: {paths: [amf/template-day0.yaml]}\noutput:\n  selector: {paths: [amf/day0.yaml]}\n",
+		"day1.yaml":              "apiVersion: v1\nkind: RenderConfig\nmetadata:\n  name: day1\ninput:\n  template_selector: {paths: [amf/template-day1.yaml]}\n  ciq_selector: {paths: [amf/day0.yaml]}\noutput:\n  selector: {paths: [amf/day1.yaml]}\n",
+		"smf.yaml":               "apiVersion: v1\nkind: RenderConfig\nmetadata:\n  name: smf\ninput:\n  template_selector: {paths: [smf/template.yaml]}\noutput:\n  selector: {paths: [smf/out.yaml]}\n",
+		"amf/template-day0.yaml": "apiVersion: v1alpha1\nkind: YttTemplate\nmetadata:\n  name: day0\nytt_template_content:\n  amf: 1\n",
+		"amf/template-day1.yaml": "apiVersion: v1alpha1\nkind: YttTemplate\nmetadata:\n  name: day1\nytt_template_content:\n  amf: 1\n",
+		"smf/template.yaml":      "apiVersion: v1alpha1\nkind: YttTemplate\nmetadata:\n  name: smf\nytt_template_content:\n  smf: 1\n",
+		"amf/day0.yaml":          "apiVersion: v1\nkind: Output\nmetadata:\n  name: day0\ndata: {}\n",
+		"amf/day1.yaml":          "apiVersion: v1\nkind: Output\nmetadata:\n  name: day1\ndata: {}\n",
+		"smf/out.yaml":           "apiVersion: v1\nkind: Output\nmetadata:\n  name: smf\ndata: {}\n",
+	})
+	_, items, jobs, err := pipeline.ReadPackage(packageDir, pipeline.DefaultImages)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Test structure
+	tests := []struct {
+		name         string
+		changed      []string
+		expectedJobs []string
+	}{ // Test list
+
+		// Jobs reading outputs of affected jobs are affected as well
+		{
+			"Test day0 template affects day0 and day1",
+			[]string{"amf/template-day0.yaml"},
+			[]string{"[1] day0", "[2] day1"},
+		},
+
+		// Later jobs only
+		{
+			"Test day1 template affects day1",
+			[]string{"amf/template-day1.yaml"},
+			[]string{"[2] day1"},
+		},
+
+		// Function configs are inputs of their job
+		{
+			"Test function config affects its job",
+			[]string{"smf.yaml"},
+			[]string{"[3] smf"},
+		},
+
+		// Files no job reads
+		{
+			"Test unrelated file affects no job",
+			[]string{"README.md", "smf/out.yaml"},
+			nil,
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := map[string]bool{}
+			for _, changedPath := range tt.changed {
+				changed[changedPath] = true
+			}
+
+			// Execute function
+			var gotJobs []string
+			for _, job := range affectedJobs(jobs, items, changed) {
+				gotJobs = append(gotJobs, job.Name())
+			}
+
+			// Assert response
+			assert.Equal(t, tt.expectedJobs, gotJobs)
+		})
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	packageDir := samplePackage(t, "amf: 2")
+	var out, errOut bytes.Buffer
+	packageWatcher := &watcher{
+		out:         &out,
+		errOut:      &errOut,
+		yttProc:     &YttProcessor{},
+		packagePath: packageDir,
+		images:      pipeline.DefaultImages,
+	}
+
+	// First poll renders all jobs and prints the diff of outputs
+	if err := packageWatcher.poll(true); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Contains(t, out.String(), "rendering: [2] amf-day0\n")
+	assert.Contains(t, out.String(), "--- a/amf/out.yaml\n+++ b/amf/out.yaml\n")
+	assert.Contains(t, out.String(), "-data: {}\n+data: {amf: 2}\n")
+
+	// Written outputs are no change
+	out.Reset()
+	if err := packageWatcher.poll(false); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Equal(t, "", out.String())
+
+	// Files no job reads trigger no render
+	if err := os.WriteFile(filepath.Join(packageDir, "notes.txt"), []byte("amf"), 0o644); err != nil {
+		t.Fatalf("failed to write package file: %v", err)
+	}
+	if err := packageWatcher.poll(false); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Equal(t, "changed: notes.txt\n", out.String())
+
+	// Changed templates render their job again
+	out.Reset()
+	template := filepath.Join(packageDir, "amf", "template.yaml")
+	content, _ := os.ReadFile(template)
+	if err := os.WriteFile(template, append(content, []byte("  smf: 1\n")...), 0o644); err != nil {
+		t.Fatalf("failed to write package file: %v", err)
+	}
+	if err := packageWatcher.poll(false); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Equal(t, "changed: amf/template.yaml\nrendering: [2] amf-day0\n", out.String())
+	assert.Equal(t, "", errOut.String())
+}
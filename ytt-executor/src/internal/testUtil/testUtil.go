@@ -0,0 +1,74 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testUtil holds stand-ins and fixtures shared by tests of several packages
+package testUtil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// CopyProcessor stands in for the render function, copying a field of the Ciq resource into the data of outputs
+// Outputs are selected by config.YttOutputFileKind after configuring the function config, when given
+//
+// Field: field of the Ciq resource to copy
+type CopyProcessor struct {
+	Field string
+}
+
+func (processor CopyProcessor) Process(resourceList *framework.ResourceList) error {
+	if resourceList.FunctionConfig != nil {
+		if err := config.Configure(logger.NewCollector(), resourceList.FunctionConfig); err != nil {
+			return err
+		}
+	}
+	var value *kyaml.RNode
+	for _, item := range resourceList.Items {
+		if field := item.Field(processor.Field); item.GetKind() == "Ciq" && field != nil {
+			value = field.Value
+		}
+	}
+	if value == nil {
+		return fmt.Errorf("ciq has no %s", processor.Field)
+	}
+	for _, item := range resourceList.Items {
+		if item.GetKind() == config.YttOutputFileKind {
+			if err := item.PipeE(kyaml.SetField("data", kyaml.NewMapRNode(nil)), kyaml.SetField(processor.Field, value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteFiles writes files, given as file name to content, under dir creating missing directories
+func WriteFiles(t *testing.T, dir string, files map[string]string) {
+	for fileName, content := range files {
+		fileName = filepath.Join(dir, fileName)
+		if err := os.MkdirAll(filepath.Dir(fileName), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fileName, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bundle to fetch ytt templates and libraries from OCI images or local tarballs
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+)
+
+// imgpkgMetadataDir directory of imgpkg bundle metadata, never passed to ytt
+const imgpkgMetadataDir = ".imgpkg"
+
+// ResolveSources fetches all image and tarball config.YttSources and returns ytt file arguments for their files
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - baseDir: directory to extract sources to when no config.YttSourceCacheDir is set
+//
+// Returns:
+//   - fileArgs: list of -f <relative_name>=<file_name> arguments
+//   - error: from fetching, verifying or extracting a source
+func ResolveSources(results *logger.Collector, baseDir string) (fileArgs []string, err error) {
+	for i, source := range config.YttSources {
+		// Package sources are read as resources by ReadPackageSources
+		if source.Package != "" {
+			continue
+		}
+
+		sourceDir, err := fetchSource(results, source, filepath.Join(baseDir, fmt.Sprintf("source-%d", i)))
+		if err != nil {
+			return fileArgs, err
+		}
+
+		args, err := sourceFileArgs(source, sourceDir)
+		if err != nil {
+			return fileArgs, err
+		}
+		fileArgs = append(fileArgs, args...)
+	}
+	return fileArgs, nil
+}
+
+// fetchSource validates source and extracts it, reusing config.YttSourceCacheDir when available
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - source: config.YttSource to fetch
+//   - extractDir: directory to extract to when caching is disabled
+//
+// Returns:
+//   - string: directory holding extracted source files
+//   - error: from validating, fetching or extracting source
+func fetchSource(results *logger.Collector, source config.YttSource, extractDir string) (string, error) {
+	if err := validateSourceType(source); err != nil {
+		return "", err
+	}
+
+	switch {
+	case source.Image != "":
+		reference, err := parseImageReference(source.Image)
+		if err != nil {
+			return "", err
+		}
+		if cachedDir, found := lookupCache(reference.digest); found {
+			results.LogDebug(fmt.Sprintf("Using cached source: %s", source.Image))
+			return cachedDir, nil
+		}
+		results.LogInfo(fmt.Sprintf("Pulling source image: %s", source.Image))
+		return extractToCache(reference.digest, extractDir, func(targetDir string) error {
+			return pullImage(reference, source.Insecure, targetDir)
+		})
+
+	case source.Tarball != "":
+		if source.Digest != "" {
+			if err := validateDigest(source.Digest); err != nil {
+				return "", err
+			}
+			if cachedDir, found := lookupCache(source.Digest); found {
+				results.LogDebug(fmt.Sprintf("Using cached source: %s", source.Tarball))
+				return cachedDir, nil
+			}
+		}
+		return extractToCache(source.Digest, extractDir, func(targetDir string) error {
+			return extractTarballFile(source.Tarball, source.Digest, targetDir)
+		})
+	}
+	return "", fmt.Errorf("package source: %s, has to be read with ReadPackageSources", source.Package)
+}
+
+// validateSourceType checks source defines exactly one of image, tarball or package
+func validateSourceType(source config.YttSource) error {
+	var defined []string
+	for _, location := range []string{source.Image, source.Tarball, source.Package} {
+		if location != "" {
+			defined = append(defined, location)
+		}
+	}
+	switch len(defined) {
+	case 0:
+		return fmt.Errorf("source has to define an image, tarball or package")
+	case 1:
+		return nil
+	}
+	return fmt.Errorf("source can only define one of image, tarball or package, got: %s", strings.Join(defined, " and "))
+}
+
+// lookupCache checks config.YttSourceCacheDir for an extracted source with given digest
+func lookupCache(digest string) (string, bool) {
+	if config.YttSourceCacheDir == "" || digest == "" {
+		return "", false
+	}
+	cachedDir := cacheDir(digest)
+	if info, err := os.Stat(cachedDir); err == nil && info.IsDir() {
+		return cachedDir, true
+	}
+	return "", false
+}
+
+// cacheDir directory of an extracted source with given digest in config.YttSourceCacheDir
+func cacheDir(digest string) string {
+	algorithm, hexDigest, _ := strings.Cut(digest, ":")
+	return filepath.Join(config.YttSourceCacheDir, algorithm, hexDigest)
+}
+
+// extractToCache runs extract into extractDir, or into config.YttSourceCacheDir when caching is possible
+//
+// Parameters:
+//   - digest: digest identifying source in cache, empty disables caching
+//   - extractDir: directory to extract to when caching is disabled
+//   - extract: function extracting source into given directory
+//
+// Returns:
+//   - string: directory holding extracted source files
+//   - error: from extract or moving result into cache
+func extractToCache(digest string, extractDir string, extract func(targetDir string) error) (string, error) {
+	if config.YttSourceCacheDir == "" || digest == "" {
+		return extractDir, extract(extractDir)
+	}
+
+	// Extract next to the final cache entry and rename, so interrupted pulls never leave a partial entry
+	targetDir := cacheDir(digest)
+	if err := os.MkdirAll(filepath.Dir(targetDir), os.ModePerm); err != nil {
+		return "", err
+	}
+	tempDir, err := os.MkdirTemp(filepath.Dir(targetDir), ".partial-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+	if err := extract(tempDir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tempDir, targetDir); err != nil {
+		// A concurrent render cached the same digest first, its entry holds the same content
+		if cachedDir, found := lookupCache(digest); found {
+			return cachedDir, nil
+		}
+		return "", err
+	}
+	return targetDir, nil
+}
+
+// extractTarballFile verifies and extracts a local tarball
+//
+// Parameters:
+//   - tarballPath: path of tar or tar.gz file
+//   - digest: expected sha256 digest of the file, empty to skip verification
+//   - targetDir: directory to extract to
+//
+// Returns:
+//   - error: from reading, verifying or extracting tarball
+func extractTarballFile(tarballPath string, digest string, targetDir string) error {
+	if !filepath.IsAbs(tarballPath) {
+		tarballPath = filepath.Join(config.YttWorkDirectory, tarballPath)
+	}
+	content, err := os.ReadFile(tarballPath)
+	if err != nil {
+		return fmt.Errorf("failed to read source tarball: %v", err)
+	}
+	if digest != "" {
+		if actual := sha256Digest(content); actual != digest {
+			return fmt.Errorf("source tarball: %s, digest mismatch, expected: %s, got: %s", tarballPath, digest, actual)
+		}
+	}
+	return extractTar(bytes.NewReader(content), targetDir)
+}
+
+// extractTar extracts regular files and directories of a tar or tar.gz stream into targetDir
+//
+// Parameters:
+//   - reader: tar or gzip compressed tar stream
+//   - targetDir: directory to extract to
+//
+// Returns:
+//   - error: from reading stream or for entries escaping targetDir
+func extractTar(reader io.Reader, targetDir string) error {
+	// Detect gzip compression by magic bytes
+	bufferedReader := bufio.NewReader(reader)
+	if magic, err := bufferedReader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	} else {
+		reader = bufferedReader
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read source archive: %v", err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("source archive entry escapes extraction directory: %s", header.Name)
+		}
+		target := filepath.Join(targetDir, filepath.FromSlash(name))
+
+		// Links and special files are never needed by ytt and are skipped
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.ModePerm); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(file, tarReader); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sourceFileArgs lists files of an extracted source as ytt file arguments
+//
+// Parameters:
+//   - source: config.YttSource the files belong to
+//   - sourceDir: directory holding extracted source files
+//
+// Returns:
+//   - fileArgs: list of -f <relative_name>=<file_name> arguments
+//   - error: when source.Path does not exist or is not local
+func sourceFileArgs(source config.YttSource, sourceDir string) (fileArgs []string, err error) {
+	rootDir := sourceDir
+	if source.Path != "" {
+		if !filepath.IsLocal(source.Path) {
+			return nil, fmt.Errorf("source path must be relative to the source root: %s", source.Path)
+		}
+		rootDir = filepath.Join(sourceDir, filepath.FromSlash(source.Path))
+		if info, err := os.Stat(rootDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("source path: %s, is not a directory in the source", source.Path)
+		}
+	}
+
+	prefix := ""
+	if source.Library != "" {
+		prefix = path.Join("_ytt_lib", source.Library)
+	}
+
+	err = filepath.WalkDir(rootDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(rootDir, filePath)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		if entry.IsDir() {
+			if relativePath == imgpkgMetadataDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fileArgs = append(fileArgs, "-f", path.Join(prefix, relativePath)+"="+filePath)
+		return nil
+	})
+	return fileArgs, err
+}
+
+// validateDigest checks digest is a sha256 digest
+func validateDigest(digest string) error {
+	algorithm, hexDigest, found := strings.Cut(digest, ":")
+	if !found || algorithm != "sha256" || len(hexDigest) != sha256.Size*2 {
+		return fmt.Errorf("invalid digest: %s, expected sha256:<64 hex characters>", digest)
+	}
+	if _, err := hex.DecodeString(hexDigest); err != nil {
+		return fmt.Errorf("invalid digest: %s, expected sha256:<64 hex characters>", digest)
+	}
+	return nil
+}
+
+// sha256Digest computes sha256 digest of content in <algorithm>:<hex> form
+func sha256Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,377 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// buildTarGz creates a gzip compressed tar archive of the given file name to content map
+func buildTarGz(t *testing.T, files map[string]string) []byte {
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write tar content: %v", err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("failed to close gzip: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// Sample bundle content
+var bundleFiles = map[string]string{
+	".imgpkg/images.yml":   "apiVersion: imgpkg.carvel.dev/v1alpha1",
+	"config/amf.yaml":      "#@ load(\"@ytt:data\", \"data\")\namf: #@ data.values.name\n",
+	"config/capacity.star": "def instances(sessions):\n  return sessions // 128 + 1\nend\n",
+}
+
+func TestResolveSourcesTarball(t *testing.T) {
+	// Write sample tarball
+	tarball := buildTarGz(t, bundleFiles)
+	tarballPath := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	if err := os.WriteFile(tarballPath, tarball, 0o644); err != nil {
+		t.Fatalf("failed to write tarball: %v", err)
+	}
+	digest := sha256Digest(tarball)
+
+	// Test structure
+	tests := []struct {
+		name          string
+		source        config.YttSource
+		wantFiles     []string
+		expectedError string
+	}{ // Test list
+
+		// Whole bundle in root file set, imgpkg metadata skipped
+		{
+			"Test tarball in root file set",
+			config.YttSource{Tarball: tarballPath, Digest: digest},
+			[]string{"config/amf.yaml", "config/capacity.star"},
+			"",
+		},
+
+		// Sub directory as library
+		{
+			"Test tarball path as library",
+			config.YttSource{Tarball: tarballPath, Path: "config", Library: "nflib"},
+			[]string{"_ytt_lib/nflib/amf.yaml", "_ytt_lib/nflib/capacity.star"},
+			"",
+		},
+
+		// Digest mismatch
+		{
+			"Test tarball digest mismatch",
+			config.YttSource{Tarball: tarballPath, Digest: "sha256:" + strings.Repeat("0", 64)},
+			nil,
+			fmt.Sprintf("source tarball: %s, digest mismatch, expected: sha256:%s, got: %s", tarballPath, strings.Repeat("0", 64), digest),
+		},
+
+		// Invalid digest
+		{
+			"Test tarball invalid digest",
+			config.YttSource{Tarball: tarballPath, Digest: "md5:1234"},
+			nil,
+			"invalid digest: md5:1234, expected sha256:<64 hex characters>",
+		},
+
+		// Missing sub directory
+		{
+			"Test tarball missing path",
+			config.YttSource{Tarball: tarballPath, Path: "templates"},
+			nil,
+			"source path: templates, is not a directory in the source",
+		},
+
+		// Both image and tarball
+		{
+			"Test image and tarball",
+			config.YttSource{Tarball: tarballPath, Image: "registry.io/templates@" + digest},
+			nil,
+			fmt.Sprintf("source can only define one of image, tarball or package, got: registry.io/templates@%s and %s", digest, tarballPath),
+		},
+
+		// Neither image nor tarball
+		{
+			"Test empty source",
+			config.YttSource{Library: "nflib"},
+			nil,
+			"source has to define an image, tarball or package",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.YttSources = []config.YttSource{tt.source}
+			defer func() {
+				config.YttSources = nil
+			}()
+
+			// Execute function
+			baseDir := t.TempDir()
+			fileArgs, err := ResolveSources(logger.NewCollector(), baseDir)
+
+			// Assert error or listed files
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			if err != nil {
+				t.Fatalf("error not expected %v", err)
+			}
+			var gotFiles []string
+			for i := 1; i < len(fileArgs); i += 2 {
+				relativeName, fileName, _ := strings.Cut(fileArgs[i], "=")
+				assert.True(t, strings.HasPrefix(fileName, baseDir))
+				gotFiles = append(gotFiles, relativeName)
+			}
+			assert.Equal(t, tt.wantFiles, gotFiles)
+		})
+	}
+}
+
+func TestResolveSourcesCache(t *testing.T) {
+	// Write sample tarball
+	tarball := buildTarGz(t, bundleFiles)
+	tarballPath := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	if err := os.WriteFile(tarballPath, tarball, 0o644); err != nil {
+		t.Fatalf("failed to write tarball: %v", err)
+	}
+
+	// Enable cache and reset after test
+	config.YttSourceCacheDir = t.TempDir()
+	config.YttSources = []config.YttSource{{Tarball: tarballPath, Digest: sha256Digest(tarball), Path: "config"}}
+	defer func() {
+		config.YttSourceCacheDir = ""
+		config.YttSources = nil
+	}()
+
+	// First resolve extracts into cache
+	firstArgs, err := ResolveSources(logger.NewCollector(), t.TempDir())
+	if err != nil {
+		t.Fatalf("error not expected %v", err)
+	}
+	assert.Contains(t, firstArgs[1], config.YttSourceCacheDir)
+
+	// Second resolve works offline from cache
+	if err := os.Remove(tarballPath); err != nil {
+		t.Fatalf("failed to remove tarball: %v", err)
+	}
+	secondArgs, err := ResolveSources(logger.NewCollector(), t.TempDir())
+	if err != nil {
+		t.Fatalf("error not expected %v", err)
+	}
+	assert.Equal(t, firstArgs, secondArgs)
+}
+
+func Test_extractToCacheConcurrent(t *testing.T) {
+	config.YttSourceCacheDir = t.TempDir()
+	defer func() {
+		config.YttSourceCacheDir = ""
+	}()
+	digest := sha256Digest([]byte("bundle"))
+
+	// Another render moves its extraction into the cache while this one extracts
+	extractDir, err := extractToCache(digest, t.TempDir(), func(targetDir string) error {
+		if err := os.MkdirAll(cacheDir(digest), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(cacheDir(digest), "amf.yaml"), []byte("first"), 0o644); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(targetDir, "amf.yaml"), []byte("second"), 0o644)
+	})
+
+	// The existing cache entry is used
+	if err != nil {
+		t.Fatalf("error not expected %v", err)
+	}
+	assert.Equal(t, cacheDir(digest), extractDir)
+	content, err := os.ReadFile(filepath.Join(extractDir, "amf.yaml"))
+	if err != nil {
+		t.Fatalf("error not expected %v", err)
+	}
+	assert.Equal(t, "first", string(content))
+}
+
+func TestResolveSourcesImage(t *testing.T) {
+	// Sample image layer and manifest
+	layer := buildTarGz(t, bundleFiles)
+	layerDigest := sha256Digest(layer)
+	manifest := []byte(fmt.Sprintf(`{
+  "schemaVersion": 2,
+  "mediaType": "application/vnd.oci.image.manifest.v1+json",
+  "layers": [{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": "%s"}]
+}`, layerDigest))
+	manifestDigest := sha256Digest(manifest)
+
+	// Registry stand-in requiring an anonymous bearer token
+	var registry *httptest.Server
+	registry = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch {
+		case request.URL.Path == "/token":
+			assert.Equal(t, "repository:nf/templates:pull", request.URL.Query().Get("scope"))
+			writer.Write([]byte(`{"token": "anonymous"}`))
+		case request.Header.Get("Authorization") != "Bearer anonymous":
+			writer.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:nf/templates:pull"`, registry.URL))
+			writer.WriteHeader(http.StatusUnauthorized)
+		case request.URL.Path == "/v2/nf/templates/manifests/"+manifestDigest:
+			writer.Write(manifest)
+		case request.URL.Path == "/v2/nf/templates/blobs/"+layerDigest:
+			writer.Write(layer)
+		case request.URL.Path == "/v2/nf/tampered/manifests/"+manifestDigest:
+			writer.Write(append(manifest, ' '))
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer registry.Close()
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	// Pull image as library
+	t.Run("Test pull image", func(t *testing.T) {
+		config.YttSources = []config.YttSource{{
+			Image:    host + "/nf/templates:v1@" + manifestDigest,
+			Path:     "config",
+			Library:  "nflib",
+			Insecure: true,
+		}}
+		defer func() {
+			config.YttSources = nil
+		}()
+
+		baseDir := t.TempDir()
+		fileArgs, err := ResolveSources(logger.NewCollector(), baseDir)
+		if err != nil {
+			t.Fatalf("error not expected %v", err)
+		}
+		assert.Equal(t, []string{
+			"-f", "_ytt_lib/nflib/amf.yaml=" + filepath.Join(baseDir, "source-0", "config", "amf.yaml"),
+			"-f", "_ytt_lib/nflib/capacity.star=" + filepath.Join(baseDir, "source-0", "config", "capacity.star"),
+		}, fileArgs)
+	})
+
+	// Tampered manifest content
+	t.Run("Test tampered manifest", func(t *testing.T) {
+		config.YttSources = []config.YttSource{{Image: host + "/nf/tampered@" + manifestDigest, Insecure: true}}
+		defer func() {
+			config.YttSources = nil
+		}()
+
+		_, err := ResolveSources(logger.NewCollector(), t.TempDir())
+		assert.ErrorContains(t, err, "digest mismatch for "+registry.URL+"/v2/nf/tampered/manifests/"+manifestDigest)
+	})
+
+	// Registry never answering
+	t.Run("Test stalled registry", func(t *testing.T) {
+		stalled := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			<-request.Context().Done()
+		}))
+		defer stalled.Close()
+		config.YttSources = []config.YttSource{{Image: strings.TrimPrefix(stalled.URL, "http://") + "/nf/templates@" + manifestDigest, Insecure: true}}
+		httpClient = &http.Client{Timeout: 100 * time.Millisecond}
+		defer func() {
+			config.YttSources = nil
+			httpClient = &http.Client{Timeout: pullTimeout}
+		}()
+
+		_, err := ResolveSources(logger.NewCollector(), t.TempDir())
+		assert.ErrorContains(t, err, "Client.Timeout exceeded")
+	})
+}
+
+func Test_parseImageReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	// Test structure
+	tests := []struct {
+		name          string
+		image         string
+		expected      imageReference
+		expectedError string
+	}{ // Test list
+
+		// Registry with port, tag and digest
+		{
+			"Test tagged reference with digest",
+			"localhost:5000/nf/templates:v1@" + digest,
+			imageReference{registry: "localhost:5000", repository: "nf/templates", digest: digest},
+			"",
+		},
+
+		// Tag only
+		{
+			"Test reference without digest",
+			"registry.io/nf/templates:v1",
+			imageReference{},
+			"source image: registry.io/nf/templates:v1, has to be pinned by digest (<image>@sha256:...)",
+		},
+
+		// No registry host
+		{
+			"Test reference without registry",
+			"templates@" + digest,
+			imageReference{},
+			"source image: templates@" + digest + ", has to include a registry host",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reference, err := parseImageReference(tt.image)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			if err != nil {
+				t.Fatalf("error not expected %v", err)
+			}
+			assert.Equal(t, tt.expected, reference)
+		})
+	}
+}
+
+func Test_extractTarEscape(t *testing.T) {
+	// Archive entry escaping the extraction directory
+	archive := buildTarGz(t, map[string]string{"../escape.yaml": "escaped: true"})
+	err := extractTar(bytes.NewReader(archive), t.TempDir())
+	assert.EqualError(t, err, "source archive entry escapes extraction directory: ../escape.yaml")
+}
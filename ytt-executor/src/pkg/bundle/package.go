@@ -0,0 +1,115 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ReadPackageSources reads resources of all package config.YttSources
+// Resource paths are prefixed with packages/<index>-<package_name> so they never collide with the current package
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//
+// Returns:
+//   - []*kyaml.RNode: resources read from referenced packages
+//   - error: when a referenced package does not exist or cannot be read
+func ReadPackageSources(results *logger.Collector) (items []*kyaml.RNode, err error) {
+	for i, source := range config.YttSources {
+		if source.Package == "" {
+			continue
+		}
+		if err := validateSourceType(source); err != nil {
+			return items, err
+		}
+		if source.Library != "" {
+			return items, fmt.Errorf("package source: %s, does not support library, use %s resources in the package instead", source.Package, config.YttLibraryKind)
+		}
+
+		packageItems, err := readPackage(results, source, i)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, packageItems...)
+	}
+	return items, nil
+}
+
+// readPackage reads resources of a single package source
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - source: config.YttSource with Package set
+//   - index: index of source in config.YttSources
+//
+// Returns:
+//   - []*kyaml.RNode: resources read from package
+//   - error: when package directory does not exist or cannot be read
+func readPackage(results *logger.Collector, source config.YttSource, index int) ([]*kyaml.RNode, error) {
+	packageDir := source.Package
+	if !filepath.IsAbs(packageDir) {
+		packageDir = filepath.Join(config.YttWorkDirectory, packageDir)
+	}
+	if source.Path != "" {
+		if !filepath.IsLocal(source.Path) {
+			return nil, fmt.Errorf("source path must be relative to the source root: %s", source.Path)
+		}
+		packageDir = filepath.Join(packageDir, filepath.FromSlash(source.Path))
+	}
+
+	// Referenced package has to be reachable, which in a container requires mounting it
+	if info, err := os.Stat(packageDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf(
+			"package source: %s, is not a directory: %s (mount it with --mount when running in a container)",
+			source.Package,
+			packageDir,
+		)
+	}
+
+	results.LogDebug(fmt.Sprintf("Reading package source: %s", packageDir))
+	reader := kio.LocalPackageReader{PackagePath: packageDir, PackageFileName: config.KptfileName}
+	packageItems, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("package source: %s, could not be read: %v", source.Package, err)
+	}
+
+	// Drop package metadata and move resources to their own directory
+	prefix := path.Join("packages", fmt.Sprintf("%d-%s", index, filepath.Base(packageDir)))
+	var items []*kyaml.RNode
+	for _, item := range packageItems {
+		if item.GetKind() == config.KptfileKind {
+			continue
+		}
+		annotations := item.GetAnnotations()
+		itemPath := path.Join(prefix, annotations[kioutil.PathAnnotation])
+		annotations[kioutil.PathAnnotation] = itemPath
+		annotations[kioutil.LegacyPathAnnotation] = itemPath
+		if err := item.SetAnnotations(annotations); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPackageSources(t *testing.T) {
+	// Setup sibling package on disk
+	packageDir := filepath.Join(t.TempDir(), "templates")
+	files := map[string]string{
+		"Kptfile": `
+apiVersion: kpt.dev/v1
+kind: Kptfile
+metadata:
+  name: templates
+`,
+		"amf/amf_template_day0.yaml": `
+apiVersion: apps/v1
+kind: YttTemplate
+metadata:
+  name: amf-template-day0
+ytt_template_content:
+  instances: 2
+`,
+	}
+	for name, content := range files {
+		filePath := filepath.Join(packageDir, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+			t.Fatalf("failed to create package: %v", err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to create package: %v", err)
+		}
+	}
+
+	// Test structure
+	tests := []struct {
+		name          string
+		source        config.YttSource
+		wantPaths     []string
+		expectedError string
+	}{ // Test list
+
+		// Whole package without Kptfile
+		{
+			"Test read package",
+			config.YttSource{Package: packageDir},
+			[]string{"packages/0-templates/amf/amf_template_day0.yaml"},
+			"",
+		},
+
+		// Sub directory of package
+		{
+			"Test read package path",
+			config.YttSource{Package: packageDir, Path: "amf"},
+			[]string{"packages/0-amf/amf_template_day0.yaml"},
+			"",
+		},
+
+		// Missing package
+		{
+			"Test missing package",
+			config.YttSource{Package: filepath.Join(packageDir, "missing")},
+			nil,
+			"package source: " + filepath.Join(packageDir, "missing") + ", is not a directory: " + filepath.Join(packageDir, "missing") + " (mount it with --mount when running in a container)",
+		},
+
+		// Library for package
+		{
+			"Test package as library",
+			config.YttSource{Package: packageDir, Library: "nflib"},
+			nil,
+			"package source: " + packageDir + ", does not support library, use YttLibrary resources in the package instead",
+		},
+
+		// Package and tarball
+		{
+			"Test package and tarball",
+			config.YttSource{Package: packageDir, Tarball: "bundle.tar.gz"},
+			nil,
+			"source can only define one of image, tarball or package, got: bundle.tar.gz and " + packageDir,
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.YttSources = []config.YttSource{tt.source}
+			defer func() {
+				config.YttSources = nil
+			}()
+
+			// Execute function
+			items, err := ReadPackageSources(logger.NewCollector())
+
+			// Assert error or read resources
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			if err != nil {
+				t.Fatalf("error not expected %v", err)
+			}
+			var gotPaths []string
+			for _, item := range items {
+				gotPaths = append(gotPaths, item.GetAnnotations()["config.kubernetes.io/path"])
+			}
+			assert.Equal(t, tt.wantPaths, gotPaths)
+		})
+	}
+}
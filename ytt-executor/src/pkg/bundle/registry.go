@@ -0,0 +1,242 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Manifest media types accepted when pulling images
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// pullTimeout time a single registry request, including reading its body, may take
+const pullTimeout = 5 * time.Minute
+
+// HTTP client used to pull images, bounded so a stalled registry cannot hang the render
+var httpClient = &http.Client{Timeout: pullTimeout}
+
+// imageReference parsed OCI image reference pinned by digest
+//
+// registry: registry host, e.g. registry.io:5000
+//
+// repository: repository path inside registry, e.g. nf/templates
+//
+// digest: manifest digest, e.g. sha256:...
+type imageReference struct {
+	registry   string
+	repository string
+	digest     string
+}
+
+// imageManifest subset of an OCI / docker v2 image manifest
+type imageManifest struct {
+	MediaType string `json:"mediaType"`
+	Layers    []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"layers"`
+}
+
+// parseImageReference parses <registry>/<repository>@sha256:<digest> image references
+//
+// Parameters:
+//   - image: image reference to parse
+//
+// Returns:
+//   - imageReference: parsed reference
+//   - error: when reference has no registry or is not pinned by digest
+func parseImageReference(image string) (imageReference, error) {
+	name, digest, found := strings.Cut(image, "@")
+	if !found {
+		return imageReference{}, fmt.Errorf("source image: %s, has to be pinned by digest (<image>@sha256:...)", image)
+	}
+	if err := validateDigest(digest); err != nil {
+		return imageReference{}, fmt.Errorf("source image: %s, %v", image, err)
+	}
+
+	// Tags are ignored when pinned by digest
+	if lastSlash := strings.LastIndex(name, "/"); strings.LastIndex(name, ":") > lastSlash {
+		name = name[:strings.LastIndex(name, ":")]
+	}
+
+	registry, repository, found := strings.Cut(name, "/")
+	if !found || !(strings.ContainsAny(registry, ".:") || registry == "localhost") {
+		return imageReference{}, fmt.Errorf("source image: %s, has to include a registry host", image)
+	}
+	return imageReference{registry: registry, repository: repository, digest: digest}, nil
+}
+
+// pullImage pulls manifest and layers of reference and extracts the layers into targetDir
+//
+// Parameters:
+//   - reference: imageReference to pull
+//   - insecure: use plain http instead of https
+//   - targetDir: directory to extract layers to
+//
+// Returns:
+//   - error: from pulling, verifying or extracting the image
+func pullImage(reference imageReference, insecure bool, targetDir string) error {
+	client := registryClient{reference: reference, scheme: "https"}
+	if insecure {
+		client.scheme = "http"
+	}
+
+	manifestBytes, err := client.get("manifests/"+reference.digest, strings.Join(manifestMediaTypes, ","))
+	if err != nil {
+		return err
+	}
+	var manifest imageManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return fmt.Errorf("failed to parse manifest of %s: %v", reference.digest, err)
+	}
+	if len(manifest.Layers) == 0 {
+		return fmt.Errorf("image manifest %s has no layers, image indexes are not supported", reference.digest)
+	}
+
+	for _, layer := range manifest.Layers {
+		layerBytes, err := client.get("blobs/"+layer.Digest, "")
+		if err != nil {
+			return err
+		}
+		if err := extractTar(bytes.NewReader(layerBytes), targetDir); err != nil {
+			return fmt.Errorf("failed to extract layer %s: %v", layer.Digest, err)
+		}
+	}
+	return nil
+}
+
+// registryClient minimal OCI distribution client supporting anonymous bearer token authentication
+type registryClient struct {
+	reference imageReference
+	scheme    string
+	token     string
+}
+
+// get fetches a content addressed manifest or blob and verifies its digest
+//
+// Parameters:
+//   - resource: manifests/<digest> or blobs/<digest>
+//   - accept: Accept header value, empty for none
+//
+// Returns:
+//   - []byte: verified content
+//   - error: from request, authentication or digest mismatch
+func (client *registryClient) get(resource string, accept string) ([]byte, error) {
+	resourceURL := fmt.Sprintf("%s://%s/v2/%s/%s", client.scheme, client.reference.registry, client.reference.repository, resource)
+	response, err := client.do(resourceURL, accept)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retry once with an anonymous token when registry asks for one
+	if response.StatusCode == http.StatusUnauthorized && client.token == "" {
+		challenge := response.Header.Get("WWW-Authenticate")
+		response.Body.Close()
+		if err := client.authenticate(challenge); err != nil {
+			return nil, err
+		}
+		if response, err = client.do(resourceURL, accept); err != nil {
+			return nil, err
+		}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", resourceURL, response.Status)
+	}
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Content is addressed by digest, anything else is a tampered or corrupt download
+	expected := resource[strings.Index(resource, "/")+1:]
+	if actual := sha256Digest(content); actual != expected {
+		return nil, fmt.Errorf("digest mismatch for %s, expected: %s, got: %s", resourceURL, expected, actual)
+	}
+	return content, nil
+}
+
+// do sends a GET request with optional Accept header and bearer token
+func (client *registryClient) do(resourceURL string, accept string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, resourceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	if client.token != "" {
+		request.Header.Set("Authorization", "Bearer "+client.token)
+	}
+	return httpClient.Do(request)
+}
+
+// authenticate requests an anonymous token from the realm of a Bearer WWW-Authenticate challenge
+func (client *registryClient) authenticate(challenge string) error {
+	scheme, parameters, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return fmt.Errorf("registry %s requires unsupported authentication: %s", client.reference.registry, challenge)
+	}
+
+	// Parse realm="...",service="...",scope="..."
+	values := map[string]string{}
+	for _, parameter := range strings.Split(parameters, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(parameter), "=")
+		values[key] = strings.Trim(value, `"`)
+	}
+	tokenURL, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return fmt.Errorf("registry %s returned invalid token realm: %s", client.reference.registry, challenge)
+	}
+	query := tokenURL.Query()
+	for _, key := range []string{"service", "scope"} {
+		if values[key] != "" {
+			query.Set(key, values[key])
+		}
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	response, err := httpClient.Get(tokenURL.String())
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get token for registry %s: %s", client.reference.registry, response.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return err
+	}
+	client.token = token.Token
+	if client.token == "" {
+		client.token = token.AccessToken
+	}
+	return nil
+}
@@ -16,88 +16,161 @@ package commandExec
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
+	"time"
 
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
 )
 
+// nonYamlWarning part of the warning ytt writes when it skips non-yaml templates, e.g. plain .txt templates
+const nonYamlWarning = "Non-YAML templates are not rendered to standard output"
+
+// waitDelay time given to ytt output pipes to close after the process group was killed
+const waitDelay = 5 * time.Second
+
+// InterruptedError returned when ytt was killed because ctx expired or was canceled
+//
+// Cause: context.DeadlineExceeded or context.Canceled
+//
+// Elapsed: time ytt ran before it was killed
+type InterruptedError struct {
+	Cause   error
+	Elapsed time.Duration
+}
+
+func (err *InterruptedError) Error() string {
+	if errors.Is(err.Cause, context.DeadlineExceeded) {
+		return fmt.Sprintf("ytt: timed out after %s, process group killed", err.Elapsed.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("ytt: canceled after %s, process group killed", err.Elapsed.Round(time.Millisecond))
+}
+
+func (err *InterruptedError) Unwrap() error {
+	return err.Cause
+}
+
+// Output statistics of streamed ytt output
+//
+// Bytes: size of ytt output
+//
+// Documents: number of "---" separated documents in ytt output
+type Output struct {
+	Bytes     int
+	Documents int
+}
+
 // ExecuteYttForTemplate executes ytt binary with provided arguments in current or provided WorkDirectory
+// and streams its output to consume while ytt is running
+// ytt runs in its own process group, which is killed as a whole when ctx expires, is canceled, consume fails
+// or the output exceeds config.YttMaxOutputBytes or config.YttMaxOutputDocuments
 //
 // Parameters:
+//   - ctx: context bounding ytt execution, e.g. with config.YttTimeout
+//   - results: logger.Collector of the current run
 //   - yttArgs: array of arguments used by function should consist of {"-f", "FILE_NAME",...}
+//   - consume: reads ytt output until io.EOF, e.g. process.UnmarshalYttOutput
 //
 // Returns:
-//   - bytes.Buffer: direct output of ytt binary execution
-//   - error: from getting directory or failing to execute ytt binary
-func ExecuteYttForTemplate(yttArgs []string) (output bytes.Buffer, err error) {
-	command := exec.Command(config.YttBinaryName, yttArgs...)
+//   - Output: size and document count of ytt output
+//   - error: from getting directory, consume, failing to execute ytt binary or ytt skipping non-yaml templates,
+//     *LimitError when output exceeded a limit, *InterruptedError when ctx ended first
+func ExecuteYttForTemplate(ctx context.Context, results *logger.Collector, yttArgs []string, consume func(stdout io.Reader) error) (output Output, err error) {
+	// Kill ytt as soon as its output exceeds a limit or cannot be consumed
+	killCtx, kill := context.WithCancelCause(ctx)
+	defer kill(nil)
+
+	command := exec.CommandContext(killCtx, config.YttBinaryName, yttArgs...)
+	setProcessGroup(command)
+	command.WaitDelay = waitDelay
 
 	// Define variables
-	var outputBuffer, errorBuffer bytes.Buffer
-	var workDir string
-
-	// Check config workDir for starting '/' or used current WorkDirectory
-	if len(config.YttWorkDirectory) > 0 && config.YttWorkDirectory[0] == '/' {
-		workDir = config.YttWorkDirectory
-
-	} else {
-		workDir, err = os.Getwd()
-		if err != nil {
-			return outputBuffer, err
-		}
-		workDir = config.YttWorkDirectory + workDir
+	var errorBuffer bytes.Buffer
+	workDir, err := workDirectory()
+	if err != nil {
+		return output, err
 	}
 
 	// Set command directory, Stdout and Stderr
 	command.Dir = workDir
-	command.Stdout = &outputBuffer
 	command.Stderr = &errorBuffer
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return output, err
+	}
+	limiter := newOutputLimiter(stdout, config.YttMaxOutputBytes, config.YttMaxOutputDocuments, kill)
 
 	// Debug details
-	logger.LogDetailedDebug("Executing ytt binary", map[string]string{
+	results.LogDetailedDebug("Executing ytt binary", map[string]string{
 		"ytt_bin_name": config.YttBinaryName,
 		"work_dir":     workDir,
 		"args":         fmt.Sprintf("%+v", yttArgs),
 	})
 
-	// Execute command
-	err = command.Run()
+	// Execute command, consuming output as it is written
+	started := time.Now()
+	if err := command.Start(); err != nil {
+		return output, fmt.Errorf("ytt: %s (stderr: %s)", err, errorBuffer.String())
+	}
+	consumeErr := consume(limiter)
+	if consumeErr != nil {
+		kill(consumeErr)
+	} else {
+		// Drain anything consume left unread so ytt can exit
+		_, _ = io.Copy(io.Discard, limiter)
+	}
+	err = command.Wait()
+	output = Output{Bytes: limiter.bytes, Documents: limiter.documents}
+
+	// Report killed ytt separately from ytt errors
+	var limitErr *LimitError
+	if errors.As(context.Cause(killCtx), &limitErr) {
+		results.LogDetailedError(limitErr.Error(), map[string]string{
+			"limit": limitErr.Limit,
+			"max":   strconv.Itoa(limitErr.Max),
+		})
+		return output, limitErr
+	}
+	if ctx.Err() != nil {
+		return output, &InterruptedError{Cause: ctx.Err(), Elapsed: time.Since(started)}
+	}
+	if consumeErr != nil {
+		return output, consumeErr
+	}
 
 	// Throw error back for better feedback
 	if err != nil {
-		return errorBuffer, fmt.Errorf(
+		return output, fmt.Errorf(
 			"ytt: %s (stderr: %s)",
 			err,
 			errorBuffer.String(),
 		)
 	}
 
-	// Return outputBuffer
-	return outputBuffer, err
+	// Skipped non-yaml templates would leave outputs silently incomplete
+	if bytes.Contains(errorBuffer.Bytes(), []byte(nonYamlWarning)) {
+		return output, fmt.Errorf(
+			"ytt: non-yaml templates are not rendered to standard output, render text from a yaml template instead (stderr: %s)",
+			errorBuffer.String(),
+		)
+	}
+	return output, nil
 }
 
-// CatFile reads files
-func CatFile(fileName string) string {
-	command := exec.Command("cat", fileName)
-
-	// Define variables
-	var outputBuffer bytes.Buffer
-	var workDir string
-
-	// Check config workDir for starting '/' or used current WorkDirectory
+// workDirectory returns config.YttWorkDirectory when it starts with '/', otherwise it is prefixed to the current directory
+func workDirectory() (string, error) {
 	if len(config.YttWorkDirectory) > 0 && config.YttWorkDirectory[0] == '/' {
-		workDir = config.YttWorkDirectory
-	} else {
-		workDir, _ = os.Getwd()
-		workDir = config.YttWorkDirectory + workDir
+		return config.YttWorkDirectory, nil
 	}
-
-	command.Dir = workDir
-	command.Stdout = &outputBuffer
-
-	_ = command.Run()
-	return outputBuffer.String()
+	workDir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return config.YttWorkDirectory + workDir, nil
 }
@@ -16,35 +16,23 @@ package commandExec
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestCatFile(t *testing.T) {
-
-	// Coverage test for CatFile for custom root based directory
-	t.Run("Test workDir='/' and nonexistent_file.txt", func(t *testing.T) {
-		config.YttWorkDirectory = "/"
-		output := CatFile("nonexistent_file.txt")
-		assert.Equal(t, "", output)
-	})
-
-	// Coverage test for CatFile for get os.pwd() coverage
-	t.Run("Test with nonexistent_file.txt", func(t *testing.T) {
-		config.YttWorkDirectory = ""
-		output := CatFile("nonexistent_file.txt")
-		assert.Equal(t, "", output)
-	})
-}
-
 func TestExecuteYttForTemplate(t *testing.T) {
 	// Test structure
 	tests := []struct {
 		name        string
 		args        []string
-		wantOutput  *bytes.Buffer
+		wantOutput  string
 		wantErr     bool
 		preTestFunc func()
 	}{ // Test list
@@ -53,7 +41,7 @@ func TestExecuteYttForTemplate(t *testing.T) {
 		{
 			"Test ExecuteYttForTemplate with workDir='/' and echo hello",
 			[]string{"hello"},
-			bytes.NewBufferString("hello\n"),
+			"hello\n",
 			false,
 			func() {
 				config.YttBinaryName = "echo"
@@ -65,7 +53,7 @@ func TestExecuteYttForTemplate(t *testing.T) {
 		{
 			"Test ExecuteYttForTemplate with echo hello again",
 			[]string{"hello", "again"},
-			bytes.NewBufferString("hello again\n"),
+			"hello again\n",
 			false,
 			func() {
 				config.YttWorkDirectory = ""
@@ -77,7 +65,7 @@ func TestExecuteYttForTemplate(t *testing.T) {
 		{
 			"Test ExecuteYttForTemplate to fail using ls non_existent_dir",
 			[]string{"non_existent_dir"},
-			bytes.NewBufferString("ls: cannot access 'non_existent_dir': No such file or directory\n"),
+			"",
 			true,
 			func() {
 				config.YttBinaryName = "ls"
@@ -88,12 +76,23 @@ func TestExecuteYttForTemplate(t *testing.T) {
 		{
 			"Test ExecuteYttForTemplate to fail using invalid binary",
 			[]string{},
-			&bytes.Buffer{},
+			"",
 			true,
 			func() {
 				config.YttBinaryName = "ytt2"
 			},
 		},
+
+		// Non-yaml templates ytt skipped fail the run, even though ytt succeeded
+		{
+			"Test ExecuteYttForTemplate to fail on skipped non-yaml templates",
+			[]string{"-c", "echo 'Non-YAML templates are not rendered to standard output.' >&2; echo 'a: 1'"},
+			"a: 1\n",
+			true,
+			func() {
+				config.YttBinaryName = "sh"
+			},
+		},
 	}
 
 	// Loop through test cases
@@ -105,7 +104,11 @@ func TestExecuteYttForTemplate(t *testing.T) {
 			}
 
 			// Execute function
-			output, err := ExecuteYttForTemplate(tt.args)
+			var consumed bytes.Buffer
+			output, err := ExecuteYttForTemplate(context.Background(), logger.NewCollector(), tt.args, func(stdout io.Reader) error {
+				_, err := consumed.ReadFrom(stdout)
+				return err
+			})
 
 			// Check if error received and not expected
 			if err != nil && !tt.wantErr {
@@ -117,7 +120,99 @@ func TestExecuteYttForTemplate(t *testing.T) {
 			}
 
 			// Assert response
-			assert.Equal(t, tt.wantOutput, &output)
+			assert.Equal(t, tt.wantOutput, consumed.String())
+			assert.Equal(t, len(tt.wantOutput), output.Bytes)
+		})
+	}
+}
+
+func TestExecuteYttForTemplateInterrupted(t *testing.T) {
+	// Shell stand-in spawning a child that keeps the output pipe open
+	config.YttBinaryName = "sh"
+	config.YttWorkDirectory = ""
+	defer func() {
+		config.YttBinaryName = "ytt"
+	}()
+
+	// Test structure
+	tests := []struct {
+		name          string
+		cancelAfter   func(context.Context) (context.Context, context.CancelFunc)
+		expectedCause error
+		expectedError string
+	}{ // Test list
+
+		// Deadline expires
+		{
+			"Test timeout kills process group",
+			func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return context.WithTimeout(ctx, 100*time.Millisecond)
+			},
+			context.DeadlineExceeded,
+			"ytt: timed out after",
+		},
+
+		// Canceled, e.g. on interrupt
+		{
+			"Test cancel kills process group",
+			func(ctx context.Context) (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(ctx)
+				time.AfterFunc(100*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			context.Canceled,
+			"ytt: canceled after",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.cancelAfter(context.Background())
+			defer cancel()
+
+			// Execute function
+			started := time.Now()
+			_, err := ExecuteYttForTemplate(ctx, logger.NewCollector(), []string{"-c", "sleep 10 & wait"}, drain)
+
+			// Child is killed with the group instead of waiting for the pipe delay
+			assert.Less(t, time.Since(started), waitDelay)
+			var interrupted *InterruptedError
+			if !errors.As(err, &interrupted) {
+				t.Fatalf("InterruptedError expected, got: %v", err)
+			}
+			assert.ErrorIs(t, err, tt.expectedCause)
+			assert.Contains(t, err.Error(), tt.expectedError)
+			assert.GreaterOrEqual(t, interrupted.Elapsed, 100*time.Millisecond)
 		})
 	}
 }
+
+func TestExecuteYttForTemplateConsumeError(t *testing.T) {
+	// Endless output stand-in
+	config.YttBinaryName = "yes"
+	config.YttWorkDirectory = ""
+	defer func() {
+		config.YttBinaryName = "ytt"
+	}()
+
+	// Execute function with a consumer failing on first read
+	started := time.Now()
+	_, err := ExecuteYttForTemplate(context.Background(), logger.NewCollector(), []string{"a: 1"}, func(stdout io.Reader) error {
+		_, err := stdout.Read(make([]byte, 16))
+		if err != nil {
+			return err
+		}
+		return errors.New("failed to parse ytt output")
+	})
+
+	// Ytt is killed and the consumer error returned
+	assert.Less(t, time.Since(started), waitDelay)
+	assert.EqualError(t, err, "failed to parse ytt output")
+}
+
+// drain consumes ytt output without processing it
+func drain(stdout io.Reader) error {
+	_, err := io.Copy(io.Discard, stdout)
+	return err
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commandExec
+
+import (
+	"fmt"
+	"io"
+)
+
+// LimitError returned when ytt output exceeds a configured limit
+//
+// Limit: name of the exceeded limit, e.g. max_output_bytes
+//
+// Max: configured maximum
+type LimitError struct {
+	Limit string
+	Max   int
+}
+
+func (err *LimitError) Error() string {
+	return fmt.Sprintf("ytt output exceeds limit %s: %d, ytt was killed", err.Limit, err.Max)
+}
+
+// outputLimiter reads ytt stdout while enforcing size and document count limits as it streams in
+//
+// reader: ytt stdout
+//
+// maxBytes: maximum output size, 0 for unlimited
+//
+// maxDocuments: maximum number of "---" separated documents, 0 for unlimited
+//
+// exceeded: called once with the LimitError when a limit is exceeded, e.g. to kill ytt
+type outputLimiter struct {
+	reader       io.Reader
+	maxBytes     int
+	maxDocuments int
+	exceeded     func(error)
+
+	bytes     int
+	documents int
+	dashes    int
+	lineStart bool
+	err       error
+}
+
+// newOutputLimiter creates an outputLimiter, see outputLimiter for parameters
+func newOutputLimiter(reader io.Reader, maxBytes int, maxDocuments int, exceeded func(error)) *outputLimiter {
+	return &outputLimiter{reader: reader, maxBytes: maxBytes, maxDocuments: maxDocuments, exceeded: exceeded, lineStart: true}
+}
+
+// Read reads from reader unless a limit is exceeded, afterwards every read fails
+func (limiter *outputLimiter) Read(p []byte) (int, error) {
+	if limiter.err != nil {
+		return 0, limiter.err
+	}
+	n, err := limiter.reader.Read(p)
+	limiter.bytes += n
+	if limiter.maxBytes > 0 && limiter.bytes > limiter.maxBytes {
+		return 0, limiter.fail(&LimitError{Limit: "max_output_bytes", Max: limiter.maxBytes})
+	}
+
+	// Count documents by separator lines, a separator may be split across reads
+	if limiter.documents == 0 && n > 0 {
+		limiter.documents = 1
+	}
+	for _, b := range p[:n] {
+		switch {
+		case b == '\n':
+			limiter.lineStart, limiter.dashes = true, 0
+		case limiter.lineStart && b == '-':
+			limiter.dashes++
+			if limiter.dashes == 3 {
+				limiter.documents++
+				limiter.lineStart = false
+			}
+		default:
+			limiter.lineStart = false
+		}
+	}
+	if limiter.maxDocuments > 0 && limiter.documents > limiter.maxDocuments {
+		return 0, limiter.fail(&LimitError{Limit: "max_documents", Max: limiter.maxDocuments})
+	}
+	return n, err
+}
+
+// fail stores err for later writes and reports it through exceeded
+func (limiter *outputLimiter) fail(err error) error {
+	limiter.err = err
+	if limiter.exceeded != nil {
+		limiter.exceeded(err)
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commandExec
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputLimiter(t *testing.T) {
+	// Test structure
+	tests := []struct {
+		name          string
+		maxBytes      int
+		maxDocuments  int
+		reads         []string
+		expectedError string
+	}{ // Test list
+
+		// Within limits
+		{
+			"Test output within limits",
+			20,
+			2,
+			[]string{"a: 1\n---\n", "b: 2\n"},
+			"",
+		},
+
+		// Size exceeded
+		{
+			"Test output exceeding max_output_bytes",
+			10,
+			0,
+			[]string{"a: 1\n---\n", "b: 2\n"},
+			"ytt output exceeds limit max_output_bytes: 10, ytt was killed",
+		},
+
+		// Separator split across reads, indented dashes ignored
+		{
+			"Test output exceeding max_documents",
+			0,
+			2,
+			[]string{"a: |\n  ---\n-", "--\nb: 2\n--", "-\nc: 3\n"},
+			"ytt output exceeds limit max_documents: 2, ytt was killed",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var exceeded error
+			var readers []io.Reader
+			for _, read := range tt.reads {
+				readers = append(readers, strings.NewReader(read))
+			}
+			limiter := newOutputLimiter(io.MultiReader(readers...), tt.maxBytes, tt.maxDocuments, func(err error) {
+				exceeded = err
+			})
+			_, err := io.ReadAll(limiter)
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Nil(t, exceeded)
+				return
+			}
+			assert.EqualError(t, err, tt.expectedError)
+			assert.Equal(t, err, exceeded)
+		})
+	}
+}
+
+func TestExecuteYttForTemplateOutputLimit(t *testing.T) {
+	// Endless output stand-in with small output limit
+	config.YttBinaryName = "yes"
+	config.YttWorkDirectory = ""
+	config.YttMaxOutputBytes = 1 << 16
+	defer func() {
+		config.YttBinaryName = "ytt"
+		config.YttMaxOutputBytes = 256 << 20
+	}()
+
+	// Execute function
+	results := logger.NewCollector()
+	started := time.Now()
+	_, err := ExecuteYttForTemplate(context.Background(), results, []string{"a: 1"}, drain)
+
+	// Ytt is killed with a limit error result
+	assert.Less(t, time.Since(started), waitDelay)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("LimitError expected, got: %v", err)
+	}
+	assert.Equal(t, "max_output_bytes", limitErr.Limit)
+	assert.Equal(t, "ytt output exceeds limit max_output_bytes: 65536, ytt was killed", results.Results[0].Message)
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commandExec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+)
+
+// versionProbeTimeout time `ytt version` may run before it is killed
+const versionProbeTimeout = 10 * time.Second
+
+// versionPattern matches the version printed by `ytt version`, e.g. "ytt version 0.50.0"
+var versionPattern = regexp.MustCompile(`v?\d+\.\d+\.\d+`)
+
+// ResolveYttBinary resolves config.YttBinaryName to an absolute path and probes its version with `ytt version`
+// Bare names are looked up on PATH, relative paths are resolved against the work directory
+// When config.YttVersion is set, the probed version must satisfy it, otherwise an unknown version is only a warning
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//
+// Returns:
+//   - string: absolute path of the ytt binary
+//   - error: when the binary is not found, or its version is unknown or does not satisfy config.YttVersion
+func ResolveYttBinary(results *logger.Collector) (string, error) {
+	// Resolve binary the way it would be executed
+	binary := config.YttBinaryName
+	if strings.ContainsRune(binary, filepath.Separator) && !filepath.IsAbs(binary) {
+		workDir, err := workDirectory()
+		if err != nil {
+			return "", err
+		}
+		binary = filepath.Join(workDir, binary)
+	}
+	binary, err := exec.LookPath(binary)
+	if err != nil {
+		return "", fmt.Errorf("ytt binary %s not found: %v", config.YttBinaryName, err)
+	}
+	binary, err = filepath.Abs(binary)
+	if err != nil {
+		return "", err
+	}
+
+	// Probe version, only required to be known when constrained
+	version, err := probeYttVersion(binary)
+	if err != nil {
+		if config.YttVersion != nil {
+			results.LogDetailedError("Unable to determine ytt version", map[string]string{
+				"binary":           binary,
+				"required_version": config.YttVersion.String(),
+				"error":            err.Error(),
+			})
+			return "", fmt.Errorf("ytt: unable to determine version of %s, required version %s: %v", binary, config.YttVersion, err)
+		}
+		results.LogDetailedWarning("Unable to determine ytt version", map[string]string{
+			"binary": binary,
+			"error":  err.Error(),
+		})
+		return binary, nil
+	}
+	results.LogDetailedDebug("Resolved ytt binary", map[string]string{
+		"binary":  binary,
+		"version": version,
+	})
+
+	// Compare found and required version
+	if config.YttVersion == nil {
+		return binary, nil
+	}
+	parsed, err := config.ParseYttVersion(version)
+	if err != nil {
+		return "", err
+	}
+	if !config.YttVersion.SatisfiedBy(parsed) {
+		results.LogDetailedError(fmt.Sprintf("Found ytt version %s, required version %s", version, config.YttVersion), map[string]string{
+			"binary":           binary,
+			"found_version":    version,
+			"required_version": config.YttVersion.String(),
+		})
+		return "", fmt.Errorf("ytt: found version %s at %s, required version %s", version, binary, config.YttVersion)
+	}
+	return binary, nil
+}
+
+// probeYttVersion runs `ytt version` and returns the first version it prints
+//
+// Parameters:
+//   - binary: path of the ytt binary
+//
+// Returns:
+//   - string: version, e.g. 0.50.0
+//   - error: when ytt fails or prints no version
+func probeYttVersion(binary string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+
+	// Execute version subcommand in its own process group
+	command := exec.CommandContext(ctx, binary, "version")
+	setProcessGroup(command)
+	command.WaitDelay = waitDelay
+	var outputBuffer, errorBuffer bytes.Buffer
+	command.Stdout = &outputBuffer
+	command.Stderr = &errorBuffer
+	if err := command.Run(); err != nil {
+		return "", fmt.Errorf("%s version: %s (stderr: %s)", filepath.Base(binary), err, strings.TrimSpace(errorBuffer.String()))
+	}
+
+	version := versionPattern.FindString(outputBuffer.String())
+	if version == "" {
+		return "", fmt.Errorf("%s version: no version in output: %s", filepath.Base(binary), strings.TrimSpace(outputBuffer.String()))
+	}
+	return strings.TrimPrefix(version, "v"), nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commandExec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveYttBinary(t *testing.T) {
+	// Stand-in binary reporting a fixed version
+	binDir := t.TempDir()
+	fakeYtt := filepath.Join(binDir, "ytt")
+	err := os.WriteFile(fakeYtt, []byte("#!/bin/sh\necho \"ytt version 0.50.0\"\n"), 0o755)
+	if err != nil {
+		t.Fatalf("failed to write stand-in binary: %v", err)
+	}
+	config.YttWorkDirectory = ""
+	defer func() {
+		config.YttBinaryName = "ytt"
+		config.YttVersion = nil
+	}()
+
+	// Test structure
+	tests := []struct {
+		name            string
+		binaryName      string
+		constraint      string
+		expectedBinary  string
+		expectedError   string
+		expectedMessage string
+	}{ // Test list
+
+		// Found on PATH
+		{
+			"Test resolve binary on PATH",
+			"ytt",
+			"",
+			fakeYtt,
+			"",
+			"",
+		},
+
+		// Absolute path with satisfied minimum version
+		{
+			"Test resolve absolute path with minimum version",
+			fakeYtt,
+			">=0.44.0",
+			fakeYtt,
+			"",
+			"",
+		},
+
+		// Required version differs
+		{
+			"Test fail on required version",
+			fakeYtt,
+			"0.49.0",
+			"",
+			"ytt: found version 0.50.0 at " + fakeYtt + ", required version 0.49.0",
+			"Found ytt version 0.50.0, required version 0.49.0",
+		},
+
+		// Binary without version output is accepted with a warning
+		{
+			"Test warn on unknown version",
+			"echo",
+			"",
+			"",
+			"",
+			"Unable to determine ytt version",
+		},
+
+		// Binary without version output fails a constraint
+		{
+			"Test fail on unknown version with constraint",
+			"echo",
+			">=0.44.0",
+			"",
+			"ytt: unable to determine version of",
+			"Unable to determine ytt version",
+		},
+
+		// Binary not found
+		{
+			"Test fail on missing binary",
+			"ytt2",
+			"",
+			"",
+			"ytt binary ytt2 not found: exec: \"ytt2\": executable file not found in $PATH",
+			"",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+			config.YttBinaryName = tt.binaryName
+			config.YttVersion = nil
+			if tt.constraint != "" {
+				config.YttVersion, _ = config.ParseYttVersionConstraint(tt.constraint)
+			}
+
+			// Execute function
+			results := logger.NewCollector()
+			binary, err := ResolveYttBinary(results)
+
+			// Assert response
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+			} else if err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			if tt.expectedBinary != "" {
+				assert.Equal(t, tt.expectedBinary, binary)
+			}
+			if tt.expectedMessage != "" {
+				assert.Equal(t, tt.expectedMessage, results.Results[len(results.Results)-1].Message)
+			}
+		})
+	}
+}
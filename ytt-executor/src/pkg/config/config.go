@@ -16,6 +16,15 @@
 package config
 
 import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/expression"
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
 	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
 )
@@ -23,33 +32,251 @@ import (
 // Default variables used in defining ytt strip-down functionality
 // To be overridden by values provided in fnConfig using Configure
 var (
+	YttMode                    = ModeRender             // YttModeIdentifier Enumerator to identify whether outputs are rendered or tests run
 	YttWorkDirectory           = ""                     // Directory to write ytt input files to (probably not needed)
-	YttBinaryName              = "ytt"                  // Ytt binary name
+	YttBinaryName              = "ytt"                  // Ytt binary name, absolute path or looked up on PATH
+	YttVersion                 *YttVersionConstraint    // Version the ytt binary must report, nil to accept any version
+	YttTimeout                 = 10 * time.Minute       // Time ytt may run before its process group is killed, 0 to disable
 	YttInputValuesFileHandling = ValuesIdentifierKind   // YttValuesIdentifier Enumerator to identify data-value-file handling
 	YttInputValueFileKind      = "YttDataValues"        // Kind value to identify data-value-file
+	YttValuesSelector          *YttSelector             // Selector of data-value-files, replaces YttInputValueFileKind when set
+	YttTemplateSelector        *YttSelector             // Selector of templates, nil to pass all other resources as templates
+	YttSchemaSelector          *YttSelector             // Selector of schemas, passed as templates even when not selected as such
 	YttNodeAnnotations         = "ytt_header"           // Yaml key to identify ytt annotation element
 	YttNodeContent             = "ytt_template_content" // Yaml key to identify ytt content
+	YttNodeFileName            = "ytt_file_name"        // Yaml key to identify file name given to ytt
+	YttNodeFileType            = "ytt_file_type"        // Yaml key to identify ytt file type
+	YttNodeLibraryName         = "ytt_library"          // Yaml key to identify library a library file belongs to
+	YttLibraryKind             = "YttLibrary"           // Kind value to identify library file
+	YttRenderTestKind          = "YttRenderTest"        // Kind value to identify render test resources, never passed to ytt
+	YttLibraries               []string                 // Libraries made available to ytt, nil for all libraries
+	YttSources                 []YttSource              // Templates and libraries fetched from outside the package
+	YttSourceCacheDir          = ""                     // Directory to cache fetched sources in, empty to disable caching
+	YttSecretValues            []YttSecretValue         // v1 Secrets of the package bound as data values
+	YttInlineValues            *kyaml.RNode             // Data values given in the function config, nil for none
 	YttOutputFileHandling      = OutputFileKind         // YttOutputFileIdentifier Enumerator to identify ytt-output file handling
 	YttOutputFileKind          = "Configuration"        //
+	YttOutputSelector          *YttSelector             // Selector of output resources, replaces YttOutputFileKind when set
 	YttOutputElementKey        = "data"                 // Element key under which YTT output should be under
+	YttOutputDataKey           = ""                     // Key under YttOutputElementKey to write serialized ytt output to
+	YttOutputFormat            = OutputFormatYaml       // YttOutputFormatIdentifier Enumerator to identify ytt-output serialization
+	YttSecretFields            []YttSecretField         // Ytt output fields written to v1 Secrets instead of output resources
+	YttOutputValidateSchema    = false                  // Validate ytt output documents that are resources against OpenAPI schemas
+	YttValidations             []YttValidation          // CEL rules every ytt output document must satisfy before it is written
+	YttConsistencyRules        []YttConsistencyRule     // Rules fields of several package resources, e.g. CIQs, must satisfy together
+	YttMaxOutputBytes          = 256 << 20              // Maximum size of ytt output, 0 for unlimited
+	YttMaxOutputDocuments      = 10000                  // Maximum number of ytt output documents, 0 for unlimited
+	YttMaxDepth                = 100                    // Maximum nesting depth of a ytt output document, 0 for unlimited
+	YttMetricsFile             = ""                     // File to write render statistics to in Prometheus text format, empty to disable
+	YttDebugBundle             = ""                     // Tarball capturing ytt inputs and output, "resource" for a RenderDebugBundle, empty to disable
+	YttRedactKeyPatterns       = []string{              // Patterns of keys whose values are masked in logs and results
+		"(?i)(password|passwd|secret|token|private_?key|credential)",
+	}
+)
+
+// Kpt package metadata identifiers, Kptfiles are never passed to ytt
+const (
+	KptfileName = "Kptfile" // File name of kpt package metadata
+	KptfileKind = "Kptfile" // Kind of kpt package metadata
 )
 
+// defaultRestorers restore default variables to their values at package initialization
+var defaultRestorers = []func(){
+	restorer(&YttMode),
+	restorer(&YttWorkDirectory),
+	restorer(&YttBinaryName),
+	restorer(&YttVersion),
+	restorer(&YttTimeout),
+	restorer(&YttInputValuesFileHandling),
+	restorer(&YttInputValueFileKind),
+	restorer(&YttValuesSelector),
+	restorer(&YttTemplateSelector),
+	restorer(&YttSchemaSelector),
+	restorer(&YttNodeAnnotations),
+	restorer(&YttNodeContent),
+	restorer(&YttNodeFileName),
+	restorer(&YttNodeFileType),
+	restorer(&YttNodeLibraryName),
+	restorer(&YttLibraryKind),
+	restorer(&YttRenderTestKind),
+	restorer(&YttLibraries),
+	restorer(&YttSources),
+	restorer(&YttSourceCacheDir),
+	restorer(&YttSecretValues),
+	restorer(&YttInlineValues),
+	restorer(&YttOutputFileHandling),
+	restorer(&YttOutputFileKind),
+	restorer(&YttOutputSelector),
+	restorer(&YttOutputElementKey),
+	restorer(&YttOutputDataKey),
+	restorer(&YttOutputFormat),
+	restorer(&YttSecretFields),
+	restorer(&YttOutputValidateSchema),
+	restorer(&YttValidations),
+	restorer(&YttConsistencyRules),
+	restorer(&YttMaxOutputBytes),
+	restorer(&YttMaxOutputDocuments),
+	restorer(&YttMaxDepth),
+	restorer(&YttMetricsFile),
+	restorer(&YttDebugBundle),
+	restorer(&YttRedactKeyPatterns),
+}
+
+// restorer captures the current value of variable and returns a function restoring it
+func restorer[T any](variable *T) func() {
+	value := *variable
+	return func() { *variable = value }
+}
+
+// Reset restores default variables overridden by Configure, so several function configs can be rendered
+// one after another in a single process
+func Reset() {
+	for _, restore := range defaultRestorers {
+		restore()
+	}
+}
+
 // Variables used by Package config to identify fnConfig fields to read when
 // overriding default variables
 var (
-	configInputRootKey          = "input"          // Root node for input configuration
-	configInputYttAnnotationKey = "ytt_header"     // Key used to identify ytt annotation element
-	configInputYttContentKey    = "ytt_content"    // Key used to identify ytt content element
-	configInputYttCiqIdentifier = "ciq_identifier" // Key used to identify ytt data-values-file identifier
-	configOutputRootKey         = "output"         // Root node for output configuration
-	configOutputKindKey         = "kind"           // Key used to identify output kind
-	configOutputElementKey      = "output_key"     // Key used to identify output element key
-	configDebugRootKey          = "debug"          // Root node for handling debug parameters
-	configDebugWorkDirOverride  = "work_dir"       // Key used for overriding work directory
-	configDebugYttBinOverride   = "bin_name"       // Key used for overriding binary name
-	configDebugLogLevel         = "log_level"      // Key used for changing log level
+	configModeKey               = "mode"               // Key used to identify function mode
+	configInputRootKey          = "input"              // Root node for input configuration
+	configInputYttAnnotationKey = "ytt_header"         // Key used to identify ytt annotation element
+	configInputYttContentKey    = "ytt_content"        // Key used to identify ytt content element
+	configInputYttCiqIdentifier = "ciq_identifier"     // Key used to identify ytt data-values-file identifier
+	configInputYttFileNameKey   = "ytt_file_name"      // Key used to identify ytt file name element
+	configInputYttFileTypeKey   = "ytt_file_type"      // Key used to identify ytt file type element
+	configInputYttLibraryKey    = "ytt_library"        // Key used to identify ytt library name element
+	configInputLibIdentifier    = "library_identifier" // Key used to identify ytt library file identifier
+	configInputLibraries        = "libraries"          // Key used to list libraries made available to ytt
+	configInputSources          = "sources"            // Key used to list templates and libraries fetched from outside the package
+	configInputSourceCacheDir   = "source_cache_dir"   // Key used to identify fetched sources cache directory
+	configInputSecretValues     = "secret_values"      // Key used to list Secrets bound as data values
+	configInputCiqSelector      = "ciq_selector"       // Key used to select data-value-files
+	configInputTemplateSelector = "template_selector"  // Key used to select templates
+	configInputSchemaSelector   = "schema_selector"    // Key used to select schemas
+	configValuesRootKey         = "values"             // Root node for inline data values
+	configOutputRootKey         = "output"             // Root node for output configuration
+	configOutputKindKey         = "kind"               // Key used to identify output kind
+	configOutputSelector        = "selector"           // Key used to select output resources
+	configOutputElementKey      = "output_key"         // Key used to identify output element key
+	configOutputDataKey         = "data_key"           // Key used to identify serialized output data key
+	configOutputFormatKey       = "format"             // Key used to identify output serialization format
+	configOutputSecretFields    = "secret_fields"      // Key used to list output fields written to Secrets
+	configOutputValidateSchema  = "validate_schema"    // Key used to enable OpenAPI schema validation of output documents
+	configValidationsKey        = "validations"        // Key used to list CEL rules of ytt output documents
+	configConsistencyKey        = "consistency"        // Key used to list consistency rules of package resources
+	configLimitsRootKey         = "limits"             // Root node for rendering limits
+	configLimitsOutputBytes     = "max_output_bytes"   // Key used for changing maximum ytt output size
+	configLimitsOutputDocuments = "max_documents"      // Key used for changing maximum ytt output document count
+	configLimitsDepth           = "max_depth"          // Key used for changing maximum ytt output document depth
+	configDebugRootKey          = "debug"              // Root node for handling debug parameters
+	configDebugWorkDirOverride  = "work_dir"           // Key used for overriding work directory
+	configDebugYttBinOverride   = "bin_name"           // Key used for overriding binary name
+	configDebugYttVersion       = "ytt_version"        // Key used for constraining ytt binary version
+	configDebugLogLevel         = "log_level"          // Key used for changing log level
+	configDebugTimeout          = "timeout"            // Key used for changing ytt execution timeout
+	configDebugStderrLogLevel   = "stderr_log_level"   // Key used for enabling structured stderr logs at given level
+	configDebugStderrLogFormat  = "stderr_log_format"  // Key used for changing structured stderr log format
+	configDebugRedactKeys       = "redact_keys"        // Key used to list patterns of keys masked in logs and results
+	configDebugMetricsFile      = "metrics_file"       // Key used to identify render statistics file
+	configDebugBundle           = "bundle"             // Key used to identify debug bundle tarball or resource
 )
 
+// YttSource describes templates or libraries fetched from an OCI image, local tarball or other kpt package
+//
+// Image: OCI image or imgpkg bundle reference pinned by digest, e.g. registry.io/templates@sha256:...
+//
+// Tarball: local tar or tar.gz path, relative to the work directory
+//
+// Package: kpt package directory whose resources are read like package resources, relative to the work directory
+//
+// Digest: expected sha256 digest of Tarball, e.g. sha256:...
+//
+// Path: directory inside the source to use, the whole source when empty
+//
+// Library: library to place source files under, the root ytt file set when empty, not supported for Package
+//
+// Insecure: pull Image over plain http
+type YttSource struct {
+	Image    string `yaml:"image,omitempty"`
+	Tarball  string `yaml:"tarball,omitempty"`
+	Package  string `yaml:"package,omitempty"`
+	Digest   string `yaml:"digest,omitempty"`
+	Path     string `yaml:"path,omitempty"`
+	Library  string `yaml:"library,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty"`
+}
+
+// IsValidLibraryName checks whether name can be used as a ytt library directory under _ytt_lib,
+// it has to be a local path without separators or ytt load() syntax
+func IsValidLibraryName(name string) bool {
+	return filepath.IsLocal(name) && !strings.ContainsAny(name, "/\\:@")
+}
+
+// YttSecretValue binds the decoded data of a v1 Secret in the package as ytt data values
+//
+// Name: name of the Secret
+//
+// Path: dotted data values path to place Secret keys under, the data values root when empty
+type YttSecretValue struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path,omitempty"`
+}
+
+// YttSecretField moves a field of ytt output into a v1 Secret in the package
+//
+// Path: dotted path of the field in each ytt output document
+//
+// Secret: name of the Secret to write the field to
+//
+// Key: key in Secret data, last segment of Path when empty
+type YttSecretField struct {
+	Path   string `yaml:"path"`
+	Secret string `yaml:"secret"`
+	Key    string `yaml:"key,omitempty"`
+}
+
+// YttValidation a CEL rule every ytt output document must satisfy before it is written
+//
+// Expression: CEL expression evaluating to true for valid documents, the document is self,
+// e.g. self.amf.replicas <= 4
+//
+// Message: reported when the rule fails, the expression when empty
+//
+// Output: name of the output resource whose documents are validated, every output when empty
+//
+// Program: compiled Expression
+type YttValidation struct {
+	Expression string              `yaml:"expression"`
+	Message    string              `yaml:"message,omitempty"`
+	Output     string              `yaml:"output,omitempty"`
+	Program    *expression.Program `yaml:"-"`
+}
+
+// YttConsistencyRule a rule fields of several package resources must satisfy together, e.g. CIQs of NFs sharing a site
+//
+// Name: name of the rule, reported with its violations
+//
+// Resources: variable names and the selector of the single resource each variable is bound to, the variable holds
+// the content of the resource under YttNodeContent, or the whole resource when it has no content
+//
+// Equal: paths of fields that must be equal in all resources, e.g. plmn.mcc
+//
+// Expression: CEL expression over the variables that must be true, e.g. amf.tac in site.tacs
+//
+// Message: reported when the rule is violated, a description of the violation when empty
+//
+// Program: compiled Expression, nil without Expression
+type YttConsistencyRule struct {
+	Name       string                  `yaml:"name"`
+	Resources  map[string]*YttSelector `yaml:"resources"`
+	Equal      []string                `yaml:"equal,omitempty"`
+	Expression string                  `yaml:"expression,omitempty"`
+	Message    string                  `yaml:"message,omitempty"`
+	Program    *expression.Program     `yaml:"-"`
+}
+
 // YttValuesIdentifier enumerator for identifying value-files handling
 //
 // ValuesIdentifierNone: do not identify value-files manually
@@ -73,11 +300,170 @@ const (
 	OutputFileKind YttOutputFileIdentifier = iota
 )
 
+// YttOutputFormatIdentifier enumerator to identify how ytt output is written to the output file
+//
+// OutputFormatYaml: write ytt output as yaml, or as a yaml string when YttOutputDataKey is set
+//
+// OutputFormatText: write ytt output as plain text, scalar documents are written verbatim
+//
+// OutputFormatJson: serialize ytt output to a json string
+//
+// OutputFormatToml: serialize ytt output to a toml string
+//
+// OutputFormatProperties: serialize ytt output to a flattened key=value properties string
+type YttOutputFormatIdentifier int
+
+const (
+	OutputFormatYaml YttOutputFormatIdentifier = iota
+	OutputFormatText
+	OutputFormatJson
+	OutputFormatToml
+	OutputFormatProperties
+)
+
+// OutputFormatStrings YttOutputFormatIdentifier enum as a string representation
+var OutputFormatStrings = []string{"yaml", "text", "json", "toml", "properties"}
+
+// String returns string representation of YttOutputFormatIdentifier
+func (format YttOutputFormatIdentifier) String() string {
+	return OutputFormatStrings[format]
+}
+
+// ParseOutputFormat returns YttOutputFormatIdentifier matching one of the following: OutputFormatStrings
+func ParseOutputFormat(format string) (YttOutputFormatIdentifier, error) {
+	for i, formatString := range OutputFormatStrings {
+		if formatString == strings.ToLower(format) {
+			return YttOutputFormatIdentifier(i), nil
+		}
+	}
+	return OutputFormatYaml, fmt.Errorf("unknown output format: %s, expected one of: %v", format, OutputFormatStrings)
+}
+
+// YttModeIdentifier enumerator to identify what the function does with the package
+//
+// ModeRender: render ytt output into output resources
+//
+// ModeTest: run test cases of YttRenderTest resources in memory and report them as results, leaving the package untouched
+type YttModeIdentifier int
+
+const (
+	ModeRender YttModeIdentifier = iota
+	ModeTest
+)
+
+// ModeStrings YttModeIdentifier enum as a string representation
+var ModeStrings = []string{"render", "test"}
+
+// String returns string representation of YttModeIdentifier
+func (mode YttModeIdentifier) String() string {
+	return ModeStrings[mode]
+}
+
+// ParseMode returns YttModeIdentifier matching one of the following: ModeStrings
+func ParseMode(mode string) (YttModeIdentifier, error) {
+	for i, modeString := range ModeStrings {
+		if modeString == strings.ToLower(mode) {
+			return YttModeIdentifier(i), nil
+		}
+	}
+	return ModeRender, fmt.Errorf("unknown mode: %s, expected one of: %v", mode, ModeStrings)
+}
+
+// YttVersionConstraint restricts the version reported by `ytt version`
+//
+// Minimum: any version at or above Version satisfies the constraint, otherwise Version is required exactly
+//
+// Version: major, minor and patch version
+type YttVersionConstraint struct {
+	Minimum bool
+	Version [3]int
+}
+
+// ParseYttVersionConstraint parses a required version, e.g. 0.50.0, or a minimum version, e.g. >=0.44.0
+func ParseYttVersionConstraint(constraint string) (*YttVersionConstraint, error) {
+	value := strings.TrimSpace(constraint)
+	minimum := strings.HasPrefix(value, ">=")
+	value = strings.TrimPrefix(strings.TrimPrefix(value, ">="), "=")
+	version, err := ParseYttVersion(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("node %s is not a version constraint: %s, expected e.g. 0.50.0 or >=0.44.0", configDebugYttVersion, constraint)
+	}
+	return &YttVersionConstraint{Minimum: minimum, Version: version}, nil
+}
+
+// ParseYttVersion parses a major.minor.patch version with optional v prefix, e.g. v0.50.0
+func ParseYttVersion(version string) ([3]int, error) {
+	var parsed [3]int
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != len(parsed) {
+		return parsed, fmt.Errorf("invalid ytt version: %s", version)
+	}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return parsed, fmt.Errorf("invalid ytt version: %s", version)
+		}
+		parsed[i] = number
+	}
+	return parsed, nil
+}
+
+// SatisfiedBy checks whether version satisfies the constraint
+func (constraint *YttVersionConstraint) SatisfiedBy(version [3]int) bool {
+	for i := range version {
+		if version[i] != constraint.Version[i] {
+			return constraint.Minimum && version[i] > constraint.Version[i]
+		}
+	}
+	return true
+}
+
+// String returns the constraint as written in the function config
+func (constraint *YttVersionConstraint) String() string {
+	version := fmt.Sprintf("%d.%d.%d", constraint.Version[0], constraint.Version[1], constraint.Version[2])
+	if constraint.Minimum {
+		return ">=" + version
+	}
+	return version
+}
+
 // Configure parses fnConfig and overwrite default values for easily accessible go values
+// A v1 ConfigMap with flat keys under data, e.g. debug.log_level, is read like the nested function config
 //
 // Parameters:
+//   - results: logger.Collector of the current run, receives the configured log level
 //   - fnConfig: kyaml.RNode representing function config to be parsed, resourceList.FunctionConfig
-func Configure(fnConfig *kyaml.RNode) error {
+func Configure(results *logger.Collector, fnConfig *kyaml.RNode) error {
+
+	// Flat keys passed through kpt fn eval
+	if isFlatConfigMap(fnConfig) {
+		nested, err := unflattenConfigMap(results, fnConfig)
+		if err != nil {
+			return err
+		}
+		fnConfig = nested
+	}
+
+	// Render outputs or run render tests
+	if !fnConfig.Field(configModeKey).IsNilOrEmpty() {
+		value, err := fnConfig.GetString(configModeKey)
+		if err != nil {
+			return err
+		}
+		mode, err := ParseMode(value)
+		if err != nil {
+			return err
+		}
+		YttMode = mode
+	}
+
+	// Inline data values passed to ytt after all other data values
+	if values := fnConfig.Field(configValuesRootKey); !values.IsNilOrEmpty() {
+		if values.Value.YNode().Kind != kyaml.MappingNode {
+			return fmt.Errorf("node %s is not a map: %s", configValuesRootKey, strings.TrimSpace(values.Value.MustString()))
+		}
+		YttInlineValues = values.Value
+	}
 
 	// Input customization
 	if inputs := fnConfig.Field(configInputRootKey); !inputs.IsNilOrEmpty() {
@@ -101,6 +487,91 @@ func Configure(fnConfig *kyaml.RNode) error {
 			YttNodeContent = value
 		}
 
+		// Check for user defined file name key
+		if !inputs.Field(configInputYttFileNameKey).IsNilOrEmpty() {
+			value, err := inputs.GetString(configInputYttFileNameKey)
+			if err != nil {
+				return err
+			}
+			YttNodeFileName = value
+		}
+
+		// Check for user defined file type key
+		if !inputs.Field(configInputYttFileTypeKey).IsNilOrEmpty() {
+			value, err := inputs.GetString(configInputYttFileTypeKey)
+			if err != nil {
+				return err
+			}
+			YttNodeFileType = value
+		}
+
+		// Check for user defined library name key
+		if !inputs.Field(configInputYttLibraryKey).IsNilOrEmpty() {
+			value, err := inputs.GetString(configInputYttLibraryKey)
+			if err != nil {
+				return err
+			}
+			YttNodeLibraryName = value
+		}
+
+		// Check for user defined library identifier
+		if libIdentifier := inputs.Field(configInputLibIdentifier); !libIdentifier.IsNilOrEmpty() {
+			libIdentifier := libIdentifier.Value
+			if !libIdentifier.Field("kind").IsNilOrEmpty() {
+				value, err := libIdentifier.GetString("kind")
+				if err != nil {
+					return err
+				}
+				YttLibraryKind = value
+			}
+		}
+
+		// Check for libraries made available to ytt
+		if !inputs.Field(configInputLibraries).IsNilOrEmpty() {
+			value, err := getStringList(inputs, configInputLibraries)
+			if err != nil {
+				return err
+			}
+			YttLibraries = value
+		}
+
+		// Check for templates and libraries fetched from outside the package
+		if !inputs.Field(configInputSources).IsNilOrEmpty() {
+			var sources []YttSource
+			if err := inputs.Field(configInputSources).Value.YNode().Decode(&sources); err != nil {
+				return fmt.Errorf("node %s is not a list of sources: %v", configInputSources, err)
+			}
+			for _, source := range sources {
+				if source.Library != "" && !IsValidLibraryName(source.Library) {
+					return fmt.Errorf("node %s contains invalid library: %s", configInputSources, source.Library)
+				}
+			}
+			YttSources = sources
+		}
+
+		// Check for fetched sources cache directory
+		if !inputs.Field(configInputSourceCacheDir).IsNilOrEmpty() {
+			value, err := inputs.GetString(configInputSourceCacheDir)
+			if err != nil {
+				return err
+			}
+			YttSourceCacheDir = value
+		}
+
+		// Check for Secrets bound as data values
+		if !inputs.Field(configInputSecretValues).IsNilOrEmpty() {
+			var secretValues []YttSecretValue
+			if err := inputs.Field(configInputSecretValues).Value.YNode().Decode(&secretValues); err != nil {
+				return fmt.Errorf("node %s is not a list of secret values: %v", configInputSecretValues, err)
+			}
+			for _, secretValue := range secretValues {
+				if secretValue.Name == "" {
+					return fmt.Errorf("node %s contains a secret value without name", configInputSecretValues)
+				}
+			}
+			YttSecretValues = secretValues
+		}
+
 		// Check for user defined ciq identifier
 		if ciqIdentifier := inputs.Field(configInputYttCiqIdentifier); !ciqIdentifier.IsNilOrEmpty() {
 			ciqIdentifier := ciqIdentifier.Value
@@ -113,6 +584,23 @@ func Configure(fnConfig *kyaml.RNode) error {
 				YttInputValueFileKind = value
 			}
 		}
+
+		// Check for selectors of data-value-files, templates and schemas
+		for key, selector := range map[string]**YttSelector{
+			configInputCiqSelector:      &YttValuesSelector,
+			configInputTemplateSelector: &YttTemplateSelector,
+			configInputSchemaSelector:   &YttSchemaSelector,
+		} {
+			// Explicitly empty selectors are parsed, so they fail instead of selecting everything
+			if field := inputs.Field(key); field == nil || field.Value.IsTaggedNull() {
+				continue
+			}
+			value, err := parseSelector(inputs, key)
+			if err != nil {
+				return err
+			}
+			*selector = value
+		}
 	}
 
 	// Output customization
@@ -128,6 +616,15 @@ func Configure(fnConfig *kyaml.RNode) error {
 			YttOutputFileKind = value
 		}
 
+		// Check for output resource selector
+		if field := outputs.Field(configOutputSelector); field != nil && !field.Value.IsTaggedNull() {
+			value, err := parseSelector(outputs, configOutputSelector)
+			if err != nil {
+				return err
+			}
+			YttOutputSelector = value
+		}
+
 		// Check for output element key
 		if !outputs.Field(configOutputElementKey).IsNilOrEmpty() {
 			value, err := outputs.GetString(configOutputElementKey)
@@ -136,6 +633,98 @@ func Configure(fnConfig *kyaml.RNode) error {
 			}
 			YttOutputElementKey = value
 		}
+
+		// Check for serialized output data key
+		if !outputs.Field(configOutputDataKey).IsNilOrEmpty() {
+			value, err := outputs.GetString(configOutputDataKey)
+			if err != nil {
+				return err
+			}
+			YttOutputDataKey = value
+		}
+
+		// Check for output serialization format
+		if !outputs.Field(configOutputFormatKey).IsNilOrEmpty() {
+			value, err := outputs.GetString(configOutputFormatKey)
+			if err != nil {
+				return err
+			}
+			format, err := ParseOutputFormat(value)
+			if err != nil {
+				return err
+			}
+			YttOutputFormat = format
+		}
+
+		// Check for output fields written to Secrets
+		if !outputs.Field(configOutputSecretFields).IsNilOrEmpty() {
+			var secretFields []YttSecretField
+			if err := outputs.Field(configOutputSecretFields).Value.YNode().Decode(&secretFields); err != nil {
+				return fmt.Errorf("node %s is not a list of secret fields: %v", configOutputSecretFields, err)
+			}
+			for _, secretField := range secretFields {
+				if secretField.Path == "" || secretField.Secret == "" {
+					return fmt.Errorf("node %s contains a secret field without path or secret", configOutputSecretFields)
+				}
+			}
+			YttSecretFields = secretFields
+		}
+
+		// Check for schema validation of output documents
+		if !outputs.Field(configOutputValidateSchema).IsNilOrEmpty() {
+			value, err := getBool(outputs, configOutputValidateSchema)
+			if err != nil {
+				return err
+			}
+			YttOutputValidateSchema = value
+		}
+	}
+
+	// Rules of ytt output documents, compiled once for all documents
+	if !fnConfig.Field(configValidationsKey).IsNilOrEmpty() {
+		var validations []YttValidation
+		if err := fnConfig.Field(configValidationsKey).Value.YNode().Decode(&validations); err != nil {
+			return fmt.Errorf("node %s is not a list of validations: %v", configValidationsKey, err)
+		}
+		for i := range validations {
+			if validations[i].Expression == "" {
+				return fmt.Errorf("node %s contains a validation without expression", configValidationsKey)
+			}
+			program, err := expression.Compile(validations[i].Expression, "self")
+			if err != nil {
+				return fmt.Errorf("node %s contains an invalid validation: %v", configValidationsKey, err)
+			}
+			validations[i].Program = program
+		}
+		YttValidations = validations
+	}
+
+	// Consistency rules of package resources, compiled once
+	if !fnConfig.Field(configConsistencyKey).IsNilOrEmpty() {
+		rules, err := parseConsistencyRules(fnConfig)
+		if err != nil {
+			return err
+		}
+		YttConsistencyRules = rules
+	}
+
+	// Limits customization
+	if limits := fnConfig.Field(configLimitsRootKey); !limits.IsNilOrEmpty() {
+		limits := limits.Value
+		for key, limit := range map[string]*int{
+			configLimitsOutputBytes:     &YttMaxOutputBytes,
+			configLimitsOutputDocuments: &YttMaxOutputDocuments,
+			configLimitsDepth:           &YttMaxDepth,
+		} {
+			if limits.Field(key).IsNilOrEmpty() {
+				continue
+			}
+			value, err := getNonNegativeInt(limits, key)
+			if err != nil {
+				return err
+			}
+			*limit = value
+		}
 	}
 
 	// Debug customization
@@ -160,14 +749,207 @@ func Configure(fnConfig *kyaml.RNode) error {
 			YttBinaryName = value
 		}
 
+		// Check for ytt binary version constraint
+		if !debug.Field(configDebugYttVersion).IsNilOrEmpty() {
+			value, err := debug.GetString(configDebugYttVersion)
+			if err != nil {
+				return err
+			}
+			constraint, err := ParseYttVersionConstraint(value)
+			if err != nil {
+				return err
+			}
+			YttVersion = constraint
+		}
+
+		// Check for ytt execution timeout
+		if !debug.Field(configDebugTimeout).IsNilOrEmpty() {
+			value, err := debug.GetString(configDebugTimeout)
+			if err != nil {
+				return err
+			}
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout < 0 {
+				return fmt.Errorf("node %s is not a positive duration: %s", configDebugTimeout, value)
+			}
+			YttTimeout = timeout
+		}
+
 		// Change debug level to given value
 		if !debug.Field(configDebugLogLevel).IsNilOrEmpty() {
 			debugLevel, err := debug.GetString(configDebugLogLevel)
 			if err != nil {
 				return err
 			}
-			logger.SetLogLevel(debugLevel)
+			results.SetLogLevel(debugLevel)
+		}
+
+		// Check for render statistics file
+		if !debug.Field(configDebugMetricsFile).IsNilOrEmpty() {
+			value, err := debug.GetString(configDebugMetricsFile)
+			if err != nil {
+				return err
+			}
+			YttMetricsFile = value
+		}
+
+		// Check for debug bundle of ytt inputs and output
+		if !debug.Field(configDebugBundle).IsNilOrEmpty() {
+			value, err := debug.GetString(configDebugBundle)
+			if err != nil {
+				return err
+			}
+			YttDebugBundle = value
+		}
+
+		// Check for patterns of keys masked in logs and results, an empty list disables pattern matching
+		if redactKeys := debug.Field(configDebugRedactKeys); !redactKeys.IsNilOrEmpty() || (redactKeys != nil && kyaml.IsYNodeEmptySeq(redactKeys.Value.YNode())) {
+			value, err := getStringList(debug, configDebugRedactKeys)
+			if err != nil {
+				return err
+			}
+			YttRedactKeyPatterns = value
+		}
+
+		// Enable structured stderr logs, filtered separately from results
+		if !debug.Field(configDebugStderrLogLevel).IsNilOrEmpty() || !debug.Field(configDebugStderrLogFormat).IsNilOrEmpty() {
+			stderrLevel, stderrFormat := "INFO", "logfmt"
+			if !debug.Field(configDebugStderrLogLevel).IsNilOrEmpty() {
+				value, err := debug.GetString(configDebugStderrLogLevel)
+				if err != nil {
+					return err
+				}
+				stderrLevel = value
+			}
+			if !debug.Field(configDebugStderrLogFormat).IsNilOrEmpty() {
+				value, err := debug.GetString(configDebugStderrLogFormat)
+				if err != nil {
+					return err
+				}
+				stderrFormat = value
+			}
+			if err := results.EnableStderr(stderrLevel, stderrFormat); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
+
+// parseConsistencyRules decodes and compiles the consistency rules of fnConfig
+//
+// Parameters:
+//   - fnConfig: function config holding configConsistencyKey
+//
+// Returns:
+//   - []YttConsistencyRule: rules with compiled expressions
+//   - error: when a rule is malformed or its expression is invalid
+func parseConsistencyRules(fnConfig *kyaml.RNode) ([]YttConsistencyRule, error) {
+	var rules []YttConsistencyRule
+	if err := fnConfig.Field(configConsistencyKey).Value.YNode().Decode(&rules); err != nil {
+		return nil, fmt.Errorf("node %s is not a list of consistency rules: %v", configConsistencyKey, err)
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("node %s contains a rule without name at index %d", configConsistencyKey, i)
+		}
+		if len(rule.Resources) == 0 {
+			return nil, fmt.Errorf("node %s rule %s has no resources", configConsistencyKey, rule.Name)
+		}
+		if len(rule.Equal) == 0 && rule.Expression == "" {
+			return nil, fmt.Errorf("node %s rule %s has neither equal nor expression", configConsistencyKey, rule.Name)
+		}
+		if len(rule.Equal) > 0 && len(rule.Resources) < 2 {
+			return nil, fmt.Errorf("node %s rule %s compares fields of less than two resources", configConsistencyKey, rule.Name)
+		}
+		variables := make([]string, 0, len(rule.Resources))
+		for variable := range rule.Resources {
+			variables = append(variables, variable)
+		}
+		sort.Strings(variables)
+		for _, variable := range variables {
+			selector := rule.Resources[variable]
+			if !consistencyVariableRegexp.MatchString(variable) {
+				return nil, fmt.Errorf("node %s rule %s has an invalid resource name: %s", configConsistencyKey, rule.Name, variable)
+			}
+			if selector == nil {
+				return nil, fmt.Errorf("node %s rule %s has no selector for resource %s", configConsistencyKey, rule.Name, variable)
+			}
+			if err := selector.validate(configConsistencyKey); err != nil {
+				return nil, err
+			}
+		}
+		if rule.Expression != "" {
+			program, err := expression.Compile(rule.Expression, variables...)
+			if err != nil {
+				return nil, fmt.Errorf("node %s rule %s is invalid: %v", configConsistencyKey, rule.Name, err)
+			}
+			rule.Program = program
+		}
+	}
+	return rules, nil
+}
+
+// consistencyVariableRegexp resource names of consistency rules, used as CEL variables
+var consistencyVariableRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// getStringList reads a list of strings from field of node
+//
+// Parameters:
+//   - node: kyaml.RNode holding field
+//   - field: key of the list to read
+//
+// Returns:
+//   - []string: list values
+//   - error: when field is not a list of strings
+func getStringList(node *kyaml.RNode, field string) ([]string, error) {
+	list := node.Field(field).Value
+	if list.YNode().Kind != kyaml.SequenceNode {
+		return nil, fmt.Errorf("node %s is not a list: %s", field, strings.TrimSpace(list.MustString()))
+	}
+	values := []string{}
+	for _, element := range list.Content() {
+		if element.Kind != kyaml.ScalarNode {
+			return nil, fmt.Errorf("node %s contains a non string element", field)
+		}
+		values = append(values, element.Value)
+	}
+	return values, nil
+}
+
+// getNonNegativeInt reads a non negative integer from field of node
+//
+// Parameters:
+//   - node: kyaml.RNode holding field
+//   - field: key of the integer to read
+//
+// Returns:
+//   - int: field value
+//   - error: when field is not a non negative integer
+func getNonNegativeInt(node *kyaml.RNode, field string) (int, error) {
+	value := node.Field(field).Value.YNode()
+	number, err := strconv.Atoi(value.Value)
+	if value.Kind != kyaml.ScalarNode || err != nil || number < 0 {
+		return 0, fmt.Errorf("node %s is not a non negative integer: %s", field, strings.TrimSpace(node.Field(field).Value.MustString()))
+	}
+	return number, nil
+}
+
+// getBool reads a boolean from field of node
+//
+// Parameters:
+//   - node: kyaml.RNode holding field
+//   - field: key of the boolean to read
+//
+// Returns:
+//   - bool: field value
+//   - error: when field is not a boolean
+func getBool(node *kyaml.RNode, field string) (bool, error) {
+	value := node.Field(field).Value.YNode()
+	boolean, err := strconv.ParseBool(value.Value)
+	if value.Kind != kyaml.ScalarNode || err != nil {
+		return false, fmt.Errorf("node %s is not a boolean: %s", field, strings.TrimSpace(node.Field(field).Value.MustString()))
+	}
+	return boolean, nil
+}
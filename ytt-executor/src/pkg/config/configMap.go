@@ -0,0 +1,102 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// flatKeyAliases maps documented short flat keys onto their nested function config path
+var flatKeyAliases = map[string]string{
+	"input.ciq.kind":     configInputRootKey + "." + configInputYttCiqIdentifier + ".kind",
+	"input.library.kind": configInputRootKey + "." + configInputLibIdentifier + ".kind",
+}
+
+// flatKeyRoots root nodes flat keys may start with
+var flatKeyRoots = []string{configInputRootKey, configOutputRootKey, configLimitsRootKey, configDebugRootKey, configValuesRootKey}
+
+// flatKeyScalars top level keys given whole, e.g. mode=test or validations=[...]
+var flatKeyScalars = []string{configModeKey, configValidationsKey, configConsistencyKey}
+
+// isFlatConfigMap checks whether fnConfig is a v1 ConfigMap holding flat keys under data, as created by
+// `kpt fn eval -- key=value`
+func isFlatConfigMap(fnConfig *kyaml.RNode) bool {
+	return fnConfig.GetApiVersion() == "v1" && fnConfig.GetKind() == "ConfigMap" && !fnConfig.Field("data").IsNilOrEmpty()
+}
+
+// unflattenConfigMap converts dotted keys under data of a ConfigMap function config, e.g. debug.log_level,
+// to the nested function config, values are parsed as yaml so lists and numbers can be given inline
+//
+// Parameters:
+//   - results: logger.Collector of the current run, receives warnings on unknown keys
+//   - fnConfig: v1 ConfigMap function config
+//
+// Returns:
+//   - *kyaml.RNode: nested function config
+//   - error: when a key is malformed or conflicts with another key
+func unflattenConfigMap(results *logger.Collector, fnConfig *kyaml.RNode) (*kyaml.RNode, error) {
+	data := fnConfig.GetDataMap()
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	nested := kyaml.NewMapRNode(nil)
+	for _, key := range keys {
+		path := key
+		if alias, found := flatKeyAliases[key]; found {
+			path = alias
+		}
+		fields := strings.Split(path, ".")
+		for _, field := range fields {
+			if field == "" {
+				return nil, fmt.Errorf("function config key %s is not a dotted path", key)
+			}
+		}
+		isScalar := len(fields) == 1 && contains(flatKeyScalars, fields[0])
+		if !isScalar && (len(fields) < 2 || !contains(flatKeyRoots, fields[0])) {
+			results.LogWarning(fmt.Sprintf("Ignoring unknown function config key: %s", key))
+			continue
+		}
+
+		// Create parent maps, a parent set to a value conflicts with the key
+		parent, err := nested.Pipe(kyaml.LookupCreate(kyaml.MappingNode, fields[:len(fields)-1]...))
+		if err != nil || parent == nil || parent.YNode().Kind != kyaml.MappingNode {
+			return nil, fmt.Errorf("function config key %s conflicts with another key", key)
+		}
+		if parent.Field(fields[len(fields)-1]) != nil {
+			return nil, fmt.Errorf("function config key %s conflicts with another key", key)
+		}
+		if err := parent.PipeE(kyaml.SetField(fields[len(fields)-1], parseFlatValue(data[key]))); err != nil {
+			return nil, err
+		}
+	}
+	return nested, nil
+}
+
+// parseFlatValue parses value as yaml, e.g. [nflib, commonlib] to a list, keeping it a string when not valid yaml
+func parseFlatValue(value string) *kyaml.RNode {
+	node := &kyaml.Node{}
+	if err := kyaml.Unmarshal([]byte(value), node); err != nil || len(node.Content) == 0 {
+		return kyaml.NewStringRNode(value)
+	}
+	return kyaml.NewRNode(node.Content[0])
+}
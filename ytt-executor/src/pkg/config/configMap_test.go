@@ -0,0 +1,120 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestConfigureFlatConfigMap(t *testing.T) {
+	// Reset changed values after test
+	defer func() {
+		YttOutputFileKind = "Configuration"
+		YttInputValueFileKind = "YttDataValues"
+		YttLibraries = nil
+		YttMaxDepth = 100
+		YttInlineValues = nil
+		YttMode = ModeRender
+	}()
+
+	// ConfigMap as created by kpt fn eval -- key=value
+	results := logger.NewCollector()
+	err := Configure(results, kyaml.MustParse(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: function-input
+data:
+  output.kind: AmfConfiguration
+  input.ciq.kind: AmfCiq
+  input.libraries: "[nflib, commonlib]"
+  limits.max_depth: "20"
+  debug.log_level: DEBUG
+  values.amf.replicas: "3"
+  values.amf.name: amf-site-1
+  mode: test
+  replicas: "2"
+`))
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Assert flat keys mapped onto typed config
+	assert.Equal(t, "AmfConfiguration", YttOutputFileKind)
+	assert.Equal(t, "AmfCiq", YttInputValueFileKind)
+	assert.Equal(t, []string{"nflib", "commonlib"}, YttLibraries)
+	assert.Equal(t, 20, YttMaxDepth)
+	assert.Equal(t, ModeTest, YttMode)
+	assert.Equal(t, logger.LogLevelDebug, results.LogLevel)
+	assert.Equal(t, "amf:\n  name: amf-site-1\n  replicas: 3\n", YttInlineValues.MustString())
+
+	// Unknown keys are reported
+	assert.Equal(t, "Ignoring unknown function config key: replicas", results.Results[0].Message)
+}
+
+func TestConfigureFlatConfigMapErrors(t *testing.T) {
+	// Test structure
+	tests := []struct {
+		name          string
+		data          string
+		expectedError string
+	}{ // Test list
+
+		// Key below a value
+		{
+			"Test fail on conflicting keys",
+			`
+  debug.log_level: DEBUG
+  debug.log_level.stderr: INFO
+`,
+			"function config key debug.log_level.stderr conflicts with another key",
+		},
+
+		// Empty path segment
+		{
+			"Test fail on empty segment",
+			`
+  debug..log_level: DEBUG
+`,
+			"function config key debug..log_level is not a dotted path",
+		},
+
+		// Typed validation still applies
+		{
+			"Test fail on invalid limit",
+			`
+  limits.max_depth: deep
+`,
+			"node max_depth is not a non negative integer: deep",
+		},
+	}
+
+	// Loop through tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Configure(logger.NewCollector(), kyaml.MustParse(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: function-input
+data:`+tt.data))
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
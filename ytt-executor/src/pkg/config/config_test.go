@@ -32,13 +32,33 @@ input:
     kind: CustomYttDataValues
   ytt_header: custom_ytt_header
   ytt_content: custom_ytt_template_content
+  ytt_file_name: custom_ytt_file_name
+  ytt_file_type: custom_ytt_file_type
+  ytt_library: custom_ytt_library
+  library_identifier:
+    kind: CustomYttLibrary
+  libraries:
+    - nflib
+    - commonlib
+  sources:
+    - image: registry.io/nf/templates@sha256:0123
+      library: nflib
+      insecure: true
+    - tarball: bundles/templates.tar.gz
+      path: config
+    - package: ../templates
+  source_cache_dir: /tmp/cache
 output:
   kind: CustomCNSConfigurationFiles
   output_key: custom_data
+  data_key: amfcfg.toml
+  format: TOML
 debug:
   work_dir: subDir
   bin_name: echo
+  ytt_version: ">=0.44.0"
   log_level: Debug
+  bundle: debug/amf.tar.gz
 `)
 
 	// Catch error from parsing config
@@ -49,7 +69,8 @@ debug:
 	// Read config and change values to al the required fields
 	t.Run("Read config and assert values", func(t *testing.T) {
 		// Execute configure
-		err := Configure(fnConfig)
+		results := logger.NewCollector()
+		err := Configure(results, fnConfig)
 		if err != nil {
 			t.Fatalf("Encountered error while reading fnConfig: %v", err)
 		}
@@ -58,11 +79,26 @@ debug:
 		assert.Equal(t, "CustomYttDataValues", YttInputValueFileKind)
 		assert.Equal(t, "custom_ytt_header", YttNodeAnnotations)
 		assert.Equal(t, "custom_ytt_template_content", YttNodeContent)
+		assert.Equal(t, "custom_ytt_file_name", YttNodeFileName)
+		assert.Equal(t, "custom_ytt_file_type", YttNodeFileType)
+		assert.Equal(t, "custom_ytt_library", YttNodeLibraryName)
+		assert.Equal(t, "CustomYttLibrary", YttLibraryKind)
+		assert.Equal(t, []string{"nflib", "commonlib"}, YttLibraries)
+		assert.Equal(t, []YttSource{
+			{Image: "registry.io/nf/templates@sha256:0123", Library: "nflib", Insecure: true},
+			{Tarball: "bundles/templates.tar.gz", Path: "config"},
+			{Package: "../templates"},
+		}, YttSources)
+		assert.Equal(t, "/tmp/cache", YttSourceCacheDir)
 		assert.Equal(t, "CustomCNSConfigurationFiles", YttOutputFileKind)
 		assert.Equal(t, "custom_data", YttOutputElementKey)
+		assert.Equal(t, "amfcfg.toml", YttOutputDataKey)
+		assert.Equal(t, OutputFormatToml, YttOutputFormat)
 		assert.Equal(t, "subDir", YttWorkDirectory)
 		assert.Equal(t, "echo", YttBinaryName)
-		assert.Equal(t, logger.LogLevel, logger.LogLevelDebug)
+		assert.Equal(t, &YttVersionConstraint{Minimum: true, Version: [3]int{0, 44, 0}}, YttVersion)
+		assert.Equal(t, "debug/amf.tar.gz", YttDebugBundle)
+		assert.Equal(t, logger.LogLevelDebug, results.LogLevel)
 	})
 }
 
@@ -112,6 +148,42 @@ input:
 `,
 		},
 
+		// Test catch error of parse inputs.ytt_file_name
+		{
+			"Test fail to parse inputs.ytt_file_name",
+			"ytt_file_name",
+			"map[child_element:to_break_parsing]",
+			`
+input:
+  ytt_file_name:
+    child_element: to_break_parsing
+`,
+		},
+
+		// Test catch error of parse inputs.ytt_file_type
+		{
+			"Test fail to parse inputs.ytt_file_type",
+			"ytt_file_type",
+			"map[child_element:to_break_parsing]",
+			`
+input:
+  ytt_file_type:
+    child_element: to_break_parsing
+`,
+		},
+
+		// Test catch error of parse inputs.ytt_library
+		{
+			"Test fail to parse inputs.ytt_library",
+			"ytt_library",
+			"map[child_element:to_break_parsing]",
+			`
+input:
+  ytt_library:
+    child_element: to_break_parsing
+`,
+		},
+
 		// Test catch error of parse output.kind
 		{
 			"Test fail to parse output.kind",
@@ -136,6 +208,30 @@ output:
 `,
 		},
 
+		// Test catch error of parse output.data_key
+		{
+			"Test fail to parse output.data_key",
+			"data_key",
+			"map[child_element:to_break_parsing]",
+			`
+output:
+  data_key:
+    child_element: to_break_parsing
+`,
+		},
+
+		// Test catch error of parse output.format
+		{
+			"Test fail to parse output.format",
+			"format",
+			"map[child_element:to_break_parsing]",
+			`
+output:
+  format:
+    child_element: to_break_parsing
+`,
+		},
+
 		// Test catch error of parse debug.work_dir
 		{
 			"Test fail to parse debug.work_dir",
@@ -183,7 +279,7 @@ debug:
 			}
 
 			// Execute function
-			err = Configure(fnConfig)
+			err = Configure(logger.NewCollector(), fnConfig)
 			if err == nil {
 				t.Fatalf("error was expected, name: %v, fnConfigSlice: %v", tt.name, tt.fnConfig)
 			}
@@ -201,3 +297,423 @@ debug:
 		})
 	}
 }
+
+func TestParseOutputFormat(t *testing.T) {
+	// Known formats are matched case insensitive
+	t.Run("Parse known format", func(t *testing.T) {
+		format, err := ParseOutputFormat("Properties")
+		if err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+		assert.Equal(t, OutputFormatProperties, format)
+		assert.Equal(t, "properties", format.String())
+	})
+
+	// Unknown formats return an error
+	t.Run("Fail to parse unknown format", func(t *testing.T) {
+		_, err := ParseOutputFormat("ini")
+		assert.Equal(
+			t,
+			errors.New("unknown output format: ini, expected one of: [yaml text json toml properties]"),
+			err,
+		)
+	})
+}
+
+func TestParseMode(t *testing.T) {
+	// Known modes are matched case insensitive
+	t.Run("Parse known mode", func(t *testing.T) {
+		mode, err := ParseMode("Test")
+		if err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+		assert.Equal(t, ModeTest, mode)
+		assert.Equal(t, "test", mode.String())
+	})
+
+	// Unknown modes return an error
+	t.Run("Fail to parse unknown mode", func(t *testing.T) {
+		_, err := ParseMode("lint")
+		assert.Equal(
+			t,
+			errors.New("unknown mode: lint, expected one of: [render test]"),
+			err,
+		)
+	})
+}
+
+func TestYttVersionConstraint(t *testing.T) {
+	// Test structure
+	tests := []struct {
+		name       string
+		constraint string
+		version    [3]int
+		satisfied  bool
+	}{ // Test list
+
+		// Exact version
+		{"Test required version matches", "0.50.0", [3]int{0, 50, 0}, true},
+		{"Test required version differs", "=v0.50.0", [3]int{0, 50, 1}, false},
+
+		// Minimum version
+		{"Test minimum version matches", ">=0.44.0", [3]int{0, 44, 0}, true},
+		{"Test minimum version exceeded", ">= 0.44.2", [3]int{1, 0, 0}, true},
+		{"Test minimum version not reached", ">=0.44.2", [3]int{0, 44, 1}, false},
+	}
+
+	// Loop through tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constraint, err := ParseYttVersionConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			assert.Equal(t, tt.satisfied, constraint.SatisfiedBy(tt.version))
+		})
+	}
+
+	// Constraints are printed as written
+	t.Run("Format minimum version", func(t *testing.T) {
+		constraint, _ := ParseYttVersionConstraint(">= v0.44.2")
+		assert.Equal(t, ">=0.44.2", constraint.String())
+	})
+}
+
+func TestConfigureRedactKeys(t *testing.T) {
+	// Reset default patterns after test
+	defaultPatterns := YttRedactKeyPatterns
+	defer func() {
+		YttRedactKeyPatterns = defaultPatterns
+	}()
+
+	// Given patterns replace defaults
+	err := Configure(logger.NewCollector(), kyaml.MustParse("debug:\n  redact_keys: [nrfToken, '(?i)tls']\n"))
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Equal(t, []string{"nrfToken", "(?i)tls"}, YttRedactKeyPatterns)
+
+	// An empty list disables pattern matching
+	err = Configure(logger.NewCollector(), kyaml.MustParse("debug:\n  redact_keys: []\n"))
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Equal(t, []string{}, YttRedactKeyPatterns)
+}
+
+func TestConfigureValidations(t *testing.T) {
+	defer Reset()
+
+	// Rules are compiled on configure
+	err := Configure(logger.NewCollector(), kyaml.MustParse(`
+validations:
+  - expression: self.amf.replicas > 0
+    message: at least one replica
+    output: amf-values
+`))
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Len(t, YttValidations, 1)
+	assert.Equal(t, "amf-values", YttValidations[0].Output)
+	assert.NotNil(t, YttValidations[0].Program)
+
+	// Syntax errors fail configure
+	err = Configure(logger.NewCollector(), kyaml.MustParse("validations: [{expression: self.amf +}]\n"))
+	assert.ErrorContains(t, err, "node validations contains an invalid validation: invalid expression self.amf +")
+}
+
+func TestConfigureListErrors(t *testing.T) {
+	// Test structure
+	tests := []struct {
+		name          string
+		fnConfig      string
+		expectedError string
+	}{ // Test list
+
+		// Libraries given as a string
+		{
+			"Test fail to parse inputs.libraries as string",
+			`
+input:
+  libraries: nflib
+`,
+			"node libraries is not a list: nflib",
+		},
+
+		// Libraries containing a map
+		{
+			"Test fail to parse inputs.libraries with map element",
+			`
+input:
+  libraries:
+    - name: nflib
+`,
+			"node libraries contains a non string element",
+		},
+
+		// Sources given as a map
+		{
+			"Test fail to parse inputs.sources as map",
+			`
+input:
+  sources:
+    image: registry.io/nf/templates@sha256:0123
+`,
+			"node sources is not a list of sources: yaml: unmarshal errors:\n  line 4: cannot unmarshal !!map into []config.YttSource",
+		},
+
+		// Source library escaping _ytt_lib
+		{
+			"Test fail to parse inputs.sources with invalid library",
+			`
+input:
+  sources:
+    - tarball: bundles/nf-templates.tar.gz
+      library: ../nflib
+`,
+			"node sources contains invalid library: ../nflib",
+		},
+
+		// Source cache directory given as a map
+		{
+			"Test fail to parse inputs.source_cache_dir",
+			`
+input:
+  source_cache_dir:
+    child_element: to_break_parsing
+`,
+			"node source_cache_dir is not a string: map[child_element:to_break_parsing]",
+		},
+
+		// Library kind given as a map
+		{
+			"Test fail to parse inputs.library_identifier.kind",
+			`
+input:
+  library_identifier:
+    kind:
+      child_element: to_break_parsing
+`,
+			"node kind is not a string: map[child_element:to_break_parsing]",
+		},
+
+		// Secret value without name
+		{
+			"Test fail to parse inputs.secret_values without name",
+			`
+input:
+  secret_values:
+    - path: nrf
+`,
+			"node secret_values contains a secret value without name",
+		},
+
+		// Secret field without secret
+		{
+			"Test fail to parse output.secret_fields without secret",
+			`
+output:
+  secret_fields:
+    - path: amf.nrfToken
+`,
+			"node secret_fields contains a secret field without path or secret",
+		},
+
+		// Negative limit
+		{
+			"Test fail to parse limits.max_output_bytes",
+			`
+limits:
+  max_output_bytes: -1
+`,
+			"node max_output_bytes is not a non negative integer: -1",
+		},
+
+		// Timeout not a duration
+		{
+			"Test fail to parse debug.timeout",
+			`
+debug:
+  timeout: forever
+`,
+			"node timeout is not a positive duration: forever",
+		},
+
+		// Version constraint without patch version
+		{
+			"Test fail to parse debug.ytt_version",
+			`
+debug:
+  ytt_version: ">0.44"
+`,
+			"node ytt_version is not a version constraint: >0.44, expected e.g. 0.50.0 or >=0.44.0",
+		},
+
+		// Redact keys given as a string
+		{
+			"Test fail to parse debug.redact_keys as string",
+			`
+debug:
+  redact_keys: password
+`,
+			"node redact_keys is not a list: password",
+		},
+
+		// Unknown stderr log level
+		{
+			"Test fail to enable stderr logs with unknown level",
+			`
+debug:
+  stderr_log_level: TRACE
+`,
+			"unknown stderr log level: TRACE, expected one of: [DEBUG INFO WARNING ERROR]",
+		},
+
+		// Unknown stderr log format
+		{
+			"Test fail to enable stderr logs with unknown format",
+			`
+debug:
+  stderr_log_format: xml
+`,
+			"unknown stderr log format: xml, expected one of: [json logfmt]",
+		},
+
+		// Validations given as a map
+		{
+			"Test fail to parse validations as map",
+			`
+validations:
+  expression: self.amf.replicas > 0
+`,
+			"node validations is not a list of validations: yaml: unmarshal errors:\n  line 3: cannot unmarshal !!map into []config.YttValidation",
+		},
+
+		// Validation without expression
+		{
+			"Test fail to parse validations without expression",
+			`
+validations:
+  - message: at least one replica
+`,
+			"node validations contains a validation without expression",
+		},
+
+		// Consistency rule without name
+		{
+			"Test fail to parse consistency without name",
+			`
+consistency:
+  - resources: {site: {names: [site-ciq]}}
+    expression: "true"
+`,
+			"node consistency contains a rule without name at index 0",
+		},
+
+		// Consistency rule without checks
+		{
+			"Test fail to parse consistency without equal or expression",
+			`
+consistency:
+  - name: plmn
+    resources: {site: {names: [site-ciq]}}
+`,
+			"node consistency rule plmn has neither equal nor expression",
+		},
+
+		// Equal fields of a single resource
+		{
+			"Test fail to parse consistency comparing a single resource",
+			`
+consistency:
+  - name: plmn
+    resources: {site: {names: [site-ciq]}}
+    equal: [plmn.mcc]
+`,
+			"node consistency rule plmn compares fields of less than two resources",
+		},
+
+		// Resource names are CEL variables
+		{
+			"Test fail to parse consistency with invalid resource name",
+			`
+consistency:
+  - name: plmn
+    resources: {amf-ciq: {names: [amf-ciq]}}
+    expression: "true"
+`,
+			"node consistency rule plmn has an invalid resource name: amf-ciq",
+		},
+
+		// Unknown selector operator
+		{
+			"Test fail to parse consistency with invalid selector",
+			`
+consistency:
+  - name: plmn
+    resources: {amf: {matchExpressions: [{key: nf, operator: Equals}]}}
+    expression: "true"
+`,
+			"node consistency contains unknown operator: Equals, expected one of: [In NotIn Exists DoesNotExist]",
+		},
+
+		// Expression referencing undeclared resources
+		{
+			"Test fail to parse consistency with undeclared resource",
+			`
+consistency:
+  - name: plmn
+    resources: {amf: {names: [amf-ciq]}}
+    expression: amf.tac == smf.tac
+`,
+			"node consistency rule plmn is invalid: invalid expression amf.tac == smf.tac: ERROR: <input>:1:12: undeclared reference to 'smf' (in container '')\n | amf.tac == smf.tac\n | ...........^",
+		},
+	}
+
+	// Loop through tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Execute function
+			err := Configure(logger.NewCollector(), kyaml.MustParse(tt.fnConfig))
+
+			// Compare error expected vs received
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	// Override defaults of several kinds
+	err := Configure(logger.NewCollector(), kyaml.MustParse(`
+mode: test
+input:
+  libraries: [nflib]
+  template_selector: {kinds: [YttTemplate]}
+output:
+  kind: AmfConfiguration
+limits:
+  max_documents: 5
+debug:
+  redact_keys: [nrfToken]
+values:
+  amf: 1
+`))
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	assert.Equal(t, "AmfConfiguration", YttOutputFileKind)
+	assert.Equal(t, ModeTest, YttMode)
+
+	// Execute function
+	Reset()
+
+	// Defaults are restored
+	assert.Equal(t, "Configuration", YttOutputFileKind)
+	assert.Equal(t, ModeRender, YttMode)
+	assert.Equal(t, 10000, YttMaxOutputDocuments)
+	assert.Nil(t, YttLibraries)
+	assert.Nil(t, YttTemplateSelector)
+	assert.Nil(t, YttInlineValues)
+	assert.Len(t, YttRedactKeyPatterns, 1)
+}
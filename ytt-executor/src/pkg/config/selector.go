@@ -0,0 +1,176 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Operators of YttMatchExpression, as in Kubernetes label selectors
+const (
+	MatchOperatorIn           = "In"
+	MatchOperatorNotIn        = "NotIn"
+	MatchOperatorExists       = "Exists"
+	MatchOperatorDoesNotExist = "DoesNotExist"
+)
+
+// YttSelector selects package resources for a role, a resource is selected when all given fields match
+//
+// Selector: names, namespaces, kinds, apiVersions, labels and annotations matched by kyaml framework.Selector
+//
+// MatchExpressions: label requirements, e.g. {key: nf, operator: In, values: [amf, smf]}
+//
+// Paths: globs matched against the config.kubernetes.io/path annotation, e.g. amf/*.yaml
+type YttSelector struct {
+	framework.Selector `yaml:",inline"`
+	MatchExpressions   []YttMatchExpression `yaml:"matchExpressions,omitempty"`
+	Paths              []string             `yaml:"paths,omitempty"`
+}
+
+// yttSelectorKeys keys a YttSelector is decoded from, any other key is a typo that would widen the selector
+var yttSelectorKeys = []string{"names", "namespaces", "kinds", "apiVersions", "labels", "annotations", "matchExpressions", "paths"}
+
+// YttMatchExpression label requirement of a YttSelector
+//
+// Key: label key
+//
+// Operator: one of In, NotIn, Exists or DoesNotExist
+//
+// Values: label values for In and NotIn
+type YttMatchExpression struct {
+	Key      string   `yaml:"key"`
+	Operator string   `yaml:"operator"`
+	Values   []string `yaml:"values,omitempty"`
+}
+
+// parseSelector decodes the YttSelector under field of node
+//
+// Parameters:
+//   - node: kyaml.RNode holding field
+//   - field: key of the selector to read
+//
+// Returns:
+//   - *YttSelector: decoded selector
+//   - error: when field is not a selector, has unknown keys, is empty, an operator is unknown or a path glob is malformed
+func parseSelector(node *kyaml.RNode, field string) (*YttSelector, error) {
+	selector := &YttSelector{}
+	if err := node.Field(field).Value.YNode().Decode(selector); err != nil {
+		return nil, fmt.Errorf("node %s is not a selector: %v", field, err)
+	}
+	keys, err := node.Field(field).Value.Fields()
+	if err != nil {
+		return nil, fmt.Errorf("node %s is not a selector: %v", field, err)
+	}
+	for _, key := range keys {
+		if !contains(yttSelectorKeys, key) {
+			return nil, fmt.Errorf("node %s contains unknown key: %s, expected one of: %v", field, key, yttSelectorKeys)
+		}
+	}
+	if err := selector.validate(field); err != nil {
+		return nil, err
+	}
+	return selector, nil
+}
+
+// validate checks a decoded selector selects anything specific, its operators and path globs, field names the selector in errors
+func (selector *YttSelector) validate(field string) error {
+	if len(selector.Names) == 0 && len(selector.Namespaces) == 0 && len(selector.Kinds) == 0 && len(selector.APIVersions) == 0 &&
+		len(selector.Labels) == 0 && len(selector.Annotations) == 0 && len(selector.MatchExpressions) == 0 && len(selector.Paths) == 0 {
+		return fmt.Errorf("node %s is an empty selector, which would select every resource", field)
+	}
+	for _, expression := range selector.MatchExpressions {
+		switch expression.Operator {
+		case MatchOperatorIn, MatchOperatorNotIn, MatchOperatorExists, MatchOperatorDoesNotExist:
+		default:
+			return fmt.Errorf("node %s contains unknown operator: %s, expected one of: [In NotIn Exists DoesNotExist]", field, expression.Operator)
+		}
+	}
+	for _, glob := range selector.Paths {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("node %s contains invalid path glob: %s", field, glob)
+		}
+	}
+	return nil
+}
+
+// Matches checks whether item is selected
+func (selector *YttSelector) Matches(item *kyaml.RNode) bool {
+	frameworkSelector := selector.Selector
+	frameworkSelector.ResourceMatcher = func(item *kyaml.RNode) bool {
+		return selector.matchesExpressions(item) && selector.matchesPaths(item)
+	}
+	matched, err := frameworkSelector.Filter([]*kyaml.RNode{item})
+	return err == nil && len(matched) == 1
+}
+
+// matchesExpressions checks all MatchExpressions against labels of item
+func (selector *YttSelector) matchesExpressions(item *kyaml.RNode) bool {
+	labels := item.GetLabels()
+	for _, expression := range selector.MatchExpressions {
+		value, exists := labels[expression.Key]
+		switch expression.Operator {
+		case MatchOperatorIn:
+			if !exists || !contains(expression.Values, value) {
+				return false
+			}
+		case MatchOperatorNotIn:
+			if exists && contains(expression.Values, value) {
+				return false
+			}
+		case MatchOperatorExists:
+			if !exists {
+				return false
+			}
+		case MatchOperatorDoesNotExist:
+			if exists {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchesPaths checks whether the path annotation of item matches any of Paths, no Paths match all items
+func (selector *YttSelector) matchesPaths(item *kyaml.RNode) bool {
+	if len(selector.Paths) == 0 {
+		return true
+	}
+	annotations := item.GetAnnotations()
+	itemPath := annotations[kioutil.PathAnnotation]
+	if itemPath == "" {
+		itemPath = annotations[kioutil.LegacyPathAnnotation]
+	}
+	for _, glob := range selector.Paths {
+		if matched, _ := path.Match(glob, itemPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// contains checks whether values contains value
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
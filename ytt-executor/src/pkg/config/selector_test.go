@@ -0,0 +1,170 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestConfigureSelectors(t *testing.T) {
+	// Reset selectors after test
+	defer func() {
+		YttValuesSelector = nil
+		YttTemplateSelector = nil
+		YttSchemaSelector = nil
+		YttOutputSelector = nil
+	}()
+
+	// Execute configure
+	err := Configure(logger.NewCollector(), kyaml.MustParse(`
+input:
+  ciq_selector:
+    kinds: [ConfigMap]
+    labels: {role: ciq}
+  template_selector:
+    paths: [amf/templates/*.yaml]
+  schema_selector:
+    annotations: {ytt.io/schema: "true"}
+output:
+  selector:
+    apiVersions: [v1]
+    matchExpressions:
+      - {key: nf, operator: In, values: [amf, smf]}
+      - {key: legacy, operator: DoesNotExist}
+`))
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Assert decoded selectors
+	assert.Equal(t, []string{"ConfigMap"}, YttValuesSelector.Kinds)
+	assert.Equal(t, map[string]string{"role": "ciq"}, YttValuesSelector.Labels)
+	assert.Equal(t, []string{"amf/templates/*.yaml"}, YttTemplateSelector.Paths)
+	assert.Equal(t, map[string]string{"ytt.io/schema": "true"}, YttSchemaSelector.Annotations)
+	assert.Equal(t, []YttMatchExpression{
+		{Key: "nf", Operator: MatchOperatorIn, Values: []string{"amf", "smf"}},
+		{Key: "legacy", Operator: MatchOperatorDoesNotExist},
+	}, YttOutputSelector.MatchExpressions)
+
+	// Match resources against output selector
+	assert.True(t, YttOutputSelector.Matches(kyaml.MustParse(`
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: amf-config, labels: {nf: amf}}
+`)))
+	assert.False(t, YttOutputSelector.Matches(kyaml.MustParse(`
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: upf-config, labels: {nf: upf}}
+`)))
+	assert.False(t, YttOutputSelector.Matches(kyaml.MustParse(`
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: amf-legacy, labels: {nf: amf, legacy: "true"}}
+`)))
+	assert.False(t, YttOutputSelector.Matches(kyaml.MustParse(`
+apiVersion: apps/v1
+kind: ConfigMap
+metadata: {name: amf-config, labels: {nf: amf}}
+`)))
+}
+
+func TestConfigureSelectorErrors(t *testing.T) {
+	// Reset selectors after test
+	defer func() {
+		YttTemplateSelector = nil
+	}()
+
+	// Test structure
+	tests := []struct {
+		name          string
+		fnConfig      string
+		expectedError string
+	}{ // Test list
+
+		// Unknown operator
+		{
+			"Test fail on unknown match expression operator",
+			`
+input:
+  template_selector:
+    matchExpressions:
+      - {key: nf, operator: Equals, values: [amf]}
+`,
+			"node template_selector contains unknown operator: Equals, expected one of: [In NotIn Exists DoesNotExist]",
+		},
+
+		// Malformed glob
+		{
+			"Test fail on invalid path glob",
+			`
+input:
+  template_selector:
+    paths: ["amf/[templates"]
+`,
+			"node template_selector contains invalid path glob: amf/[templates",
+		},
+
+		// Selector given as a string
+		{
+			"Test fail on selector string",
+			`
+input:
+  template_selector: amf
+`,
+			"node template_selector is not a selector: yaml: unmarshal errors:\n  line 3: cannot unmarshal !!str `amf` into config.YttSelector",
+		},
+
+		// Misspelled key, which would otherwise leave a match-all selector
+		{
+			"Test fail on unknown selector key",
+			`
+input:
+  template_selector: {kind: YttTemplate}
+`,
+			"node template_selector contains unknown key: kind, expected one of: [names namespaces kinds apiVersions labels annotations matchExpressions paths]",
+		},
+
+		// Explicitly empty selectors
+		{
+			"Test fail on empty selector",
+			`
+input:
+  template_selector: {}
+`,
+			"node template_selector is an empty selector, which would select every resource",
+		},
+		{
+			"Test fail on empty output selector",
+			`
+output:
+  selector: {kinds: []}
+`,
+			"node selector is an empty selector, which would select every resource",
+		},
+	}
+
+	// Loop through tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Configure(logger.NewCollector(), kyaml.MustParse(tt.fnConfig))
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
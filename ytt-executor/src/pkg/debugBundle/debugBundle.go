@@ -0,0 +1,261 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package debugBundle captures the ytt input files, arguments and raw output of a render job,
+// so a render can be reproduced with plain ytt outside kpt
+package debugBundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Bundle layout and resource identifiers
+const (
+	ResourceTarget = "resource"          // debug.bundle value emitting a RenderDebugBundle resource instead of a tarball
+	Kind           = "RenderDebugBundle" // Kind of the emitted resource
+	APIVersion     = "v1alpha1"          // API version of the emitted resource
+	filesDir       = "files"             // Bundle directory of files written for ytt
+	sourcesDir     = "sources"           // Bundle directory of files fetched from outside the package
+	argsFile       = "args"              // Bundle file listing ytt arguments, one per line
+	scriptFile     = "ytt.sh"            // Bundle script running ytt on the bundled files
+	outputFile     = "output.yaml"       // Bundle file holding raw ytt output
+	errorFile      = "error.txt"         // Bundle file holding the render error
+)
+
+// Bundle debug artifacts of a single render job
+//
+// Job: name of the render job
+//
+// Args: ytt arguments with file paths relative to the bundle root
+//
+// Files: content of files passed to ytt by bundle path
+//
+// Output: raw ytt output
+//
+// Error: error the render job failed with, empty on success
+type Bundle struct {
+	Job    string
+	Args   []string
+	Files  map[string]string
+	Output bytes.Buffer
+	Error  string
+}
+
+// New starts an empty bundle of a render job
+func New(job string) *Bundle {
+	return &Bundle{Job: job, Files: map[string]string{}}
+}
+
+// AddArgs copies files passed to ytt as -f or --data-values-file arguments into the bundle
+// and records yttArgs with file paths rewritten to bundle paths
+//
+// Parameters:
+//   - yttArgs: ytt arguments, -f values may be given as <relative_name>=<file_name>
+//   - baseDir: directory templates were written to, its files keep their relative path under files/
+//
+// Returns:
+//   - error: from reading a file passed to ytt
+func (bundle *Bundle) AddArgs(yttArgs []string, baseDir string) error {
+	bundlePaths := map[string]string{}
+	for i := 0; i < len(yttArgs); i++ {
+		bundle.Args = append(bundle.Args, yttArgs[i])
+		if (yttArgs[i] != "-f" && yttArgs[i] != "--data-values-file") || i+1 >= len(yttArgs) {
+			continue
+		}
+		i++
+
+		// Split <relative_name>=<file_name> values
+		relativeName, fileName, named := strings.Cut(yttArgs[i], "=")
+		if !named {
+			fileName = relativeName
+		}
+
+		// Place each file once, package files by their path, fetched files in a directory of their own
+		bundlePath, found := bundlePaths[fileName]
+		if !found {
+			if relative, err := filepath.Rel(baseDir, fileName); err == nil && !strings.HasPrefix(relative, "..") {
+				bundlePath = path.Join(filesDir, filepath.ToSlash(relative))
+			} else {
+				bundlePath = path.Join(sourcesDir, strconv.Itoa(len(bundlePaths)), filepath.Base(fileName))
+			}
+			content, err := os.ReadFile(fileName)
+			if err != nil {
+				return fmt.Errorf("failed to add %s to debug bundle: %v", fileName, err)
+			}
+			bundle.Files[bundlePath] = string(content)
+			bundlePaths[fileName] = bundlePath
+		}
+
+		if named {
+			bundle.Args = append(bundle.Args, relativeName+"="+bundlePath)
+		} else {
+			bundle.Args = append(bundle.Args, bundlePath)
+		}
+	}
+	return nil
+}
+
+// Redact masks sensitive values in bundled files, output and error
+// A redacted bundle may need real values to reproduce renders depending on them
+func (bundle *Bundle) Redact(redactor *logger.Redactor) {
+	if redactor == nil {
+		return
+	}
+	for bundlePath, content := range bundle.Files {
+		bundle.Files[bundlePath] = redactor.Redact(content)
+	}
+	output := redactor.Redact(bundle.Output.String())
+	bundle.Output.Reset()
+	bundle.Output.WriteString(output)
+	bundle.Error = redactor.Redact(bundle.Error)
+}
+
+// script returns a shell script running ytt with bundle arguments from the bundle root
+func (bundle *Bundle) script() string {
+	quoted := make([]string, 0, len(bundle.Args))
+	for _, arg := range bundle.Args {
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+	return "#!/bin/sh\ncd \"$(dirname \"$0\")\" && exec ytt " + strings.Join(quoted, " ") + "\n"
+}
+
+// WriteTarball writes the bundle as gzip compressed tarball to fileName
+//
+// The tarball holds bundled files under files/ and sources/, ytt arguments in args, a ytt.sh script
+// running ytt on them, raw ytt output in output.yaml and the render error in error.txt
+func (bundle *Bundle) WriteTarball(fileName string) error {
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	// Collect entries in a stable order
+	entries := map[string]string{
+		argsFile:   strings.Join(bundle.Args, "\n") + "\n",
+		scriptFile: bundle.script(),
+		outputFile: bundle.Output.String(),
+	}
+	if bundle.Error != "" {
+		entries[errorFile] = bundle.Error + "\n"
+	}
+	for bundlePath, content := range bundle.Files {
+		entries[bundlePath] = content
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		mode := int64(0o644)
+		if name == scriptFile {
+			mode = 0o755
+		}
+		header := &tar.Header{Name: name, Mode: mode, Size: int64(len(entries[name])), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write debug bundle: %v", err)
+		}
+		if _, err := tarWriter.Write([]byte(entries[name])); err != nil {
+			return fmt.Errorf("failed to write debug bundle: %v", err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write debug bundle: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write debug bundle: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0o755); err != nil {
+		return fmt.Errorf("failed to write debug bundle: %v", err)
+	}
+	if err := os.WriteFile(fileName, buffer.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write debug bundle: %v", err)
+	}
+	return nil
+}
+
+// Resource returns the bundle as local config RenderDebugBundle resource written to debug/<job>.yaml
+func (bundle *Bundle) Resource() (*kyaml.RNode, error) {
+	resource := kyaml.NewMapRNode(nil)
+	resource.SetApiVersion(APIVersion)
+	resource.SetKind(Kind)
+	if err := resource.SetName(bundle.Job); err != nil {
+		return nil, err
+	}
+	resourcePath := path.Join("debug", bundle.Job+".yaml")
+	err := resource.SetAnnotations(map[string]string{
+		"config.kubernetes.io/local-config": "true",
+		kioutil.PathAnnotation:              resourcePath,
+		kioutil.LegacyPathAnnotation:        resourcePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Files ordered by bundle path, multi line strings as literal blocks
+	files := kyaml.NewMapRNode(nil)
+	for _, bundlePath := range bundle.filePaths() {
+		if err := files.PipeE(kyaml.SetField(bundlePath, literalString(bundle.Files[bundlePath]))); err != nil {
+			return nil, err
+		}
+	}
+	err = resource.PipeE(kyaml.SetField("args", kyaml.NewListRNode(bundle.Args...)))
+	if err != nil {
+		return nil, err
+	}
+	if err := resource.PipeE(kyaml.SetField("files", files)); err != nil {
+		return nil, err
+	}
+	if err := resource.PipeE(kyaml.SetField("output", literalString(bundle.Output.String()))); err != nil {
+		return nil, err
+	}
+	if bundle.Error != "" {
+		if err := resource.PipeE(kyaml.SetField("error", literalString(bundle.Error))); err != nil {
+			return nil, err
+		}
+	}
+	return resource, nil
+}
+
+// filePaths returns bundle paths of Files in order
+func (bundle *Bundle) filePaths() []string {
+	paths := make([]string, 0, len(bundle.Files))
+	for bundlePath := range bundle.Files {
+		paths = append(paths, bundlePath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// literalString returns value as string node, using a literal block for multi line values
+func literalString(value string) *kyaml.RNode {
+	node := kyaml.NewStringRNode(value)
+	if strings.Contains(value, "\n") {
+		node.YNode().Style = kyaml.LiteralStyle
+	}
+	return node
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debugBundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// sampleBundle bundle of a template and a values file written for ytt and a fetched library file
+func sampleBundle(t *testing.T) *Bundle {
+	baseDir := t.TempDir()
+	sourceDir := t.TempDir()
+	files := map[string]string{
+		filepath.Join(baseDir, "amf", "template.yaml"): "#@ load(\"@ytt:data\", \"data\")\n---\namf: #@ data.values.amf\n",
+		filepath.Join(baseDir, "values.yaml"):          "amf: 1\npassword: very-secret\n",
+		filepath.Join(sourceDir, "nf.lib.yml"):         "#@ def nf(): return 1\n",
+	}
+	for fileName, content := range files {
+		if err := os.MkdirAll(filepath.Dir(fileName), 0o755); err != nil {
+			t.Fatalf("failed to create input directory: %v", err)
+		}
+		if err := os.WriteFile(fileName, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write input file: %v", err)
+		}
+	}
+
+	bundle := New("amf-site-1")
+	err := bundle.AddArgs([]string{
+		"-f", filepath.Join(baseDir, "amf", "template.yaml"),
+		"--data-values-file", filepath.Join(baseDir, "values.yaml"),
+		"-f", "_ytt_lib/nflib/nf.lib.yml=" + filepath.Join(sourceDir, "nf.lib.yml"),
+		"--file-mark", "nf.lib.yml:type=data",
+	}, baseDir)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	bundle.Output.WriteString("amf: 1\n")
+	return bundle
+}
+
+func TestAddArgs(t *testing.T) {
+	bundle := sampleBundle(t)
+
+	// File paths are rewritten to bundle paths, other arguments are kept
+	assert.Equal(t, []string{
+		"-f", "files/amf/template.yaml",
+		"--data-values-file", "files/values.yaml",
+		"-f", "_ytt_lib/nflib/nf.lib.yml=sources/2/nf.lib.yml",
+		"--file-mark", "nf.lib.yml:type=data",
+	}, bundle.Args)
+	assert.Equal(t, []string{"files/amf/template.yaml", "files/values.yaml", "sources/2/nf.lib.yml"}, bundle.filePaths())
+
+	// Missing input files fail
+	err := New("amf-site-1").AddArgs([]string{"-f", "/nonexistent/template.yaml"}, "/nonexistent")
+	assert.ErrorContains(t, err, "failed to add /nonexistent/template.yaml to debug bundle")
+}
+
+func TestWriteTarball(t *testing.T) {
+	bundle := sampleBundle(t)
+	bundle.Error = "ytt: exit status 1"
+	fileName := filepath.Join(t.TempDir(), "debug", "amf.tar.gz")
+
+	// Execute function
+	if err := bundle.WriteTarball(fileName); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Read back tarball entries
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	entries := map[string]string{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+		content, _ := io.ReadAll(tarReader)
+		entries[header.Name] = string(content)
+	}
+
+	// Check files, arguments, script, output and error
+	assert.Len(t, entries, 7)
+	assert.Equal(t, "amf: 1\npassword: very-secret\n", entries["files/values.yaml"])
+	assert.Equal(t, "amf: 1\n", entries["output.yaml"])
+	assert.Equal(t, "ytt: exit status 1\n", entries["error.txt"])
+	assert.Contains(t, entries["args"], "--data-values-file\nfiles/values.yaml\n")
+	assert.Contains(t, entries["ytt.sh"], "exec ytt '-f' 'files/amf/template.yaml' '--data-values-file' 'files/values.yaml'")
+}
+
+func TestResource(t *testing.T) {
+	bundle := sampleBundle(t)
+
+	// Mask sensitive values before emitting the bundle
+	redactor, err := logger.NewRedactor([]string{"password"})
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	bundle.Redact(redactor)
+
+	// Execute function
+	resource, err := bundle.Resource()
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Check identity and fields
+	assert.Equal(t, Kind, resource.GetKind())
+	assert.Equal(t, "amf-site-1", resource.GetName())
+	assert.Equal(t, "debug/amf-site-1.yaml", resource.GetAnnotations()["config.kubernetes.io/path"])
+	assert.Equal(t, "true", resource.GetAnnotations()["config.kubernetes.io/local-config"])
+	values := resource.Field("files").Value.Field("files/values.yaml").Value.YNode().Value
+	assert.Equal(t, "amf: 1\npassword: <redacted>\n", values)
+	assert.Equal(t, "amf: 1\n", resource.Field("output").Value.YNode().Value)
+	assert.Nil(t, resource.Field("error"))
+}
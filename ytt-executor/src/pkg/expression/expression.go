@@ -0,0 +1,185 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package expression evaluates CEL expressions and JSONPath lookups against yaml documents
+package expression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Program a compiled CEL expression evaluating to a bool
+//
+// Expression: source of the expression, for messages
+type Program struct {
+	Expression string
+	program    cel.Program
+}
+
+// Compile compiles a CEL expression over variables of any type, e.g. self
+//
+// Parameters:
+//   - expression: CEL expression, e.g. self.data.replicas <= 3
+//   - variables: names of variables the expression may reference
+//
+// Returns:
+//   - *Program: compiled expression
+//   - error: when the expression is invalid or does not evaluate to a bool
+func Compile(expression string, variables ...string) (*Program, error) {
+	options := make([]cel.EnvOption, 0, len(variables))
+	for _, variable := range variables {
+		options = append(options, cel.Variable(variable, cel.DynType))
+	}
+	env, err := cel.NewEnv(options...)
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid expression %s: %v", expression, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("expression %s evaluates to %s, expected bool", expression, ast.OutputType())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %s: %v", expression, err)
+	}
+	return &Program{Expression: expression, program: program}, nil
+}
+
+// Eval evaluates the expression with variables
+//
+// Parameters:
+//   - variables: values of variables by name, as returned by ToValue
+//
+// Returns:
+//   - bool: result of the expression
+//   - error: when evaluation fails, e.g. on a missing field, or the result is not a bool
+func (program *Program) Eval(variables map[string]any) (bool, error) {
+	value, _, err := program.program.Eval(variables)
+	if err != nil {
+		return false, fmt.Errorf("expression %s failed: %v", program.Expression, err)
+	}
+	result, isBool := value.Value().(bool)
+	if !isBool {
+		return false, fmt.Errorf("expression %s evaluated to %v, expected bool", program.Expression, value.Value())
+	}
+	return result, nil
+}
+
+// ToValue converts node to plain maps, lists and scalars, as CEL expressions and Lookup expect them
+func ToValue(node *kyaml.RNode) (any, error) {
+	var value any
+	if node.IsNil() {
+		return nil, nil
+	}
+	if err := node.YNode().Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Lookup resolves a JSONPath to a single field of value, e.g. $.data['values.yaml'].amf or data.replicas
+// Supported are the root $, child names as .name or ['name'] and list indexes as [0]
+//
+// Parameters:
+//   - value: document as returned by ToValue
+//   - path: JSONPath of the field, the leading $ is optional
+//
+// Returns:
+//   - any: field value
+//   - bool: whether the field exists
+//   - error: when path is not a supported JSONPath
+func Lookup(value any, path string) (any, bool, error) {
+	segments, err := splitPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, segment := range segments {
+		switch current := value.(type) {
+		case map[string]any:
+			child, found := current[segment.name]
+			if segment.isIndex || !found {
+				return nil, false, nil
+			}
+			value = child
+		case []any:
+			if !segment.isIndex || segment.index >= len(current) {
+				return nil, false, nil
+			}
+			value = current[segment.index]
+		default:
+			return nil, false, nil
+		}
+	}
+	return value, true, nil
+}
+
+// pathSegment a child name or list index of a JSONPath
+type pathSegment struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// splitPath splits a JSONPath into its segments
+func splitPath(path string) ([]pathSegment, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var segments []pathSegment
+	for first := true; rest != ""; first = false {
+		switch {
+		case strings.HasPrefix(rest, "['") || strings.HasPrefix(rest, "[\""):
+			quote := rest[1:2]
+			end := strings.Index(rest[2:], quote+"]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %s: unterminated %s", path, rest)
+			}
+			segments = append(segments, pathSegment{name: rest[2 : end+2]})
+			rest = rest[end+4:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %s: unterminated %s", path, rest)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid path %s: %s is not a list index", path, rest[:end+1])
+			}
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+			rest = rest[end+1:]
+		default:
+			if strings.HasPrefix(rest, ".") {
+				rest = rest[1:]
+			} else if !first {
+				return nil, fmt.Errorf("invalid path %s: expected . or [ before %s", path, rest)
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid path %s: empty name", path)
+			}
+			segments = append(segments, pathSegment{name: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+	return segments, nil
+}
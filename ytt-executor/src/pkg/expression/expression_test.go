@@ -0,0 +1,173 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expression
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const document = `
+kind: ConfigMap
+data:
+  values.yaml:
+    amf:
+      replicas: 2
+      plmn: [{mcc: "001", mnc: "01"}]
+`
+
+func TestProgramEval(t *testing.T) {
+	self, err := ToValue(kyaml.MustParse(document))
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Test structure
+	tests := []struct {
+		name        string
+		expression  string
+		expected    bool
+		expectedErr string
+	}{ // Test list
+
+		// Map keys with dots are indexed
+		{
+			"Test true expression",
+			"self.data['values.yaml'].amf.replicas <= 3",
+			true,
+			"",
+		},
+
+		// Lists and string functions
+		{
+			"Test false expression",
+			"self.data['values.yaml'].amf.plmn.all(p, p.mcc.startsWith('9'))",
+			false,
+			"",
+		},
+
+		// Missing fields fail evaluation
+		{
+			"Test missing field",
+			"self.data.missing == 1",
+			false,
+			"expression self.data.missing == 1 failed: no such key: missing",
+		},
+
+		// Syntax errors are reported on compile
+		{
+			"Test invalid expression",
+			"self.data ==",
+			false,
+			"invalid expression self.data ==",
+		},
+
+		// Expressions must evaluate to bool
+		{
+			"Test non bool expression",
+			"1 + 2",
+			false,
+			"expression 1 + 2 evaluates to int, expected bool",
+		},
+
+		// Undeclared variables
+		{
+			"Test unknown variable",
+			"other.data == 1",
+			false,
+			"undeclared reference to 'other'",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Execute function
+			program, err := Compile(tt.expression, "self")
+			var got bool
+			if err == nil {
+				got, err = program.Eval(map[string]any{"self": self})
+			}
+
+			// Assert response
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	value, err := ToValue(kyaml.MustParse(document))
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Test structure
+	tests := []struct {
+		name          string
+		path          string
+		expected      any
+		expectedFound bool
+		expectedErr   string
+	}{ // Test list
+
+		// JSONPath with root, quoted names and indexes
+		{"Test JSONPath", "$.data['values.yaml'].amf.plmn[0].mcc", "001", true, ""},
+
+		// Dotted paths without root
+		{"Test dotted path", "kind", "ConfigMap", true, ""},
+
+		// Double quoted names
+		{"Test double quoted name", `$["data"]["values.yaml"].amf.replicas`, 2, true, ""},
+
+		// Maps are returned whole
+		{"Test map value", "$.data['values.yaml'].amf.plmn[0]", map[string]any{"mcc": "001", "mnc": "01"}, true, ""},
+
+		// Missing fields, indexes and indexes of maps
+		{"Test missing field", "$.data.missing", nil, false, ""},
+		{"Test missing index", "$.data['values.yaml'].amf.plmn[1]", nil, false, ""},
+		{"Test index of map", "$.data[0]", nil, false, ""},
+
+		// Unsupported syntax
+		{"Test unterminated name", "$.data['values.yaml", nil, false, "unterminated"},
+		{"Test filter", "$.data[?(@.a)]", nil, false, "is not a list index"},
+		{"Test empty name", "$.data..amf", nil, false, "empty name"},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Execute function
+			got, found, err := Lookup(value, tt.path)
+
+			// Assert response
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedFound, found)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
@@ -20,7 +20,6 @@ import (
 	"os"
 	"testing"
 
-	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/commandExec"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -108,8 +107,9 @@ func TestWriteToFileBasic(t *testing.T) {
 
 			// Check if expected content was provided and then compare it
 			if len(tt.expectedContent) > 0 {
-				cat := commandExec.CatFile(tempDir + "/" + tt.args.filePath)
-				assert.Equal(t, tt.expectedContent, cat)
+				content, err := os.ReadFile(tempDir + "/" + tt.args.filePath)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedContent, string(content))
 			}
 		})
 	}
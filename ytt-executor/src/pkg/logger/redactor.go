@@ -0,0 +1,154 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces sensitive values in logs
+const RedactedValue = "<redacted>"
+
+// minRedactedValueLength shorter values are too generic to be replaced wherever they appear
+const minRedactedValueLength = 4
+
+// keyValueLine matches `key: value`, `"key": value` and `key=value` lines of yaml, json and properties text
+var keyValueLine = regexp.MustCompile(`^(\s*(?:-\s+)?"?)([^\s:"=#]+)("?\s*[:=])(.*)$`)
+
+// Redactor masks values of sensitive fields in log messages and details
+//
+// patterns: key patterns marking a field as sensitive
+//
+// keys: key names marked sensitive by schemas
+//
+// values: known sensitive values replaced wherever they appear
+type Redactor struct {
+	patterns []*regexp.Regexp
+	keys     map[string]bool
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+// NewRedactor creates a Redactor treating keys matching any of patterns as sensitive
+//
+// Parameters:
+//   - patterns: regular expressions matched against key names
+//
+// Returns:
+//   - *Redactor: redactor without known keys or values
+//   - error: when a pattern is not a valid regular expression
+func NewRedactor(patterns []string) (*Redactor, error) {
+	redactor := &Redactor{keys: map[string]bool{}, values: map[string]bool{}}
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact key pattern: %s, %v", pattern, err)
+		}
+		redactor.patterns = append(redactor.patterns, compiled)
+	}
+	return redactor, nil
+}
+
+// AddKey marks key as sensitive, e.g. a field annotated #@schema/sensitive
+func (redactor *Redactor) AddKey(key string) {
+	redactor.keys[key] = true
+}
+
+// AddValue registers a sensitive value to be replaced wherever it appears
+func (redactor *Redactor) AddValue(value string) {
+	if len(value) < minRedactedValueLength || redactor.values[value] {
+		return
+	}
+	redactor.values[value] = true
+	redactor.replacer = nil
+}
+
+// IsSensitiveKey checks if key, or the last segment of a dotted key, is sensitive
+func (redactor *Redactor) IsSensitiveKey(key string) bool {
+	if index := strings.LastIndex(key, "."); index >= 0 {
+		key = key[index+1:]
+	}
+	if redactor.keys[key] {
+		return true
+	}
+	for _, pattern := range redactor.patterns {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact masks sensitive values in text
+//
+// Values of sensitive keys are masked line by line, including nested blocks below them,
+// afterwards known sensitive values are replaced anywhere in text
+//
+// Parameters:
+//   - text: log message or detail
+//
+// Returns:
+//   - string: text with sensitive values replaced by RedactedValue
+func (redactor *Redactor) Redact(text string) string {
+	lines := strings.Split(text, "\n")
+	redacted := make([]string, 0, len(lines))
+	blockIndent := -1
+	for _, line := range lines {
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		// Skip block scalars and nested values below a sensitive key
+		if blockIndent >= 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || indent > blockIndent || (indent == blockIndent && strings.HasPrefix(trimmed, "- ")) {
+				continue
+			}
+			blockIndent = -1
+		}
+
+		match := keyValueLine.FindStringSubmatch(line)
+		if match == nil || !redactor.IsSensitiveKey(match[2]) {
+			redacted = append(redacted, line)
+			continue
+		}
+		value := strings.TrimSpace(match[4])
+		if value == "" || strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			blockIndent = indent
+		}
+		redacted = append(redacted, match[1]+match[2]+match[3]+" "+RedactedValue)
+	}
+	return redactor.valueReplacer().Replace(strings.Join(redacted, "\n"))
+}
+
+// valueReplacer replaces known values, longest first so values containing others are fully masked
+func (redactor *Redactor) valueReplacer() *strings.Replacer {
+	if redactor.replacer == nil {
+		values := make([]string, 0, len(redactor.values))
+		for value := range redactor.values {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			return len(values[i]) > len(values[j])
+		})
+		replacements := make([]string, 0, len(values)*2)
+		for _, value := range values {
+			replacements = append(replacements, value, RedactedValue)
+		}
+		redactor.replacer = strings.NewReplacer(replacements...)
+	}
+	return redactor.replacer
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactorRedact(t *testing.T) {
+	// Redactor with a key pattern, a schema key and a known value
+	redactor, err := NewRedactor([]string{"(?i)password"})
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	redactor.AddKey("nrfToken")
+	redactor.AddValue("s3cr3t-value")
+
+	// Test structure
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{ // Test List
+
+		// Yaml value of pattern key
+		{
+			"Redact yaml key matching pattern",
+			"db:\n  host: db.local\n  adminPassword: hunter22\n",
+			"db:\n  host: db.local\n  adminPassword: <redacted>\n",
+		},
+
+		// Block scalar and nested map below schema key
+		{
+			"Redact block below schema key",
+			"nrfToken: |\n  line1\n  line2\nnext: value\nnrfToken:\n  inner: value\nlast: value",
+			"nrfToken: <redacted>\nnext: value\nnrfToken: <redacted>\nlast: value",
+		},
+
+		// Json and properties
+		{
+			"Redact json and properties keys",
+			"{\n  \"password\": \"hunter22\",\n  \"user\": \"admin\"\n}\namf.db.password=hunter22",
+			"{\n  \"password\": <redacted>\n  \"user\": \"admin\"\n}\namf.db.password= <redacted>",
+		},
+
+		// Known value in free text
+		{
+			"Redact known value in message",
+			"ytt: expected int, got s3cr3t-value",
+			"ytt: expected int, got <redacted>",
+		},
+
+		// Nothing sensitive
+		{
+			"Keep text without sensitive values",
+			"name: amf\nreplicas: 2",
+			"name: amf\nreplicas: 2",
+		},
+	}
+
+	// Loop through tests
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, redactor.Redact(tt.text))
+		})
+	}
+}
+
+func TestRedactorShortValues(t *testing.T) {
+	// Short values are too generic to replace everywhere
+	redactor, _ := NewRedactor(nil)
+	redactor.AddValue("abc")
+	assert.Equal(t, "abc", redactor.Redact("abc"))
+}
+
+func TestNewRedactorInvalidPattern(t *testing.T) {
+	_, err := NewRedactor([]string{"(password"})
+	assert.EqualError(t, err, "invalid redact key pattern: (password, error parsing regexp: missing closing ): `(password`")
+}
+
+func TestCollectorRedaction(t *testing.T) {
+	// Collector masking values of password keys
+	redactor, _ := NewRedactor([]string{"password"})
+	redactor.AddValue("hunter22")
+	collector := NewCollector()
+	collector.Redactor = redactor
+
+	details := map[string]string{"kyaml": "password: hunter22\n", "password": "plain"}
+	collector.LogDetailedError("Login failed for hunter22", details)
+
+	// Message and details are masked, given details are left untouched
+	assert.Equal(t, "Login failed for <redacted>", collector.Results[0].Message)
+	assert.Equal(t, map[string]string{"kyaml": "password: <redacted>\n", "password": RedactedValue}, collector.Results[0].Tags)
+	assert.Equal(t, "plain", details["password"])
+}
@@ -15,17 +15,17 @@
 package logger
 
 import (
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
 	"strings"
 
 	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
-// LogLevel Default log level to use
-var LogLevel = LogLevelInfo
-
-// LogStack list of framework.Result items to output as kpt log
-var LogStack framework.Results
-
 // LogLevel enum as a string representation
 var LogLevelStrings = []string{"DEBUG", "INFO", "WARNING", "ERROR"}
 
@@ -39,76 +39,216 @@ const (
 	LogLevelError
 )
 
+// Collector collects framework.Result items of a single function run to output as kpt log,
+// and optionally writes them as structured logs to Stderr, see EnableStderr
+//
+// LogLevel: minimum level of results to collect
+//
+// Results: collected results
+//
+// RunID: random identifier of the run added to every stderr log
+//
+// Stderr: writer for structured logs, os.Stderr by default
+//
+// Redactor: masks sensitive values in messages and details of every log, nil to disable
+type Collector struct {
+	LogLevel logLevels
+	Results  framework.Results
+	RunID    string
+	Stderr   io.Writer
+	Redactor *Redactor
+
+	stderr *slog.Logger
+}
+
+// Reference identifies the resource and field a result applies to, so kpt can display it against them
+//
+// Item: resource the result applies to, its file path and index are read from its annotations
+//
+// Field: path of the field inside Item, e.g. data.values, empty for the whole resource
+type Reference struct {
+	Item  *kyaml.RNode
+	Field string
+}
+
+// NewCollector creates a Collector for a single function run with LogLevelInfo and stderr logs disabled
+func NewCollector() *Collector {
+	return &Collector{LogLevel: LogLevelInfo, RunID: newRunID(), Stderr: os.Stderr}
+}
+
 // SetLogLevel changes log level to one of the following: LogLevelStrings
-func SetLogLevel(logLevel string) {
+func (collector *Collector) SetLogLevel(logLevel string) {
+	if level, found := parseLogLevel(logLevel); found {
+		collector.LogLevel = level
+	}
+}
+
+// parseLogLevel returns logLevels matching one of the following: LogLevelStrings
+func parseLogLevel(logLevel string) (logLevels, bool) {
 	for i, levelString := range LogLevelStrings {
 		if levelString == strings.ToUpper(logLevel) {
-			LogLevel = logLevels(i)
+			return logLevels(i), true
 		}
 	}
+	return LogLevelInfo, false
 }
 
-// LogDetailed appends framework.Result to LogStack with given logLevel, message and nullable detailed map
+// LogReferenced appends framework.Result to Results with given logLevel, message, reference and nullable detailed map
+// and writes it to Stderr when enabled, after masking sensitive values with Redactor
 //
 // Parameters:
 //   - level: filter log saving based on current LogLevel, level has to be greater or equal to current one.
 //   - message: main message of the log
+//   - reference: resource and field the log applies to, empty Reference for none
 //   - detailed: extra map for details, nullable
-func LogDetailed(level logLevels, message string, detailed map[string]string) {
-	if level >= LogLevel {
-		LogStack = append(LogStack, &framework.Result{
-			Message:  message,
-			Severity: framework.Severity(LogLevelStrings[level]),
-			Tags:     detailed,
-		})
+func (collector *Collector) LogReferenced(level logLevels, message string, reference Reference, detailed map[string]string) {
+	if level < collector.LogLevel && collector.stderr == nil {
+		return
+	}
+	message, detailed = collector.redact(message, detailed)
+	result := &framework.Result{
+		Message:  message,
+		Severity: framework.Severity(LogLevelStrings[level]),
+		Tags:     detailed,
+	}
+
+	// Resolve resource and file details of referenced item
+	if reference.Item != nil {
+		result.ResourceRef = &kyaml.ResourceIdentifier{
+			TypeMeta: kyaml.TypeMeta{
+				APIVersion: reference.Item.GetApiVersion(),
+				Kind:       reference.Item.GetKind(),
+			},
+			NameMeta: kyaml.NameMeta{
+				Name:      reference.Item.GetName(),
+				Namespace: reference.Item.GetNamespace(),
+			},
+		}
+		filePath, fileIndex := referenceFile(reference.Item)
+		if filePath != "" {
+			result.File = &framework.File{Path: filePath, Index: fileIndex}
+		}
+	}
+	if reference.Field != "" {
+		result.Field = &framework.Field{Path: reference.Field}
+	}
+
+	// Stderr filters by its own level
+	collector.writeStderr(level, result)
+	if level >= collector.LogLevel {
+		collector.Results = append(collector.Results, result)
 	}
 }
 
+// redact masks sensitive values of message and a copy of detailed when a Redactor is set
+func (collector *Collector) redact(message string, detailed map[string]string) (string, map[string]string) {
+	if collector.Redactor == nil {
+		return message, detailed
+	}
+	var redactedDetails map[string]string
+	if detailed != nil {
+		redactedDetails = make(map[string]string, len(detailed))
+		for key, value := range detailed {
+			if collector.Redactor.IsSensitiveKey(key) {
+				redactedDetails[key] = RedactedValue
+			} else {
+				redactedDetails[key] = collector.Redactor.Redact(value)
+			}
+		}
+	}
+	return collector.Redactor.Redact(message), redactedDetails
+}
+
+// referenceFile reads file path and index of item from its kpt annotations
+func referenceFile(item *kyaml.RNode) (filePath string, fileIndex int) {
+	annotations := item.GetAnnotations()
+	filePath = annotations[kioutil.PathAnnotation]
+	if filePath == "" {
+		filePath = annotations[kioutil.LegacyPathAnnotation]
+	}
+	index := annotations[kioutil.IndexAnnotation]
+	if index == "" {
+		index = annotations[kioutil.LegacyIndexAnnotation]
+	}
+	fileIndex, _ = strconv.Atoi(index)
+	return filePath, fileIndex
+}
+
+// LogDetailed call to LogReferenced without reference
+//
+// Parameters:
+//   - level: filter log saving based on current LogLevel, level has to be greater or equal to current one.
+//   - message: main message of the log
+//   - detailed: extra map for details, nullable
+func (collector *Collector) LogDetailed(level logLevels, message string, detailed map[string]string) {
+	collector.LogReferenced(level, message, Reference{}, detailed)
+}
+
 // Log call to LogDetailed with only level and message, leaving detailed = nil
 //
 // Parameters:
 //   - level: filter log saving based on current LogLevel, level has to be greater or equal to current one.
 //   - message: main message of the log
-func Log(level logLevels, message string) {
-	LogDetailed(level, message, nil)
+func (collector *Collector) Log(level logLevels, message string) {
+	collector.LogDetailed(level, message, nil)
 }
 
 // LogDebug shorter hand reference for debug Log
-func LogDebug(message string) {
-	Log(LogLevelDebug, message)
+func (collector *Collector) LogDebug(message string) {
+	collector.Log(LogLevelDebug, message)
 }
 
 // LogDetailedDebug shorter hand reference for debug LogDetailed
-func LogDetailedDebug(message string, detailed map[string]string) {
-	LogDetailed(LogLevelDebug, message, detailed)
+func (collector *Collector) LogDetailedDebug(message string, detailed map[string]string) {
+	collector.LogDetailed(LogLevelDebug, message, detailed)
+}
+
+// LogReferencedDebug shorter hand reference for debug LogReferenced
+func (collector *Collector) LogReferencedDebug(message string, reference Reference, detailed map[string]string) {
+	collector.LogReferenced(LogLevelDebug, message, reference, detailed)
 }
 
 // LogInfo shorter hand reference for info Log
-func LogInfo(message string) {
-	Log(LogLevelInfo, message)
+func (collector *Collector) LogInfo(message string) {
+	collector.Log(LogLevelInfo, message)
 }
 
 // LogDetailedInfo shorter hand reference for info LogDetailed
-func LogDetailedInfo(message string, detailed map[string]string) {
-	LogDetailed(LogLevelInfo, message, detailed)
+func (collector *Collector) LogDetailedInfo(message string, detailed map[string]string) {
+	collector.LogDetailed(LogLevelInfo, message, detailed)
+}
+
+// LogReferencedInfo shorter hand reference for info LogReferenced
+func (collector *Collector) LogReferencedInfo(message string, reference Reference, detailed map[string]string) {
+	collector.LogReferenced(LogLevelInfo, message, reference, detailed)
 }
 
 // LogWarning shorter hand reference for warning Log
-func LogWarning(message string) {
-	Log(LogLevelWarning, message)
+func (collector *Collector) LogWarning(message string) {
+	collector.Log(LogLevelWarning, message)
 }
 
 // LogDetailedWarning shorter hand reference for warning LogDetailed
-func LogDetailedWarning(message string, detailed map[string]string) {
-	LogDetailed(LogLevelWarning, message, detailed)
+func (collector *Collector) LogDetailedWarning(message string, detailed map[string]string) {
+	collector.LogDetailed(LogLevelWarning, message, detailed)
+}
+
+// LogReferencedWarning shorter hand reference for warning LogReferenced
+func (collector *Collector) LogReferencedWarning(message string, reference Reference, detailed map[string]string) {
+	collector.LogReferenced(LogLevelWarning, message, reference, detailed)
 }
 
 // LogError shorter hand reference for error Log
-func LogError(message string) {
-	Log(LogLevelError, message)
+func (collector *Collector) LogError(message string) {
+	collector.Log(LogLevelError, message)
 }
 
 // LogDetailedError shorter hand reference for error LogDetailed
-func LogDetailedError(message string, detailed map[string]string) {
-	LogDetailed(LogLevelError, message, detailed)
+func (collector *Collector) LogDetailedError(message string, detailed map[string]string) {
+	collector.LogDetailed(LogLevelError, message, detailed)
+}
+
+// LogReferencedError shorter hand reference for error LogReferenced
+func (collector *Collector) LogReferencedError(message string, reference Reference, detailed map[string]string) {
+	collector.LogReferenced(LogLevelError, message, reference, detailed)
 }
@@ -18,10 +18,10 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
-var logStackIndex int = 0
-
 func TestSetLogLevel(t *testing.T) {
 	// Function arguments
 	type args struct {
@@ -71,14 +71,15 @@ func TestSetLogLevel(t *testing.T) {
 		},
 	}
 
-	// Loop through tests
+	// Loop through tests, sharing one collector so unknown levels keep the previous one
+	collector := NewCollector()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Execute function
-			SetLogLevel(tt.args.logLevel)
+			collector.SetLogLevel(tt.args.logLevel)
 
 			// Check if log Level was set successfully
-			assert.Equal(t, tt.expectedLog, LogLevel)
+			assert.Equal(t, tt.expectedLog, collector.LogLevel)
 		})
 	}
 }
@@ -92,35 +93,35 @@ func TestLog(t *testing.T) {
 	// Test structure
 	tests := []struct {
 		name          string
-		logType       func(string)
+		logType       func(*Collector, string)
 		expectedLevel logLevels
 		args          args
 	}{ // Test List
 
 		{
 			"Log error",
-			LogError,
+			(*Collector).LogError,
 			LogLevelError,
 			args{"Basic ERROR log"},
 		},
 
 		{
 			"Log warning",
-			LogWarning,
+			(*Collector).LogWarning,
 			LogLevelWarning,
 			args{"Basic WARNING log"},
 		},
 
 		{
 			"Log info",
-			LogInfo,
+			(*Collector).LogInfo,
 			LogLevelInfo,
 			args{"Basic INFO log"},
 		},
 
 		{
 			"Log debug",
-			LogDebug,
+			(*Collector).LogDebug,
 			LogLevelDebug,
 			args{"Basic DEBUG log"},
 		},
@@ -128,20 +129,20 @@ func TestLog(t *testing.T) {
 
 	// Test loop
 	for _, tt := range tests {
-		if t.Run(tt.name, func(t *testing.T) {
-			tt.logType(tt.args.message)
+		t.Run(tt.name, func(t *testing.T) {
+			collector := NewCollector()
+			collector.SetLogLevel("DEBUG")
+			tt.logType(collector, tt.args.message)
 
-			// Compare expected logLevel to LogLevel saved
-			assert.Equal(t, LogLevelStrings[tt.expectedLevel], string(LogStack[logStackIndex].Severity))
+			// Check exactly one log was collected
+			assert.Equal(t, 1, len(collector.Results))
 
-			// Compare message expected to message in LogStack
-			assert.Equal(t, tt.args.message, LogStack[logStackIndex].Message)
+			// Compare expected logLevel to LogLevel saved
+			assert.Equal(t, LogLevelStrings[tt.expectedLevel], string(collector.Results[0].Severity))
 
-			// Check total logs collected to be +1 to current loop
-			assert.Equal(t, logStackIndex+1, len(LogStack))
-		}) {
-			logStackIndex++
-		}
+			// Compare message expected to message in Results
+			assert.Equal(t, tt.args.message, collector.Results[0].Message)
+		})
 	}
 }
 
@@ -155,14 +156,14 @@ func TestLogDetailed(t *testing.T) {
 	// Test structure
 	tests := []struct {
 		name          string
-		logType       func(string, map[string]string)
+		logType       func(*Collector, string, map[string]string)
 		expectedLevel logLevels
 		args          args
 	}{ // Test List
 
 		{
 			"Log detailed error",
-			LogDetailedError,
+			(*Collector).LogDetailedError,
 			LogLevelError,
 			args{
 				"Detailed ERROR log",
@@ -172,7 +173,7 @@ func TestLogDetailed(t *testing.T) {
 
 		{
 			"Log detailed warning",
-			LogDetailedWarning,
+			(*Collector).LogDetailedWarning,
 			LogLevelWarning,
 			args{
 				"Detailed WARNING log",
@@ -182,7 +183,7 @@ func TestLogDetailed(t *testing.T) {
 
 		{
 			"Log detailed info",
-			LogDetailedInfo,
+			(*Collector).LogDetailedInfo,
 			LogLevelInfo,
 			args{
 				"Detailed INFO log",
@@ -192,7 +193,7 @@ func TestLogDetailed(t *testing.T) {
 
 		{
 			"Log detailed Debug",
-			LogDetailedDebug,
+			(*Collector).LogDetailedDebug,
 			LogLevelDebug,
 			args{
 				"Detailed DEBUG log",
@@ -201,24 +202,108 @@ func TestLogDetailed(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
-		if t.Run(tt.name, func(t *testing.T) {
-			tt.logType(tt.args.message, tt.args.detailed)
+		t.Run(tt.name, func(t *testing.T) {
+			collector := NewCollector()
+			collector.SetLogLevel("DEBUG")
+			tt.logType(collector, tt.args.message, tt.args.detailed)
+
+			// Check exactly one log was collected
+			assert.Equal(t, 1, len(collector.Results))
 
 			// Compare expected logLevel to LogLevel saved
-			assert.Equal(t, LogLevelStrings[tt.expectedLevel], string(LogStack[logStackIndex].Severity))
+			assert.Equal(t, LogLevelStrings[tt.expectedLevel], string(collector.Results[0].Severity))
 
-			// Compare message expected to message in LogStack
-			assert.Equal(t, tt.args.message, LogStack[logStackIndex].Message)
+			// Compare message expected to message in Results
+			assert.Equal(t, tt.args.message, collector.Results[0].Message)
 
 			// Check details
-			assert.Equal(t, tt.args.detailed, LogStack[logStackIndex].Tags)
-
-			// Check total logs collected to be +1 to current loop
-			assert.Equal(t, logStackIndex+1, len(LogStack))
-		}) {
-			logStackIndex++
-		}
+			assert.Equal(t, tt.args.detailed, collector.Results[0].Tags)
+		})
 	}
 }
 
-// TODO: add a test to capture logLevel filtering
+func TestLogLevelFiltering(t *testing.T) {
+	// Collector only keeping warnings and errors
+	collector := NewCollector()
+	collector.SetLogLevel("WARNING")
+
+	collector.LogDebug("Filtered DEBUG log")
+	collector.LogInfo("Filtered INFO log")
+	collector.LogWarning("Kept WARNING log")
+	collector.LogError("Kept ERROR log")
+
+	// Check only logs at or above level were collected
+	assert.Equal(t, 2, len(collector.Results))
+	assert.Equal(t, "Kept WARNING log", collector.Results[0].Message)
+	assert.Equal(t, "Kept ERROR log", collector.Results[1].Message)
+}
+
+func TestLogReferenced(t *testing.T) {
+	// Sample resource read by kpt
+	item := kyaml.MustParse(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: amf-values
+  namespace: free5gc
+  annotations:
+    internal.config.kubernetes.io/path: values/amf.yaml
+    internal.config.kubernetes.io/index: '1'
+`)
+
+	// Test structure
+	tests := []struct {
+		name             string
+		reference        Reference
+		expectedResource *kyaml.ResourceIdentifier
+		expectedFile     *framework.File
+		expectedField    *framework.Field
+	}{ // Test List
+
+		// Resource, file and field
+		{
+			"Log referencing resource field",
+			Reference{Item: item, Field: "data.values"},
+			&kyaml.ResourceIdentifier{
+				TypeMeta: kyaml.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				NameMeta: kyaml.NameMeta{Name: "amf-values", Namespace: "free5gc"},
+			},
+			&framework.File{Path: "values/amf.yaml", Index: 1},
+			&framework.Field{Path: "data.values"},
+		},
+
+		// Whole resource
+		{
+			"Log referencing resource",
+			Reference{Item: item},
+			&kyaml.ResourceIdentifier{
+				TypeMeta: kyaml.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				NameMeta: kyaml.NameMeta{Name: "amf-values", Namespace: "free5gc"},
+			},
+			&framework.File{Path: "values/amf.yaml", Index: 1},
+			nil,
+		},
+
+		// No reference
+		{
+			"Log without reference",
+			Reference{},
+			nil,
+			nil,
+			nil,
+		},
+	}
+
+	// Test loop
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := NewCollector()
+			collector.LogReferencedError("Referenced ERROR log", tt.reference, nil)
+
+			// Check references of collected log
+			assert.Equal(t, 1, len(collector.Results))
+			assert.Equal(t, tt.expectedResource, collector.Results[0].ResourceRef)
+			assert.Equal(t, tt.expectedFile, collector.Results[0].File)
+			assert.Equal(t, tt.expectedField, collector.Results[0].Field)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+)
+
+// StderrFormatStrings structured stderr log formats as a string representation
+var StderrFormatStrings = []string{"json", "logfmt"}
+
+// slogLevels slog.Level matching each of logLevels
+var slogLevels = []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+// EnableStderr starts writing every log at or above level to Stderr as structured logs,
+// independently of LogLevel filtering results
+//
+// Parameters:
+//   - level: one of LogLevelStrings
+//   - format: one of StderrFormatStrings
+//
+// Returns:
+//   - error: when level or format is unknown
+func (collector *Collector) EnableStderr(level string, format string) error {
+	stderrLevel, found := parseLogLevel(level)
+	if !found {
+		return fmt.Errorf("unknown stderr log level: %s, expected one of: %v", level, LogLevelStrings)
+	}
+
+	options := &slog.HandlerOptions{
+		Level: slogLevels[stderrLevel],
+		// Print the same level names as results
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.LevelKey && len(groups) == 0 {
+				for i, slogLevel := range slogLevels {
+					if attr.Value.Any() == slogLevel {
+						return slog.String(slog.LevelKey, LogLevelStrings[i])
+					}
+				}
+			}
+			return attr
+		},
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(collector.Stderr, options)
+	case "logfmt":
+		handler = slog.NewTextHandler(collector.Stderr, options)
+	default:
+		return fmt.Errorf("unknown stderr log format: %s, expected one of: %v", format, StderrFormatStrings)
+	}
+	collector.stderr = slog.New(handler).With("run_id", collector.RunID)
+	return nil
+}
+
+// writeStderr writes result as structured log to Stderr when enabled
+//
+// Parameters:
+//   - level: level of the log
+//   - result: framework.Result holding message, references and details of the log
+func (collector *Collector) writeStderr(level logLevels, result *framework.Result) {
+	if collector.stderr == nil {
+		return
+	}
+
+	var attrs []slog.Attr
+	if result.ResourceRef != nil {
+		attrs = append(attrs,
+			slog.String("api_version", result.ResourceRef.APIVersion),
+			slog.String("kind", result.ResourceRef.Kind),
+			slog.String("name", result.ResourceRef.Name),
+		)
+		if result.ResourceRef.Namespace != "" {
+			attrs = append(attrs, slog.String("namespace", result.ResourceRef.Namespace))
+		}
+	}
+	if result.File != nil {
+		attrs = append(attrs, slog.String("file", result.File.Path), slog.Int("index", result.File.Index))
+	}
+	if result.Field != nil {
+		attrs = append(attrs, slog.String("field", result.Field.Path))
+	}
+
+	// Details in stable order
+	if len(result.Tags) > 0 {
+		keys := make([]string, 0, len(result.Tags))
+		for key := range result.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		details := make([]any, 0, len(keys))
+		for _, key := range keys {
+			details = append(details, slog.String(key, result.Tags[key]))
+		}
+		attrs = append(attrs, slog.Group("details", details...))
+	}
+
+	collector.stderr.LogAttrs(context.Background(), slogLevels[level], result.Message, attrs...)
+}
+
+// newRunID generates a random identifier to correlate stderr logs of a single run
+func newRunID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
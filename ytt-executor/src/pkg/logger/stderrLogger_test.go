@@ -0,0 +1,93 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestEnableStderrJson(t *testing.T) {
+	// Collector keeping only errors in results while writing debug logs to stderr
+	var stderr bytes.Buffer
+	collector := NewCollector()
+	collector.Stderr = &stderr
+	collector.SetLogLevel("ERROR")
+	if err := collector.EnableStderr("debug", "json"); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	item := kyaml.MustParse(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: amf-values
+  annotations:
+    internal.config.kubernetes.io/path: values/amf.yaml
+`)
+	collector.LogReferencedDebug("Writing file", Reference{Item: item, Field: "data"}, map[string]string{"file": "amf.yaml"})
+
+	// Debug log never reaches results
+	assert.Equal(t, 0, len(collector.Results))
+
+	// Debug log is written to stderr with timestamp, run id and references
+	var record map[string]any
+	if err := json.Unmarshal(stderr.Bytes(), &record); err != nil {
+		t.Fatalf("stderr log is not json: %v, %s", err, stderr.String())
+	}
+	assert.Equal(t, "DEBUG", record["level"])
+	assert.Equal(t, "Writing file", record["msg"])
+	assert.Equal(t, collector.RunID, record["run_id"])
+	assert.Equal(t, "ConfigMap", record["kind"])
+	assert.Equal(t, "amf-values", record["name"])
+	assert.Equal(t, "values/amf.yaml", record["file"])
+	assert.Equal(t, "data", record["field"])
+	assert.Equal(t, map[string]any{"file": "amf.yaml"}, record["details"])
+	_, err := time.Parse(time.RFC3339Nano, record["time"].(string))
+	assert.NoError(t, err)
+}
+
+func TestEnableStderrLogfmt(t *testing.T) {
+	// Collector keeping every result while writing only warnings and errors to stderr
+	var stderr bytes.Buffer
+	collector := NewCollector()
+	collector.Stderr = &stderr
+	collector.SetLogLevel("DEBUG")
+	if err := collector.EnableStderr("WARNING", "logfmt"); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	collector.LogDebug("Filtered DEBUG log")
+	collector.LogWarning("Kept WARNING log")
+
+	// Both logs reach results
+	assert.Equal(t, 2, len(collector.Results))
+
+	// Only the warning is written to stderr
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	assert.Equal(t, 1, len(lines))
+	assert.Contains(t, lines[0], `level=WARNING msg="Kept WARNING log" run_id=`+collector.RunID)
+}
+
+func TestNewCollectorRunID(t *testing.T) {
+	// Every run gets its own identifier
+	assert.NotEqual(t, NewCollector().RunID, NewCollector().RunID)
+	assert.Equal(t, 16, len(NewCollector().RunID))
+}
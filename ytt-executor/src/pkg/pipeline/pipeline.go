@@ -0,0 +1,383 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pipeline runs the Kptfile pipeline entries of the render function against a package directory,
+// the way kpt would run them, without kpt or containers
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/process"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Kptfile identifiers read by the pipeline
+const (
+	StageMutate   = "mutators"   // Kptfile pipeline list of functions changing the package
+	StageValidate = "validators" // Kptfile pipeline list of functions only validating the package
+	ConfigMap     = "configMap"  // Config source of pipeline entries with an inline function config
+)
+
+// DefaultImages image name parts identifying pipeline entries of the render function
+var DefaultImages = []string{"render-ytt", "ytt-executor"}
+
+// Job a Kptfile pipeline entry running the render function
+//
+// Index: position of the entry in the pipeline, mutators first
+//
+// Stage: StageMutate or StageValidate
+//
+// Image: image of the entry
+//
+// ConfigSource: configPath of the entry, or ConfigMap for an inline config
+//
+// FnConfig: function config of the entry, nil when none is given
+type Job struct {
+	Index        int
+	Stage        string
+	Image        string
+	ConfigSource string
+	FnConfig     *kyaml.RNode
+}
+
+// Name identifies the job in output, matching the render job name of its statistics
+func (job Job) Name() string {
+	return fmt.Sprintf("[%d] %s", job.Index, JobName(job.FnConfig))
+}
+
+// ResourceList returns a resource list running job on copies of items
+func (job Job) ResourceList(items []*kyaml.RNode) *framework.ResourceList {
+	resourceList := &framework.ResourceList{Items: CopyItems(items)}
+	if job.FnConfig != nil {
+		resourceList.FunctionConfig = job.FnConfig.Copy()
+	}
+	return resourceList
+}
+
+// JobName identifies a render job by the name of its function config
+func JobName(fnConfig *kyaml.RNode) string {
+	if !fnConfig.IsNilOrEmpty() && fnConfig.GetName() != "" {
+		return fnConfig.GetName()
+	}
+	return "render-ytt"
+}
+
+// ReadPackage reads resources of the package at packagePath and the Kptfile pipeline entries of the render function
+//
+// Parameters:
+//   - packagePath: package directory holding a Kptfile
+//   - images: image name parts identifying pipeline entries of the render function
+//   - skipDirs: package relative directories whose files are not package resources, e.g. test cases
+//
+// Returns:
+//   - *kio.LocalPackageReadWriter: reader the package was read with, writes rendered resources back
+//   - []*kyaml.RNode: package resources, including the Kptfile and function configs as kpt passes them
+//   - []Job: pipeline entries of the render function in order
+//   - error: when the package cannot be read, has no Kptfile or a function config is missing
+func ReadPackage(packagePath string, images []string, skipDirs ...string) (*kio.LocalPackageReadWriter, []*kyaml.RNode, []Job, error) {
+	if info, err := os.Stat(filepath.Join(packagePath, config.KptfileName)); err != nil || info.IsDir() {
+		return nil, nil, nil, fmt.Errorf("package %s has no %s", packagePath, config.KptfileName)
+	}
+	packageRW := &kio.LocalPackageReadWriter{
+		PackagePath:       packagePath,
+		PackageFileName:   config.KptfileName,
+		MatchFilesGlob:    []string{"*.yaml", "*.yml", config.KptfileName},
+		PreserveSeqIndent: true,
+		NoDeleteFiles:     true,
+		FileSkipFunc: func(relPath string) bool {
+			for _, skipDir := range skipDirs {
+				if strings.HasPrefix(relPath, filepath.Clean(skipDir)+string(filepath.Separator)) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+	items, err := packageRW.Read()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("package %s could not be read: %v", packagePath, err)
+	}
+
+	var kptfile *kyaml.RNode
+	for _, item := range items {
+		if item.GetKind() == config.KptfileKind && ItemPath(item) == config.KptfileName {
+			kptfile = item
+		}
+	}
+	if kptfile == nil {
+		return nil, nil, nil, fmt.Errorf("package %s has no %s resource", packagePath, config.KptfileName)
+	}
+
+	jobs, err := Jobs(kptfile, items, images)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil, nil, fmt.Errorf("%s of package %s has no pipeline entry with image matching %v", config.KptfileName, packagePath, images)
+	}
+	return packageRW, items, jobs, nil
+}
+
+// Jobs collects Kptfile pipeline entries with an image containing one of images,
+// mutators before validators as kpt runs them
+//
+// Parameters:
+//   - kptfile: Kptfile resource of the package
+//   - items: package resources holding function configs referenced by configPath
+//   - images: image name parts identifying pipeline entries of the render function
+//
+// Returns:
+//   - []Job: matching pipeline entries
+//   - error: when an entry is malformed or references a missing function config
+func Jobs(kptfile *kyaml.RNode, items []*kyaml.RNode, images []string) ([]Job, error) {
+	var jobs []Job
+	index := 0
+	for _, stage := range []string{StageMutate, StageValidate} {
+		entries, err := kptfile.Pipe(kyaml.Lookup("pipeline", stage))
+		if err != nil || entries == nil {
+			continue
+		}
+		elements, err := entries.Elements()
+		if err != nil {
+			return nil, fmt.Errorf("%s pipeline %s is not a list: %v", config.KptfileName, stage, err)
+		}
+		for _, entry := range elements {
+			index++
+			image, _ := entry.GetString("image")
+			if !matchesImage(image, images) {
+				continue
+			}
+			job := Job{Index: index, Stage: stage, Image: image}
+
+			// Function config referenced by path, or given inline as ConfigMap data
+			if configPath, _ := entry.GetString("configPath"); configPath != "" {
+				job.ConfigSource = configPath
+				for _, item := range items {
+					if ItemPath(item) == filepath.ToSlash(filepath.Clean(configPath)) {
+						job.FnConfig = item
+					}
+				}
+				if job.FnConfig == nil {
+					return nil, fmt.Errorf("%s pipeline entry %d references missing function config: %s", config.KptfileName, index, configPath)
+				}
+			} else if configMap := entry.Field("configMap"); !configMap.IsNilOrEmpty() {
+				job.ConfigSource = ConfigMap
+				job.FnConfig = kyaml.NewMapRNode(nil)
+				job.FnConfig.SetApiVersion("v1")
+				job.FnConfig.SetKind("ConfigMap")
+				if err := job.FnConfig.PipeE(kyaml.SetField("data", configMap.Value.Copy())); err != nil {
+					return nil, err
+				}
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// matchesImage checks whether image contains one of images
+func matchesImage(image string, images []string) bool {
+	for _, part := range images {
+		if part != "" && strings.Contains(image, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemPath returns the package relative path a resource was read from
+func ItemPath(item *kyaml.RNode) string {
+	annotations := item.GetAnnotations()
+	if itemPath := annotations[kioutil.PathAnnotation]; itemPath != "" {
+		return itemPath
+	}
+	return annotations[kioutil.LegacyPathAnnotation]
+}
+
+// Run runs jobs one after another, each on the resources the previous mutator returned,
+// printing their results to out
+// Validators see the resources but their changes are discarded
+//
+// Parameters:
+//   - out: writer receiving results of every job
+//   - processor: processor running a single job
+//   - items: package resources
+//   - jobs: pipeline entries of the render function
+//   - severities: severities of results to print, all results when none are given
+//
+// Returns:
+//   - []*kyaml.RNode: rendered package resources
+//   - []string: package relative paths of resources receiving output of a mutator, in order
+//   - error: of the first failing job, later jobs are not run
+func Run(out io.Writer, processor framework.ResourceListProcessor, items []*kyaml.RNode, jobs []Job, severities ...framework.Severity) ([]*kyaml.RNode, []string, error) {
+	var outputs []string
+	defer config.Reset()
+	for _, job := range jobs {
+		resourceList := job.ResourceList(items)
+
+		// Every job starts from defaults, as a function container would
+		config.Reset()
+		err := processor.Process(resourceList)
+		WriteResults(out, job, resourceList.Results, severities...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", job.Name(), err)
+		}
+		if job.Stage != StageMutate {
+			continue
+		}
+		items = resourceList.Items
+
+		// Outputs are identified by the config of the job just run
+		for _, item := range items {
+			if itemPath := ItemPath(item); process.IsOutputItem(item) && !slices.Contains(outputs, itemPath) {
+				outputs = append(outputs, itemPath)
+			}
+		}
+	}
+	return items, outputs, nil
+}
+
+// WriteResults prints results of job with one of severities to out, all results when no severities are given
+func WriteResults(out io.Writer, job Job, results framework.Results, severities ...framework.Severity) {
+	for _, result := range results {
+		if len(severities) > 0 && !slices.Contains(severities, result.Severity) {
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s\n", job.Name(), result)
+	}
+}
+
+// CopyItems deep copies resources, so a failing job leaves them untouched
+func CopyItems(items []*kyaml.RNode) []*kyaml.RNode {
+	copies := make([]*kyaml.RNode, 0, len(items))
+	for _, item := range items {
+		copies = append(copies, item.Copy())
+	}
+	return copies
+}
+
+// OverrideItems returns copies of items with overrides applied, e.g. the CIQ of a test case
+// Overrides replace resources of the same apiVersion, kind, namespace and name, keeping their file,
+// others are added as read from overridePath
+//
+// Parameters:
+//   - items: package resources
+//   - overrides: resources replacing or added to items
+//   - overridePath: package relative path given to added resources
+//
+// Returns:
+//   - []*kyaml.RNode: resources with overrides applied
+//   - error: when annotations of a resource cannot be set
+func OverrideItems(items []*kyaml.RNode, overrides []*kyaml.RNode, overridePath string) ([]*kyaml.RNode, error) {
+	overridden := CopyItems(items)
+	for i, override := range overrides {
+		replaced := false
+		for j, item := range overridden {
+			if resourceKey(item) != resourceKey(override) {
+				continue
+			}
+			replacement := override.Copy()
+			if err := copyFileAnnotations(item, replacement); err != nil {
+				return nil, err
+			}
+			overridden[j] = replacement
+			replaced = true
+		}
+		if replaced {
+			continue
+		}
+		added := override.Copy()
+		annotations := map[string]string{
+			kioutil.PathAnnotation:        overridePath,
+			kioutil.LegacyPathAnnotation:  overridePath,
+			kioutil.IndexAnnotation:       fmt.Sprint(i),
+			kioutil.LegacyIndexAnnotation: fmt.Sprint(i),
+		}
+		for key, value := range annotations {
+			if err := added.PipeE(kyaml.SetAnnotation(key, value)); err != nil {
+				return nil, err
+			}
+		}
+		overridden = append(overridden, added)
+	}
+	return overridden, nil
+}
+
+// resourceKey identifies a resource by apiVersion, kind, namespace and name
+func resourceKey(item *kyaml.RNode) string {
+	return strings.Join([]string{item.GetApiVersion(), item.GetKind(), item.GetNamespace(), item.GetName()}, "/")
+}
+
+// copyFileAnnotations copies path and index annotations from item to replacement
+func copyFileAnnotations(item *kyaml.RNode, replacement *kyaml.RNode) error {
+	annotations := item.GetAnnotations()
+	for _, key := range []string{kioutil.PathAnnotation, kioutil.LegacyPathAnnotation, kioutil.IndexAnnotation, kioutil.LegacyIndexAnnotation} {
+		if value, found := annotations[key]; found {
+			if err := replacement.PipeE(kyaml.SetAnnotation(key, value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SerializePackage writes resources to an in memory file system the way they would be written back to the package
+//
+// Returns:
+//   - map[string]string: file content by package relative path
+//   - error: when a resource cannot be serialized
+func SerializePackage(items []*kyaml.RNode) (map[string]string, error) {
+	fileSystem := filesys.MakeFsInMemory()
+	writer := kio.LocalPackageWriter{PackagePath: "/", FileSystem: filesys.FileSystemOrOnDisk{FileSystem: fileSystem}}
+	if err := writer.Write(CopyItems(items)); err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	err := fileSystem.Walk("/", func(fileName string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := fileSystem.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		files[strings.TrimPrefix(fileName, "/")] = string(content)
+		return nil
+	})
+	return files, err
+}
+
+// ChangedFiles returns paths of files added or changed in after, in order
+func ChangedFiles(before, after map[string]string) []string {
+	var changed []string
+	for fileName, content := range after {
+		if previous, found := before[fileName]; !found || previous != content {
+			changed = append(changed, fileName)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
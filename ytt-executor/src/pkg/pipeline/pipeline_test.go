@@ -0,0 +1,94 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestJobs(t *testing.T) {
+	kptfile := kyaml.MustParse(`
+apiVersion: kpt.dev/v1
+kind: Kptfile
+metadata:
+  name: amf
+pipeline:
+  mutators:
+    - image: gcr.io/kpt-fn/set-labels:v0.2
+    - image: localhost:5000/ytt-executor/v.0.1
+      configPath: ./fn.yaml
+    - image: render-ytt
+      configMap:
+        output.kind: AmfConfiguration
+  validators:
+    - image: render-ytt
+`)
+	fnConfig := kyaml.MustParse("apiVersion: v1\nkind: RenderConfig\nmetadata:\n  name: amf-day0\n")
+	if err := fnConfig.PipeE(kyaml.SetAnnotation(kioutil.PathAnnotation, "fn.yaml")); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Execute function
+	jobs, err := Jobs(kptfile, []*kyaml.RNode{fnConfig}, DefaultImages)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Entries of other functions are skipped but counted
+	assert.Len(t, jobs, 3)
+	assert.Equal(t, "[2] amf-day0", jobs[0].Name())
+	assert.Equal(t, "fn.yaml", jobs[0].FnConfig.GetAnnotations()[kioutil.PathAnnotation])
+	assert.Equal(t, "configMap", jobs[1].ConfigSource)
+	assert.Equal(t, map[string]string{"output.kind": "AmfConfiguration"}, jobs[1].FnConfig.GetDataMap())
+	assert.Equal(t, StageValidate, jobs[2].Stage)
+	assert.Nil(t, jobs[2].FnConfig)
+
+	// Referenced function configs have to exist
+	_, err = Jobs(kptfile, nil, DefaultImages)
+	assert.EqualError(t, err, "Kptfile pipeline entry 2 references missing function config: ./fn.yaml")
+}
+
+func TestOverrideItems(t *testing.T) {
+	ciq := kyaml.MustParse("apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\nsite: lab\n")
+	if err := ciq.PipeE(kyaml.SetAnnotation(kioutil.PathAnnotation, "amf/ciq.yaml")); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	items := []*kyaml.RNode{ciq}
+	overrides := []*kyaml.RNode{
+		kyaml.MustParse("apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\nsite: edge\n"),
+		kyaml.MustParse("apiVersion: v1\nkind: Ciq\nmetadata:\n  name: smf\nsite: edge\n"),
+	}
+
+	// Execute function
+	overridden, err := OverrideItems(items, overrides, "testdata/edge/ciq.yaml")
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Replaced resources keep their file, others are added from the override path
+	assert.Len(t, overridden, 2)
+	assert.Equal(t, "amf/ciq.yaml", ItemPath(overridden[0]))
+	assert.Equal(t, "edge", overridden[0].Field("site").Value.YNode().Value)
+	assert.Equal(t, "testdata/edge/ciq.yaml", ItemPath(overridden[1]))
+	assert.Equal(t, "1", overridden[1].GetAnnotations()[kioutil.IndexAnnotation])
+
+	// Inputs are left untouched
+	assert.Equal(t, "lab", ciq.Field("site").Value.YNode().Value)
+	assert.Empty(t, overrides[1].GetAnnotations())
+}
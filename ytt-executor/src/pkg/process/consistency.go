@@ -0,0 +1,217 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/expression"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// consistencyBinding a package resource bound to a variable of a consistency rule
+//
+// item: resource selected for the variable
+//
+// field: key of the bound content, empty when the whole resource is bound
+//
+// value: bound content as plain go value
+type consistencyBinding struct {
+	item  *kyaml.RNode
+	field string
+	value any
+}
+
+// CheckConsistency checks config.YttConsistencyRules against package resources before anything is rendered
+// Every violation is reported against each resource of its rule, so all involved resources show up in results
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - items: package resources, including resources of referenced packages
+//
+// Returns:
+//   - error: when any rule is violated or its resources cannot be bound
+func CheckConsistency(results *logger.Collector, items ...*kyaml.RNode) error {
+	failed := 0
+	for _, rule := range config.YttConsistencyRules {
+		variables := make([]string, 0, len(rule.Resources))
+		for variable := range rule.Resources {
+			variables = append(variables, variable)
+		}
+		sort.Strings(variables)
+
+		bindings, err := bindConsistencyResources(rule, variables, items)
+		if err != nil {
+			results.LogDetailedError(fmt.Sprintf("Consistency rule %s cannot be checked: %v", rule.Name, err), map[string]string{
+				"rule": rule.Name,
+			})
+			failed++
+			continue
+		}
+		violations := checkConsistencyRule(rule, variables, bindings)
+		if len(violations) > 0 {
+			failed++
+		}
+		for _, violation := range violations {
+			message := violation
+			if rule.Message != "" {
+				message = rule.Message
+			}
+			for _, variable := range variables {
+				binding := bindings[variable]
+				results.LogReferencedError(fmt.Sprintf("Consistency rule %s violated: %s", rule.Name, message),
+					logger.Reference{Item: binding.item, Field: binding.field}, map[string]string{
+						"rule":      rule.Name,
+						"resource":  variable,
+						"violation": violation,
+					})
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d consistency rules failed", failed, len(config.YttConsistencyRules))
+	}
+	return nil
+}
+
+// bindConsistencyResources binds each variable of rule to the single resource of items its selector matches
+//
+// Parameters:
+//   - rule: consistency rule to bind
+//   - variables: sorted variable names of rule
+//   - items: package resources
+//
+// Returns:
+//   - map[string]consistencyBinding: bindings by variable
+//   - error: when a selector matches no or several resources, or content cannot be read
+func bindConsistencyResources(rule config.YttConsistencyRule, variables []string, items []*kyaml.RNode) (map[string]consistencyBinding, error) {
+	bindings := map[string]consistencyBinding{}
+	for _, variable := range variables {
+		var matched []*kyaml.RNode
+		for _, item := range items {
+			if rule.Resources[variable].Matches(item) {
+				matched = append(matched, item)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("resource %s matches no resource", variable)
+		}
+		if len(matched) > 1 {
+			names := make([]string, 0, len(matched))
+			for _, item := range matched {
+				names = append(names, resourceName(item))
+			}
+			return nil, fmt.Errorf("resource %s matches %d resources: %s", variable, len(matched), strings.Join(names, ", "))
+		}
+
+		// Content of data values given as string is parsed, ytt annotations are comments
+		binding := consistencyBinding{item: matched[0]}
+		node := matched[0]
+		if content := matched[0].Field(config.YttNodeContent); !content.IsNilOrEmpty() {
+			binding.field = config.YttNodeContent
+			node = content.Value
+			if node.YNode().Kind == kyaml.ScalarNode {
+				parsed, err := kyaml.Parse(node.YNode().Value)
+				if err != nil {
+					return nil, fmt.Errorf("content of resource %s is not yaml: %v", variable, err)
+				}
+				node = parsed
+			}
+		}
+		value, err := expression.ToValue(node)
+		if err != nil {
+			return nil, fmt.Errorf("resource %s cannot be read: %v", variable, err)
+		}
+		binding.value = value
+		bindings[variable] = binding
+	}
+	return bindings, nil
+}
+
+// checkConsistencyRule checks equal fields and the expression of rule against bound resources
+//
+// Returns:
+//   - []string: descriptions of violations, none when the rule holds
+func checkConsistencyRule(rule config.YttConsistencyRule, variables []string, bindings map[string]consistencyBinding) []string {
+	var violations []string
+	for _, path := range rule.Equal {
+		var missing, found []string
+		values := map[string]any{}
+		for _, variable := range variables {
+			value, ok, err := expression.Lookup(bindings[variable].value, path)
+			if err != nil {
+				return append(violations, err.Error())
+			}
+			if !ok {
+				missing = append(missing, variable)
+				continue
+			}
+			values[variable] = value
+			found = append(found, variable)
+		}
+		if len(missing) > 0 {
+			violations = append(violations, fmt.Sprintf("%s not found in %s", path, strings.Join(missing, ", ")))
+			continue
+		}
+		differs := false
+		for _, variable := range found[1:] {
+			differs = differs || !reflect.DeepEqual(values[found[0]], values[variable])
+		}
+		if differs {
+			described := make([]string, 0, len(found))
+			for _, variable := range found {
+				described = append(described, fmt.Sprintf("%s=%s", variable, formatValue(values[variable])))
+			}
+			violations = append(violations, fmt.Sprintf("%s differs: %s", path, strings.Join(described, ", ")))
+		}
+	}
+
+	if rule.Program != nil {
+		variableValues := map[string]any{}
+		for _, variable := range variables {
+			variableValues[variable] = bindings[variable].value
+		}
+		holds, err := rule.Program.Eval(variableValues)
+		if err != nil {
+			violations = append(violations, err.Error())
+		} else if !holds {
+			violations = append(violations, fmt.Sprintf("%s is false", rule.Expression))
+		}
+	}
+	return violations
+}
+
+// formatValue formats a field value for messages, strings as they are and other values as json
+func formatValue(value any) string {
+	if text, ok := value.(string); ok {
+		return text
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// resourceName identifies a resource in messages by kind and name
+func resourceName(item *kyaml.RNode) string {
+	return fmt.Sprintf("%s/%s", item.GetKind(), item.GetName())
+}
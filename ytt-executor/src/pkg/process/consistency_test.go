@@ -0,0 +1,193 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// siteItems CIQs of a site and its NFs, the SMF CIQ given as string with a ytt annotation
+func siteItems() []*kyaml.RNode {
+	return []*kyaml.RNode{
+		kyaml.MustParse(`
+apiVersion: v1
+kind: YttDataValues
+metadata:
+  name: site-ciq
+ytt_template_content:
+  plmn: {mcc: "001", mnc: "01"}
+  tacs: [1, 2]
+`),
+		kyaml.MustParse(`
+apiVersion: v1
+kind: YttDataValues
+metadata:
+  name: amf-ciq
+ytt_template_content:
+  plmn: {mcc: "001", mnc: "01"}
+  tac: 3
+`),
+		kyaml.MustParse(`
+apiVersion: v1
+kind: YttDataValues
+metadata:
+  name: smf-ciq
+ytt_template_content: |
+  #@data/values
+  ---
+  plmn: {mcc: "001", mnc: "02"}
+`),
+		kyaml.MustParse("apiVersion: v1\nkind: Configuration\nmetadata:\n  name: amf-values\ndata: {}\n"),
+	}
+}
+
+func TestCheckConsistency(t *testing.T) {
+	defer config.Reset()
+
+	// Test structure
+	tests := []struct {
+		name             string
+		consistency      string
+		expectedErr      string
+		expectedMessages []string
+		expectedItems    []string
+	}{ // Test list
+
+		// Equal fields and expressions holding
+		{
+			"Test consistent resources",
+			`
+- name: shared-mcc
+  resources:
+    site: {names: [site-ciq]}
+    amf: {names: [amf-ciq]}
+    smf: {names: [smf-ciq]}
+  equal: [plmn.mcc, "$['plmn'].mcc"]
+  expression: amf.plmn == site.plmn
+- name: amf-output
+  resources:
+    out: {kinds: [Configuration]}
+  expression: has(out.data)
+`,
+			"",
+			nil,
+			nil,
+		},
+
+		// Differing fields are reported against every resource of the rule
+		{
+			"Test differing fields",
+			`
+- name: shared-plmn
+  resources:
+    site: {names: [site-ciq]}
+    smf: {names: [smf-ciq]}
+  equal: [plmn.mnc]
+`,
+			"1 of 1 consistency rules failed",
+			[]string{
+				"Consistency rule shared-plmn violated: plmn.mnc differs: site=01, smf=02",
+				"Consistency rule shared-plmn violated: plmn.mnc differs: site=01, smf=02",
+			},
+			[]string{"site-ciq", "smf-ciq"},
+		},
+
+		// Missing fields, false expressions and custom messages
+		{
+			"Test failing expression and missing field",
+			`
+- name: amf-tac
+  resources:
+    site: {names: [site-ciq]}
+    amf: {names: [amf-ciq]}
+  equal: [tac]
+  expression: amf.tac in site.tacs
+  message: AMF TAC must be served by the site
+`,
+			"1 of 1 consistency rules failed",
+			[]string{
+				"Consistency rule amf-tac violated: AMF TAC must be served by the site",
+				"Consistency rule amf-tac violated: AMF TAC must be served by the site",
+				"Consistency rule amf-tac violated: AMF TAC must be served by the site",
+				"Consistency rule amf-tac violated: AMF TAC must be served by the site",
+			},
+			[]string{"amf-ciq", "site-ciq", "amf-ciq", "site-ciq"},
+		},
+
+		// Selectors must match exactly one resource
+		{
+			"Test ambiguous and missing resources",
+			`
+- name: ambiguous
+  resources:
+    ciqs: {kinds: [YttDataValues]}
+  expression: "true"
+- name: missing
+  resources:
+    upf: {names: [upf-ciq]}
+  expression: "true"
+`,
+			"2 of 2 consistency rules failed",
+			[]string{
+				"Consistency rule ambiguous cannot be checked: resource ciqs matches 3 resources: YttDataValues/site-ciq, YttDataValues/amf-ciq, YttDataValues/smf-ciq",
+				"Consistency rule missing cannot be checked: resource upf matches no resource",
+			},
+			[]string{"", ""},
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Reset()
+			fnConfig := kyaml.NewMapRNode(nil)
+			if err := fnConfig.PipeE(kyaml.SetField("consistency", kyaml.MustParse(tt.consistency))); err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			if err := config.Configure(logger.NewCollector(), fnConfig); err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			results := logger.NewCollector()
+
+			// Execute function
+			err := CheckConsistency(results, siteItems()...)
+
+			// Assert response
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr)
+			}
+			var gotMessages, gotItems []string
+			for _, result := range results.Results {
+				gotMessages = append(gotMessages, result.Message)
+				if result.ResourceRef != nil {
+					gotItems = append(gotItems, result.ResourceRef.Name)
+				} else {
+					gotItems = append(gotItems, "")
+				}
+			}
+			assert.Equal(t, tt.expectedMessages, gotMessages)
+			if tt.expectedItems != nil {
+				assert.Equal(t, tt.expectedItems, gotItems)
+			}
+		})
+	}
+}
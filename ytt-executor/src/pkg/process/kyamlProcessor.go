@@ -17,6 +17,8 @@ package process
 import (
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -32,59 +34,270 @@ import (
 // defaultTemplate: For most  basic template processing, file name is returned with -f argument
 //
 // valuesTemplate: For explicitly specifying values file, file name is returned with --data-values-file argument
+//
+// libraryFile: For library files, written under _ytt_lib/<library> and returned with -f argument
+//
+// secretResource: For v1 Secrets, bound ones are decoded and returned with --data-values-file argument, others skipped
+//
+// unselectedResource: For resources matching no selector while templates or schemas are selected, skipped
 type templateType int
 
 const (
 	defaultTemplate templateType = iota
 	valuesTemplate
 	outputFile
+	libraryFile
+	secretResource
+	unselectedResource
 )
 
+// templateTypeStrings templateType enum as a string representation
+var templateTypeStrings = []string{"template", "values", "output", "library", "secret", "unselected"}
+
+// PlannedInput role a render assigns to a resource
+//
+// Item: resource of the package
+//
+// Role: one of template, values, output, library, secret or unselected
+//
+// FileName: file the resource is written to for ytt, empty when it is not passed to ytt
+type PlannedInput struct {
+	Item     *kyaml.RNode
+	Role     string
+	FileName string
+}
+
+// inlineValuesFile file data values of the function config are written to, relative to the base directory
+const inlineValuesFile = "inline-values.yaml"
+
+// yttFileType internal enum for the ytt file type a wrapper resource declares
+//
+// yamlTemplateFile: ytt yaml template, default for all resources
+//
+// textTemplateFile: ytt text template library, content is written verbatim with .lib.txt extension so yaml
+// templates can load() its functions, ytt does not render plain .txt templates to standard output
+//
+// starlarkFile: starlark module loadable by other templates, written with .star extension
+//
+// dataFile: plain data file, readable through @ytt:data and never templated
+type yttFileType int
+
+const (
+	yamlTemplateFile yttFileType = iota
+	textTemplateFile
+	starlarkFile
+	dataFile
+)
+
+// yttFileTypeStrings yttFileType enum as a string representation
+var yttFileTypeStrings = []string{"yaml-template", "text-template", "starlark", "data"}
+
+// yttFileTypeExtensions file extension enforced for each yttFileType, empty to keep given extension
+var yttFileTypeExtensions = []string{".yaml", ".lib.txt", ".star", ""}
+
 // ParseAndWriteKYamlRNodesAsYttTemplates
 //
 // Parameters:
+//   - results: logger.Collector of the current run
 //   - items: list of yaml.RNode items to write to work directory for ytt binary processing
 //
 // Returns:
 //   - fileArgs: Any error that could be experienced when writing the file
 //   - error: Any error that could be experienced when writing the file
-func ParseAndWriteKYamlRNodesAsYttTemplates(items ...*kyaml.RNode) (fileArgs []string, baseDir string, err error) {
+func ParseAndWriteKYamlRNodesAsYttTemplates(results *logger.Collector, items ...*kyaml.RNode) (fileArgs []string, baseDir string, err error) {
 	baseDir, err = os.MkdirTemp("", "ytt-files-*")
 	if err != nil {
 		return []string{}, "", fmt.Errorf("Directory creation for ytt files failed: %v", err)
 	}
+	fileArgs, err = writeYttInputs(results, baseDir, items, func(PlannedInput) {})
+	return fileArgs, baseDir, err
+}
+
+// PlanYttInputs resolves the role and file name of every item and the ytt arguments a render would use,
+// writing files to a temporary directory removed before returning
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - items: list of yaml.RNode items a render would write for ytt
+//
+// Returns:
+//   - []PlannedInput: role and file name of each item in order
+//   - []string: ytt file arguments with file names relative to the ytt file directory
+//   - error: Any error the render would fail with while writing files
+func PlanYttInputs(results *logger.Collector, items ...*kyaml.RNode) (plan []PlannedInput, fileArgs []string, err error) {
+	baseDir, err := os.MkdirTemp("", "ytt-plan-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Directory creation for ytt files failed: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	fileArgs, err = writeYttInputs(results, baseDir, items, func(input PlannedInput) {
+		input.FileName = strings.TrimPrefix(input.FileName, baseDir+"/")
+		plan = append(plan, input)
+	})
+	for i, arg := range fileArgs {
+		fileArgs[i] = strings.ReplaceAll(arg, baseDir+"/", "")
+	}
+	return plan, fileArgs, err
+}
+
+// writeYttInputs writes items to baseDir for ytt processing
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - baseDir: directory to write files to
+//   - items: list of yaml.RNode items to write
+//   - record: receives the role and file name of each item
+//
+// Returns:
+//   - fileArgs: ytt file arguments of written files
+//   - error: Any error that could be experienced when writing the file
+func writeYttInputs(results *logger.Collector, baseDir string, items []*kyaml.RNode, record func(PlannedInput)) (fileArgs []string, err error) {
+	foundLibraries := map[string]bool{}
+	foundSecrets := map[string]bool{}
 	for _, item := range items {
 
 		// Check for file type
 		itemType := getItemTemplateType(item)
+		input := PlannedInput{Item: item, Role: templateTypeStrings[itemType]}
 
 		// Switch based on file type
 		switch itemType {
 
 		// Write file and return -f <file_name> argument
 		case defaultTemplate:
-			fileName, err := processKYamlRNode(item, baseDir)
+			itemFile, err := processKYamlRNode(results, item, baseDir, "")
 			if err != nil {
-				return fileArgs, baseDir, err
+				results.LogReferencedError(err.Error(), logger.Reference{Item: item}, nil)
+				return fileArgs, err
 			}
-			fileArgs = append(fileArgs, "-f", fileName)
+			fileArgs = append(fileArgs, itemFile.fileArgs()...)
+			input.FileName = itemFile.fileName
 			break
 
 		// Write file and return --data-values-file <file_name> argument
 		case valuesTemplate:
-			fileName, err := processKYamlRNode(item, baseDir)
+			itemFile, err := processKYamlRNode(results, item, baseDir, "")
+			if err != nil {
+				results.LogReferencedError(err.Error(), logger.Reference{Item: item}, nil)
+				return fileArgs, err
+			}
+			fileArgs = append(fileArgs, "--data-values-file", itemFile.fileName)
+			input.FileName = itemFile.fileName
+			break
+
+		// Write library file under _ytt_lib and return -f <relative_name>=<file_name> argument
+		case libraryFile:
+			libraryName, err := getItemLibraryName(item)
+			if err != nil {
+				results.LogReferencedError(err.Error(), logger.Reference{Item: item, Field: config.YttNodeLibraryName}, nil)
+				return fileArgs, err
+			}
+			foundLibraries[libraryName] = true
+			if !isLibrarySelected(libraryName) {
+				results.LogReferencedDebug(fmt.Sprintf("Skipping file of unselected library: %s", libraryName), logger.Reference{Item: item}, nil)
+				break
+			}
+			itemFile, err := processKYamlRNode(results, item, baseDir, libraryName)
+			if err != nil {
+				results.LogReferencedError(err.Error(), logger.Reference{Item: item}, nil)
+				return fileArgs, err
+			}
+			fileArgs = append(fileArgs, itemFile.fileArgs()...)
+			input.FileName = itemFile.fileName
+			break
+
+		// Write decoded data of bound Secret and return --data-values-file <file_name> argument
+		case secretResource:
+			secretValue, bound := getSecretValue(item)
+			if !bound {
+				results.LogReferencedDebug("Skipping secret not bound as data values", logger.Reference{Item: item}, nil)
+				break
+			}
+			foundSecrets[secretValue.Name] = true
+			fileName, err := writeSecretValues(item, secretValue, baseDir)
 			if err != nil {
-				return fileArgs, baseDir, err
+				results.LogReferencedError(err.Error(), logger.Reference{Item: item}, nil)
+				return fileArgs, err
 			}
 			fileArgs = append(fileArgs, "--data-values-file", fileName)
+			input.FileName = fileName
 			break
 
 		//	Output file should not be written or handled by ytt bin
 		case outputFile:
 			break
+
+		// Resources not selected for any role are left to other functions
+		case unselectedResource:
+			results.LogReferencedDebug("Skipping resource not selected as template or schema", logger.Reference{Item: item}, nil)
+			break
+		}
+		record(input)
+	}
+
+	// Data values of the function config override all other data values
+	if config.YttInlineValues != nil {
+		fileName := path.Join(baseDir, inlineValuesFile)
+		content, err := config.YttInlineValues.String()
+		if err != nil {
+			return fileArgs, err
+		}
+		if err := fileWriter.WriteToFile(fileName, content); err != nil {
+			return fileArgs, err
+		}
+		results.LogDetailedDebug("Writing inline data values for ytt processing", map[string]string{
+			"fileName": fileName,
+		})
+		fileArgs = append(fileArgs, "--data-values-file", fileName)
+	}
+
+	// Bound Secrets have to be provided by the package
+	for _, secretValue := range config.YttSecretValues {
+		if !foundSecrets[secretValue.Name] {
+			return fileArgs, fmt.Errorf("secret: %s, bound in function config but not found in package", secretValue.Name)
+		}
+	}
+
+	// Selected libraries have to be provided by the package
+	for _, libraryName := range config.YttLibraries {
+		if !foundLibraries[libraryName] {
+			return fileArgs, fmt.Errorf("library: %s, selected in function config but no %s provides it", libraryName, config.YttLibraryKind)
+		}
+	}
+	return fileArgs, nil
+}
+
+// getItemLibraryName reads library name declared under config.YttNodeLibraryName
+//
+// Parameters:
+//   - item: yaml.RNode of a library file
+//
+// Returns:
+//   - string: library name
+//   - error: when library name is missing or not a valid directory name
+func getItemLibraryName(item *kyaml.RNode) (string, error) {
+	if item.Field(config.YttNodeLibraryName).IsNilOrEmpty() {
+		return "", fmt.Errorf("resource: %s, of kind %s has no %s", item.GetName(), config.YttLibraryKind, config.YttNodeLibraryName)
+	}
+	libraryName := item.Field(config.YttNodeLibraryName).Value.YNode().Value
+	if !config.IsValidLibraryName(libraryName) {
+		return "", fmt.Errorf("resource: %s, has invalid %s: %s", item.GetName(), config.YttNodeLibraryName, libraryName)
+	}
+	return libraryName, nil
+}
+
+// isLibrarySelected checks if libraryName is made available through config.YttLibraries, nil selects all
+func isLibrarySelected(libraryName string) bool {
+	if config.YttLibraries == nil {
+		return true
+	}
+	for _, selected := range config.YttLibraries {
+		if selected == libraryName {
+			return true
 		}
 	}
-	return fileArgs, baseDir, nil
+	return false
 }
 
 // getItemTemplateType function to identify template type based on configuration
@@ -95,32 +308,211 @@ func ParseAndWriteKYamlRNodesAsYttTemplates(items ...*kyaml.RNode) (fileArgs []s
 // Returns:
 //   - templateType: enum identifying template type
 func getItemTemplateType(item *kyaml.RNode) templateType {
-	// Default check for values File by Kind
+	// Secrets are never passed to ytt as templates
+	if isSecret(item) {
+		return secretResource
+	}
+
+	// Render tests hold inputs of test cases, not of this render
+	if item.GetKind() == config.YttRenderTestKind {
+		return unselectedResource
+	}
+
+	// Default check for values File by Kind, or by selector when given
 	if config.YttInputValuesFileHandling == config.ValuesIdentifierKind {
-		if item.GetKind() == config.YttInputValueFileKind {
+		if config.YttValuesSelector != nil {
+			if config.YttValuesSelector.Matches(item) {
+				return valuesTemplate
+			}
+		} else if item.GetKind() == config.YttInputValueFileKind {
 			return valuesTemplate
 		}
 	}
 
-	if item.GetKind() == config.YttOutputFileKind {
+	if IsOutputItem(item) {
 		return outputFile
 	}
-	return defaultTemplate
+
+	if item.GetKind() == config.YttLibraryKind {
+		return libraryFile
+	}
+
+	// Without template or schema selectors all remaining resources are templates
+	if config.YttTemplateSelector == nil && config.YttSchemaSelector == nil {
+		return defaultTemplate
+	}
+	if config.YttSchemaSelector != nil && config.YttSchemaSelector.Matches(item) {
+		return defaultTemplate
+	}
+	if config.YttTemplateSelector != nil && config.YttTemplateSelector.Matches(item) {
+		return defaultTemplate
+	}
+	return unselectedResource
 }
 
-func processKYamlRNode(item *kyaml.RNode, baseDir string) (fileName string, err error) {
-	fileName = baseDir + "/" + item.GetAnnotations()["config.kubernetes.io/path"]
+// IsOutputItem checks whether item receives ytt output, selected by config.YttOutputSelector when set,
+// otherwise by config.YttOutputFileKind
+func IsOutputItem(item *kyaml.RNode) bool {
+	if config.YttOutputSelector != nil {
+		return !isSecret(item) && config.YttOutputSelector.Matches(item)
+	}
+	return item.GetKind() == config.YttOutputFileKind
+}
+
+// yttFile describes a file written for ytt processing
+//
+// fileName: path of the written file
+//
+// relativeName: file name declared by the resource, empty when the file keeps its path annotation
+//
+// fileType: yttFileType declared by the resource
+type yttFile struct {
+	fileName     string
+	relativeName string
+	fileType     yttFileType
+}
+
+// fileArgs returns ytt arguments to pass yttFile as a template
+//
+// Declared file names are passed as -f <relative_name>=<file_name> so templates can load() them by name,
+// plain data files are additionally marked with --file-mark <relative_name>:type=data
+func (file yttFile) fileArgs() []string {
+	if file.relativeName == "" {
+		return []string{"-f", file.fileName}
+	}
+	args := []string{"-f", file.relativeName + "=" + file.fileName}
+	if file.fileType == dataFile {
+		args = append(args, "--file-mark", file.relativeName+":type=data")
+	}
+	return args
+}
+
+// getItemFileType reads yttFileType declared under config.YttNodeFileType, defaulting to yamlTemplateFile
+//
+// Parameters:
+//   - item: yaml.RNode to be identified
+//
+// Returns:
+//   - yttFileType: enum identifying ytt file type
+//   - error: when declared file type is unknown
+func getItemFileType(item *kyaml.RNode) (yttFileType, error) {
+	if item.Field(config.YttNodeFileType).IsNilOrEmpty() {
+		return yamlTemplateFile, nil
+	}
+	declaredType := item.Field(config.YttNodeFileType).Value.YNode().Value
+	for i, typeString := range yttFileTypeStrings {
+		if typeString == strings.ToLower(declaredType) {
+			return yttFileType(i), nil
+		}
+	}
+	return yamlTemplateFile, fmt.Errorf(
+		"resource: %s, has unknown %s: %s, expected one of: %v",
+		item.GetName(),
+		config.YttNodeFileType,
+		declaredType,
+		yttFileTypeStrings,
+	)
+}
+
+// getItemRelativeName reads file name declared under config.YttNodeFileName and enforces extension of fileType
+// Non yaml files without a declared file name fall back to their path annotation
+//
+// Parameters:
+//   - item: yaml.RNode to be identified
+//   - fileType: yttFileType of item
+//
+// Returns:
+//   - string: relative file name, empty for yaml templates without a declared file name
+//   - error: when declared file name is not a local relative path, or names a text template ytt would not load
+func getItemRelativeName(item *kyaml.RNode, fileType yttFileType) (string, error) {
+	relativeName := item.GetAnnotations()["config.kubernetes.io/path"]
+	if !item.Field(config.YttNodeFileName).IsNilOrEmpty() {
+		relativeName = item.Field(config.YttNodeFileName).Value.YNode().Value
+
+		// Yaml templates without a declared name keep their path annotation
+	} else if fileType == yamlTemplateFile {
+		return "", nil
+	}
+	if !filepath.IsLocal(relativeName) {
+		return "", fmt.Errorf(
+			"resource: %s, %s must be a relative path inside the package: %s",
+			item.GetName(),
+			config.YttNodeFileName,
+			relativeName,
+		)
+	}
+
+	// Plain .txt templates are neither loadable nor part of ytt standard output, so they would render nothing
+	extension := yttFileTypeExtensions[fileType]
+	if fileType == textTemplateFile && filepath.Ext(relativeName) == ".txt" && !strings.HasSuffix(relativeName, extension) {
+		return "", fmt.Errorf(
+			"resource: %s, text-template %s is not rendered to ytt output, name it *%s and load() it from a yaml template",
+			item.GetName(),
+			relativeName,
+			extension,
+		)
+	}
+	if extension != "" && !strings.HasSuffix(relativeName, extension) && !(fileType == yamlTemplateFile && filepath.Ext(relativeName) == ".yml") {
+		relativeName += extension
+	}
+	return filepath.ToSlash(filepath.Clean(relativeName)), nil
+}
+
+// processKYamlRNode writes item to baseDir as a file for ytt processing
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - item: yaml.RNode to write
+//   - baseDir: directory to write file to
+//   - libraryName: library the file belongs to, empty for files outside of _ytt_lib
+//
+// Returns:
+//   - yttFile: details of the written file
+//   - error: from identifying or writing the file
+func processKYamlRNode(results *logger.Collector, item *kyaml.RNode, baseDir string, libraryName string) (itemFile yttFile, err error) {
+	// Identify declared file type and name
+	itemFile.fileType, err = getItemFileType(item)
+	if err != nil {
+		return itemFile, err
+	}
+	itemFile.relativeName, err = getItemRelativeName(item, itemFile.fileType)
+	if err != nil {
+		return itemFile, err
+	}
+
+	// Library files are always named and placed in the library directory
+	if libraryName != "" {
+		if itemFile.relativeName == "" {
+			itemFile.relativeName = filepath.ToSlash(filepath.Clean(item.GetAnnotations()["config.kubernetes.io/path"]))
+		}
+		itemFile.relativeName = path.Join("_ytt_lib", libraryName, itemFile.relativeName)
+	}
+
+	// Declared file names replace path annotation
+	if itemFile.relativeName != "" {
+		itemFile.fileName = baseDir + "/" + itemFile.relativeName
+	} else {
+		itemFile.fileName = baseDir + "/" + item.GetAnnotations()["config.kubernetes.io/path"]
+	}
+	fileName := itemFile.fileName
 
 	// Log detailed info about files
-	logger.LogDetailedDebug(fmt.Sprintf("Writing file for ytt processing: %s", fileName), map[string]string{
+	results.LogReferencedDebug(fmt.Sprintf("Writing file for ytt processing: %s", fileName), logger.Reference{Item: item}, map[string]string{
 		"kyaml":         item.MustString(),
 		"fileName":      fileName,
+		"fileType":      yttFileTypeStrings[itemFile.fileType],
 		"annotationKey": config.YttNodeAnnotations,
 		"hasAnnotation": strconv.FormatBool(!item.Field(config.YttNodeAnnotations).IsNilOrEmpty()),
 		"contentKey":    config.YttNodeContent,
 		"hasData":       strconv.FormatBool(!item.Field(config.YttNodeContent).IsNilOrEmpty()),
 	})
 
+	// Non yaml files and string content are written verbatim
+	content := item.Field(config.YttNodeContent)
+	if itemFile.fileType != yamlTemplateFile || (!content.IsNilOrEmpty() && content.Value.YNode().Kind == kyaml.ScalarNode) {
+		return itemFile, writeVerbatimContent(item, fileName)
+	}
+
 	// Hande annotations
 	if !item.Field(config.YttNodeAnnotations).IsNilOrEmpty() {
 
@@ -131,7 +523,7 @@ func processKYamlRNode(item *kyaml.RNode, baseDir string) (fileName string, err
 		yttAnnotationData = yttAnnotationData[strings.Index(yttAnnotationData, "\n")+1:]
 		err := fileWriter.WriteToFile(fileName, yttAnnotationData)
 		if err != nil {
-			return fileName, err
+			return itemFile, err
 		}
 	}
 
@@ -139,9 +531,33 @@ func processKYamlRNode(item *kyaml.RNode, baseDir string) (fileName string, err
 	if !item.Field(config.YttNodeContent).IsNilOrEmpty() {
 		err := fileWriter.WriteToFile(fileName, item.Field(config.YttNodeContent).Value.MustString())
 		if err != nil {
-			return fileName, err
+			return itemFile, err
 		}
 	}
 
-	return fileName, nil
+	return itemFile, nil
+}
+
+// writeVerbatimContent writes string content of item under config.YttNodeContent to fileName as is
+//
+// Parameters:
+//   - item: yaml.RNode holding a string content element
+//   - fileName: path of file to write
+//
+// Returns:
+//   - error: when content is not a string or file could not be written
+func writeVerbatimContent(item *kyaml.RNode, fileName string) error {
+	content := item.Field(config.YttNodeContent)
+	if content.IsNilOrEmpty() {
+		return fileWriter.WriteToFile(fileName, "")
+	}
+	if content.Value.YNode().Kind != kyaml.ScalarNode {
+		return fmt.Errorf(
+			"resource: %s, %s must be a string for %s files",
+			item.GetName(),
+			config.YttNodeContent,
+			item.Field(config.YttNodeFileType).Value.YNode().Value,
+		)
+	}
+	return fileWriter.WriteToFile(fileName, content.Value.YNode().Value)
 }
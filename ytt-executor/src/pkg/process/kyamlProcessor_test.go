@@ -16,11 +16,15 @@ package process
 import (
 	//"io/fs"
 	"os"
+	"os/exec"
+	"strings"
 	//"syscall"
 	"testing"
 
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
 	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
 	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
@@ -107,7 +111,7 @@ func TestParseAndWriteKYamlRNodesAsYttTemplates(t *testing.T) {
 			}
 
 			// Execute function
-			gotFileArgs, baseDir, err := ParseAndWriteKYamlRNodesAsYttTemplates(tt.input...)
+			gotFileArgs, baseDir, err := ParseAndWriteKYamlRNodesAsYttTemplates(logger.NewCollector(), tt.input...)
 
 			// If error was received but not expected
 			if err != nil && tt.errorCheck == nil {
@@ -195,6 +199,433 @@ func Test_getItemTemplateType(t *testing.T) {
 	}
 }
 
+func Test_getItemTemplateTypeSelectors(t *testing.T) {
+	// Select ConfigMaps by label, annotation and path instead of kind
+	config.YttInputValuesFileHandling = config.ValuesIdentifierKind
+	config.YttValuesSelector = &config.YttSelector{Selector: framework.Selector{Kinds: []string{"ConfigMap"}, Labels: map[string]string{"role": "ciq"}}}
+	config.YttTemplateSelector = &config.YttSelector{Paths: []string{"amf/templates/*.yaml"}}
+	config.YttSchemaSelector = &config.YttSelector{Selector: framework.Selector{Annotations: map[string]string{"ytt.io/schema": "true"}}}
+	config.YttOutputSelector = &config.YttSelector{MatchExpressions: []config.YttMatchExpression{{Key: "role", Operator: config.MatchOperatorIn, Values: []string{"output"}}}}
+	defer func() {
+		config.YttValuesSelector = nil
+		config.YttTemplateSelector = nil
+		config.YttSchemaSelector = nil
+		config.YttOutputSelector = nil
+	}()
+
+	// Test structure
+	tests := []struct {
+		name     string
+		input    string
+		expected templateType
+	}{ // Test list
+
+		// CIQ ConfigMap selected by label
+		{
+			"Test labeled ConfigMap = valuesTemplate",
+			`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: amf-ciq
+  labels: {role: ciq}
+`,
+			valuesTemplate,
+		},
+
+		// Output ConfigMap selected by match expression
+		{
+			"Test labeled ConfigMap = outputFile",
+			`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: amf-config
+  labels: {role: output}
+`,
+			outputFile,
+		},
+
+		// Template selected by path glob
+		{
+			"Test ConfigMap in template path = defaultTemplate",
+			`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: amf-template
+  annotations: {config.kubernetes.io/path: amf/templates/day0.yaml}
+`,
+			defaultTemplate,
+		},
+
+		// Schema selected by annotation
+		{
+			"Test annotated ConfigMap = defaultTemplate",
+			`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: amf-schema
+  annotations: {ytt.io/schema: "true", config.kubernetes.io/path: amf/schema.yaml}
+`,
+			defaultTemplate,
+		},
+
+		// Resource matching no selector
+		{
+			"Test unrelated ConfigMap = unselectedResource",
+			`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unrelated
+  labels: {role: other}
+  annotations: {config.kubernetes.io/path: other/unrelated.yaml}
+`,
+			unselectedResource,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, getItemTemplateType(kyaml.MustParse(tt.input)))
+		})
+	}
+}
+
+func TestParseAndWriteKYamlRNodesAsYttTemplatesFileTypes(t *testing.T) {
+	// Sample starlark module with declared file name
+	starlarkItem := kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: capacity-lib
+  annotations:
+    config.kubernetes.io/path: "path_to_file/capacity.yaml"
+ytt_file_type: starlark
+ytt_file_name: lib/capacity
+ytt_template_content: |
+  def instances(sessions):
+    return sessions // 128 + 1
+  end
+`)
+
+	// Sample data file without declared file name
+	dataItem := kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: raw-data
+  annotations:
+    config.kubernetes.io/path: "path_to_file/raw.ini"
+ytt_file_type: data
+ytt_template_content: "key = value"
+`)
+
+	// Execute function
+	gotFileArgs, baseDir, err := ParseAndWriteKYamlRNodesAsYttTemplates(logger.NewCollector(), starlarkItem, dataItem)
+	if err != nil {
+		t.Fatalf("error not expected %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	// Check arguments use declared relative names
+	assert.Equal(t, []string{
+		"-f", "lib/capacity.star=" + baseDir + "/lib/capacity.star",
+		"-f", "path_to_file/raw.ini=" + baseDir + "/path_to_file/raw.ini",
+		"--file-mark", "path_to_file/raw.ini:type=data",
+	}, gotFileArgs)
+
+	// Check content is written verbatim
+	content, err := os.ReadFile(baseDir + "/lib/capacity.star")
+	if err != nil {
+		t.Fatalf("error not expected %v", err)
+	}
+	assert.Equal(t, "def instances(sessions):\n  return sessions // 128 + 1\nend\n", string(content))
+}
+
+func TestParseAndWriteKYamlRNodesAsYttTemplatesTextLibrary(t *testing.T) {
+	yttBinary, err := exec.LookPath("ytt")
+	if err != nil {
+		t.Skip("ytt not found in PATH")
+	}
+
+	// Text template without extension, loaded by a yaml template rendering its result as a document
+	textItem := kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: amf-ini
+ytt_file_type: text-template
+ytt_file_name: amf
+ytt_template_content: |
+  (@ def render(port): -@)
+  port=(@= str(port) @)
+  (@- end @)
+`)
+	templateItem := kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: amf-template
+  annotations:
+    config.kubernetes.io/path: "amf/template.yaml"
+ytt_template_content: |
+  #@ load("amf.lib.txt", "render")
+  --- #@ render(38412)
+`)
+
+	// Execute function
+	gotFileArgs, baseDir, err := ParseAndWriteKYamlRNodesAsYttTemplates(logger.NewCollector(), textItem, templateItem)
+	if err != nil {
+		t.Fatalf("error not expected %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	// Check ytt loads the text template and renders its result
+	assert.Contains(t, gotFileArgs, "amf.lib.txt="+baseDir+"/amf.lib.txt")
+	out, err := exec.Command(yttBinary, gotFileArgs...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("ytt failed: %v: %s", err, out)
+	}
+	assert.Equal(t, "port=38412\n", string(out))
+}
+
+func TestParseAndWriteKYamlRNodesAsYttTemplatesInlineValues(t *testing.T) {
+	// Inline data values of the function config
+	config.YttInlineValues = kyaml.MustParse("amf:\n  replicas: 3\n")
+	defer func() {
+		config.YttInlineValues = nil
+	}()
+
+	// Execute function
+	gotFileArgs, baseDir, err := ParseAndWriteKYamlRNodesAsYttTemplates(logger.NewCollector(), inputItems[1])
+	defer os.RemoveAll(baseDir)
+	if err != nil {
+		t.Fatalf("error not expected %v", err)
+	}
+
+	// Inline values are passed after all other data values
+	assert.Equal(t, []string{"--data-values-file", baseDir + "/inline-values.yaml"}, gotFileArgs[len(gotFileArgs)-2:])
+	content, err := os.ReadFile(baseDir + "/inline-values.yaml")
+	if err != nil {
+		t.Fatalf("error not expected %v", err)
+	}
+	assert.Equal(t, "amf:\n  replicas: 3\n", string(content))
+}
+
+func TestPlanYttInputs(t *testing.T) {
+	config.YttInputValuesFileHandling = config.ValuesIdentifierKind
+
+	renderTest := kyaml.MustParse("apiVersion: v1alpha1\nkind: YttRenderTest\nmetadata:\n  name: amf\nspec: {}\n")
+
+	// Execute function
+	plan, gotFileArgs, err := PlanYttInputs(logger.NewCollector(), append(append([]*kyaml.RNode{}, inputItems...), renderTest)...)
+	if err != nil {
+		t.Fatalf("error not expected %v", err)
+	}
+
+	// Roles and file names in item order, arguments relative to the removed ytt file directory
+	assert.Len(t, plan, len(inputItems)+1)
+	assert.Equal(t, "template", plan[0].Role)
+	assert.Equal(t, "path_to_file/template.yaml", plan[0].FileName)
+	assert.Equal(t, "values", plan[1].Role)
+	assert.Equal(t, "path_to_file/values.yaml", plan[1].FileName)
+	assert.Equal(t, "output", plan[2].Role)
+	assert.Equal(t, "", plan[2].FileName)
+
+	// Render tests are never passed to ytt
+	assert.Equal(t, "unselected", plan[len(inputItems)].Role)
+	assert.Equal(t, []string{"-f", "path_to_file/template.yaml", "--data-values-file", "path_to_file/values.yaml"}, gotFileArgs)
+}
+
+func TestParseAndWriteKYamlRNodesAsYttTemplatesLibraries(t *testing.T) {
+	// Sample library files of two libraries
+	nfLibItem := kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttLibrary
+metadata:
+  name: nflib-capacity
+ytt_library: nflib
+ytt_file_type: starlark
+ytt_file_name: capacity.star
+ytt_template_content: |
+  def instances(sessions):
+    return sessions // 128 + 1
+  end
+`)
+	otherLibItem := kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttLibrary
+metadata:
+  name: other-lib
+ytt_library: otherlib
+ytt_file_type: starlark
+ytt_file_name: other.star
+ytt_template_content: ""
+`)
+
+	// Test structure
+	tests := []struct {
+		name          string
+		libraries     []string
+		input         []*kyaml.RNode
+		wantFileArgs  []string
+		expectedError string
+	}{ // Test list
+
+		// All libraries are written without selection
+		{
+			"Test all libraries without selection",
+			nil,
+			[]*kyaml.RNode{nfLibItem, otherLibItem},
+			[]string{
+				"-f", "_ytt_lib/nflib/capacity.star=BASE_DIR/_ytt_lib/nflib/capacity.star",
+				"-f", "_ytt_lib/otherlib/other.star=BASE_DIR/_ytt_lib/otherlib/other.star",
+			},
+			"",
+		},
+
+		// Only selected library is written
+		{
+			"Test selected library",
+			[]string{"nflib"},
+			[]*kyaml.RNode{nfLibItem, otherLibItem},
+			[]string{"-f", "_ytt_lib/nflib/capacity.star=BASE_DIR/_ytt_lib/nflib/capacity.star"},
+			"",
+		},
+
+		// Selected library missing in package
+		{
+			"Test missing selected library",
+			[]string{"nflib", "missing"},
+			[]*kyaml.RNode{nfLibItem},
+			nil,
+			"library: missing, selected in function config but no YttLibrary provides it",
+		},
+
+		// Library file without library name
+		{
+			"Test library file without library name",
+			nil,
+			[]*kyaml.RNode{kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttLibrary
+metadata:
+  name: unnamed-lib
+`)},
+			nil,
+			"resource: unnamed-lib, of kind YttLibrary has no ytt_library",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Select libraries and reset after test
+			config.YttLibraries = tt.libraries
+			defer func() {
+				config.YttLibraries = nil
+			}()
+
+			// Execute function
+			gotFileArgs, baseDir, err := ParseAndWriteKYamlRNodesAsYttTemplates(logger.NewCollector(), tt.input...)
+			defer os.RemoveAll(baseDir)
+
+			// Assert error or arguments
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			if err != nil {
+				t.Fatalf("error not expected %v", err)
+			}
+			for i := range tt.wantFileArgs {
+				tt.wantFileArgs[i] = strings.ReplaceAll(tt.wantFileArgs[i], "BASE_DIR", baseDir)
+			}
+			assert.Equal(t, tt.wantFileArgs, gotFileArgs)
+		})
+	}
+}
+
+func Test_processKYamlRNodeErrors(t *testing.T) {
+	// Test structure
+	tests := []struct {
+		name          string
+		input         string
+		expectedError string
+	}{ // Test list
+
+		// Unknown file type
+		{
+			"Test unknown ytt_file_type",
+			`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: unknown-type
+ytt_file_type: binary
+`,
+			"resource: unknown-type, has unknown ytt_file_type: binary, expected one of: [yaml-template text-template starlark data]",
+		},
+
+		// File name escaping the work directory
+		{
+			"Test non local ytt_file_name",
+			`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: escaping-name
+ytt_file_name: ../outside.yaml
+`,
+			"resource: escaping-name, ytt_file_name must be a relative path inside the package: ../outside.yaml",
+		},
+
+		// Structured content for a text template
+		{
+			"Test map content for text-template",
+			`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: map-text
+ytt_file_type: text-template
+ytt_file_name: map-text
+ytt_template_content:
+  key: value
+`,
+			"resource: map-text, ytt_template_content must be a string for text-template files",
+		},
+
+		// Text template ytt would neither load nor render
+		{
+			"Test plain .txt text-template",
+			`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: plain-text
+ytt_file_type: text-template
+ytt_file_name: amf.txt
+ytt_template_content: "port=(@= str(data.values.port) @)"
+`,
+			"resource: plain-text, text-template amf.txt is not rendered to ytt output, name it *.lib.txt and load() it from a yaml template",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Execute function
+			_, err := processKYamlRNode(logger.NewCollector(), kyaml.MustParse(tt.input), t.TempDir(), "")
+
+			// Assert error
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
+
 // Init function to setup test variables
 func init() {
 	inputItems = make([]*kyaml.RNode, 0)
@@ -0,0 +1,153 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// encodeYttOutput serializes a single ytt output document into a string of the given format
+//
+// Parameters:
+//   - document: kyaml.RNode parsed from ytt output
+//   - format: config.YttOutputFormatIdentifier to serialize document to
+//
+// Returns:
+//   - string: serialized document
+//   - error: from decoding or encoding document
+func encodeYttOutput(document *kyaml.RNode, format config.YttOutputFormatIdentifier) (string, error) {
+	switch format {
+
+	// Scalar documents are written as is, everything else falls back to yaml
+	case config.OutputFormatText:
+		if document.YNode().Kind == kyaml.ScalarNode {
+			return document.YNode().Value, nil
+		}
+		return document.String()
+
+	case config.OutputFormatJson:
+		jsonBytes, err := document.MarshalJSON()
+		if err != nil {
+			return "", err
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, jsonBytes, "", "  "); err != nil {
+			return "", err
+		}
+		return indented.String() + "\n", nil
+
+	case config.OutputFormatToml:
+		value, err := decodeYttOutput(document)
+		if err != nil {
+			return "", err
+		}
+		if _, isMap := value.(map[string]interface{}); !isMap {
+			return "", fmt.Errorf("toml output requires a map document, got: %s", document.YNode().Tag)
+		}
+		var tomlBuffer bytes.Buffer
+		tomlEncoder := toml.NewEncoder(&tomlBuffer)
+		tomlEncoder.Indent = ""
+		if err := tomlEncoder.Encode(value); err != nil {
+			return "", err
+		}
+		return tomlBuffer.String(), nil
+
+	case config.OutputFormatProperties:
+		value, err := decodeYttOutput(document)
+		if err != nil {
+			return "", err
+		}
+		var lines []string
+		flattenProperties("", value, &lines)
+		sort.Strings(lines)
+		return strings.Join(lines, "\n") + "\n", nil
+	}
+	return document.String()
+}
+
+// decodeYttOutput decodes kyaml.RNode into generic go values (map[string]interface{}, []interface{}, scalars)
+func decodeYttOutput(document *kyaml.RNode) (value interface{}, err error) {
+	err = document.YNode().Decode(&value)
+	return value, err
+}
+
+// flattenProperties appends dotted key=value lines for each scalar leaf of value
+//
+// Parameters:
+//   - prefix: dotted key of value, empty for the root document
+//   - value: decoded yaml value to flatten
+//   - lines: list to append key=value lines to
+func flattenProperties(prefix string, value interface{}, lines *[]string) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			flattenProperties(joinPropertyKey(prefix, key), child, lines)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			flattenProperties(joinPropertyKey(prefix, strconv.Itoa(i)), child, lines)
+		}
+	case nil:
+		*lines = append(*lines, escapeProperty(prefix, true)+"=")
+	default:
+		*lines = append(*lines, escapeProperty(prefix, true)+"="+escapeProperty(fmt.Sprint(typed), false))
+	}
+}
+
+// joinPropertyKey joins prefix and key with a dot separator
+func joinPropertyKey(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// escapeProperty escapes characters that carry meaning in a .properties file
+func escapeProperty(value string, isKey bool) string {
+	var escaped strings.Builder
+	for i, char := range value {
+		switch char {
+		case '\\':
+			escaped.WriteString(`\\`)
+		case '\n':
+			escaped.WriteString(`\n`)
+		case '\r':
+			escaped.WriteString(`\r`)
+		case '\t':
+			escaped.WriteString(`\t`)
+		case '=', ':', '#', '!':
+			escaped.WriteRune('\\')
+			escaped.WriteRune(char)
+		case ' ':
+			// Spaces are only significant inside keys or as leading value characters
+			if isKey || i == 0 {
+				escaped.WriteRune('\\')
+			}
+			escaped.WriteRune(char)
+		default:
+			escaped.WriteRune(char)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/stretchr/testify/assert"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func Test_encodeYttOutput(t *testing.T) {
+	// Sample ytt output document
+	document := `
+amf:
+  name: amf-1
+  port: 8080
+  sbi:
+    enabled: true
+  plmn:
+  - mcc: "208"
+    mnc: "93"
+`
+
+	// Test structure
+	tests := []struct {
+		name     string
+		document string
+		format   config.YttOutputFormatIdentifier
+		expected string
+		wantErr  bool
+	}{ // Test list
+
+		// Yaml document serialized as yaml string
+		{
+			"Test yaml format",
+			document,
+			config.OutputFormatYaml,
+			"amf:\n  name: amf-1\n  port: 8080\n  sbi:\n    enabled: true\n  plmn:\n  - mcc: \"208\"\n    mnc: \"93\"\n",
+			false,
+		},
+
+		// Scalar document written verbatim
+		{
+			"Test text format with scalar document",
+			"|\n  [amf]\n  name = amf-1\n",
+			config.OutputFormatText,
+			"[amf]\nname = amf-1\n",
+			false,
+		},
+
+		// Json serialization
+		{
+			"Test json format",
+			document,
+			config.OutputFormatJson,
+			`{
+  "amf": {
+    "name": "amf-1",
+    "plmn": [
+      {
+        "mcc": "208",
+        "mnc": "93"
+      }
+    ],
+    "port": 8080,
+    "sbi": {
+      "enabled": true
+    }
+  }
+}
+`,
+			false,
+		},
+
+		// Toml serialization
+		{
+			"Test toml format",
+			document,
+			config.OutputFormatToml,
+			`[amf]
+name = "amf-1"
+port = 8080
+
+[[amf.plmn]]
+mcc = "208"
+mnc = "93"
+[amf.sbi]
+enabled = true
+`,
+			false,
+		},
+
+		// Toml serialization of a non map document
+		{
+			"Test toml format with list document",
+			"- item",
+			config.OutputFormatToml,
+			"",
+			true,
+		},
+
+		// Properties serialization
+		{
+			"Test properties format",
+			document + "  description: \"a=b c\"\n",
+			config.OutputFormatProperties,
+			"amf.description=a\\=b c\namf.name=amf-1\namf.plmn.0.mcc=208\namf.plmn.0.mnc=93\namf.port=8080\namf.sbi.enabled=true\n",
+			false,
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Execute function
+			output, err := encodeYttOutput(kyaml.MustParse(tt.document), tt.format)
+
+			// Check if error received and not expected
+			if err != nil && !tt.wantErr {
+				t.Fatalf("error not expected %v", err)
+
+				// Check if error expected but not received
+			} else if err == nil && tt.wantErr {
+				t.Fatalf("error expected but not received %v", err)
+			}
+
+			// Assert response
+			assert.Equal(t, tt.expected, output)
+		})
+	}
+}
@@ -0,0 +1,468 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/kustomize/kyaml/openapi"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Resources and OpenAPI keys providing schemas of output documents
+const (
+	crdKind                    = "CustomResourceDefinition"             // Kind of CustomResourceDefinitions
+	crdGroup                   = "apiextensions.k8s.io"                 // API group of CustomResourceDefinitions
+	openAPISchemaKind          = "OpenAPISchema"                        // Kind of resources holding an OpenAPI document under values
+	openAPISchemaValuesKey     = "values"                               // Key of the OpenAPI document in OpenAPISchema resources
+	openAPIGroupVersionKindKey = "x-kubernetes-group-version-kind"      // OpenAPI extension naming the resource types of a schema
+	openAPIPreserveUnknownKey  = "x-kubernetes-preserve-unknown-fields" // OpenAPI extension allowing fields not listed as properties
+	openAPIIntOrStringKey      = "x-kubernetes-int-or-string"           // OpenAPI extension of fields given as integer or string
+	openAPIQuantityRefSuffix   = "resource.Quantity"                    // Reference of quantities, strings also given as numbers
+	builtInSchemaSource        = "built-in Kubernetes schema"           // Source reported for schemas built into kyaml
+	fieldNamePattern           = `^[A-Za-z_][A-Za-z0-9_-]*$`            // Keys written as .name in JSONPaths
+)
+
+var fieldNameRegexp = regexp.MustCompile(fieldNamePattern)
+
+// OutputSchemas OpenAPI schemas of the package by apiVersion and kind, ytt output documents that are resources
+// are validated against them, falling back to the Kubernetes schemas built into kyaml
+type OutputSchemas map[kyaml.TypeMeta]*outputSchema
+
+// outputSchema schema of a single resource type
+//
+// schema: OpenAPI schema of the resource
+//
+// source: resource the schema was read from, reported with validation errors
+//
+// resolve: resolves references of schema against the document it was read from
+type outputSchema struct {
+	schema  *spec.Schema
+	source  string
+	resolve func(ref *spec.Ref) (*spec.Schema, error)
+}
+
+// ReadOutputSchemas reads schemas of CustomResourceDefinitions and OpenAPISchema resources in items
+// Schemas of an OpenAPISchema are matched by their x-kubernetes-group-version-kind extension
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - items: package resources
+//
+// Returns:
+//   - OutputSchemas: schemas found, empty when the package has none
+//   - error: when a schema resource is invalid
+func ReadOutputSchemas(results *logger.Collector, items ...*kyaml.RNode) (OutputSchemas, error) {
+	schemas := OutputSchemas{}
+	for _, item := range items {
+		var err error
+		switch {
+		case item.GetKind() == crdKind && strings.HasPrefix(item.GetApiVersion(), crdGroup+"/"):
+			err = readCRDSchemas(schemas, item)
+		case item.GetKind() == openAPISchemaKind:
+			err = readOpenAPISchemas(schemas, item)
+		default:
+			continue
+		}
+		if err != nil {
+			results.LogReferencedError(err.Error(), logger.Reference{Item: item}, nil)
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+// readCRDSchemas adds the schema of every version of a CustomResourceDefinition to schemas
+func readCRDSchemas(schemas OutputSchemas, item *kyaml.RNode) error {
+	var crd struct {
+		Spec struct {
+			Group string `yaml:"group"`
+			Names struct {
+				Kind string `yaml:"kind"`
+			} `yaml:"names"`
+			Versions []struct {
+				Name   string `yaml:"name"`
+				Schema struct {
+					OpenAPIV3Schema kyaml.Node `yaml:"openAPIV3Schema"`
+				} `yaml:"schema"`
+			} `yaml:"versions"`
+		} `yaml:"spec"`
+	}
+	if err := item.YNode().Decode(&crd); err != nil {
+		return fmt.Errorf("%s %s is invalid: %v", crdKind, item.GetName(), err)
+	}
+	for _, version := range crd.Spec.Versions {
+		if version.Schema.OpenAPIV3Schema.Kind == 0 {
+			continue
+		}
+		content, err := kyaml.NewRNode(&version.Schema.OpenAPIV3Schema).MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("%s %s has an invalid schema for version %s: %v", crdKind, item.GetName(), version.Name, err)
+		}
+		schema := &spec.Schema{}
+		if err := schema.UnmarshalJSON(content); err != nil {
+			return fmt.Errorf("%s %s has an invalid schema for version %s: %v", crdKind, item.GetName(), version.Name, err)
+		}
+		source := fmt.Sprintf("%s %s", crdKind, item.GetName())
+		schemas[kyaml.TypeMeta{APIVersion: crd.Spec.Group + "/" + version.Name, Kind: crd.Spec.Names.Kind}] = &outputSchema{
+			schema: schema,
+			source: source,
+			resolve: func(ref *spec.Ref) (*spec.Schema, error) {
+				return nil, fmt.Errorf("%s does not support references: %s", source, ref.String())
+			},
+		}
+	}
+	return nil
+}
+
+// readOpenAPISchemas adds schemas of the OpenAPI document under values of item naming their resource types to schemas,
+// both OpenAPI v3 components and v2 definitions are read
+func readOpenAPISchemas(schemas OutputSchemas, item *kyaml.RNode) error {
+	values := item.Field(openAPISchemaValuesKey)
+	if values.IsNilOrEmpty() {
+		return fmt.Errorf("%s %s has no %s", openAPISchemaKind, item.GetName(), openAPISchemaValuesKey)
+	}
+	content, err := values.Value.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("%s %s is invalid: %v", openAPISchemaKind, item.GetName(), err)
+	}
+	var document map[string]any
+	if err := json.Unmarshal(content, &document); err != nil {
+		return fmt.Errorf("%s %s is invalid: %v", openAPISchemaKind, item.GetName(), err)
+	}
+
+	source := fmt.Sprintf("%s %s", openAPISchemaKind, item.GetName())
+	resolve := func(ref *spec.Ref) (*spec.Schema, error) {
+		value, _, err := ref.GetPointer().Get(document)
+		if err != nil {
+			return nil, fmt.Errorf("%s has an unresolvable reference %s: %v", source, ref.String(), err)
+		}
+		return toSchema(value)
+	}
+	definitions := map[string]any{}
+	if components, ok := document["components"].(map[string]any); ok {
+		if componentSchemas, ok := components["schemas"].(map[string]any); ok {
+			definitions = componentSchemas
+		}
+	}
+	if v2Definitions, ok := document["definitions"].(map[string]any); ok {
+		for name, definition := range v2Definitions {
+			definitions[name] = definition
+		}
+	}
+	for name, definition := range definitions {
+		schema, err := toSchema(definition)
+		if err != nil {
+			return fmt.Errorf("%s %s has an invalid schema %s: %v", openAPISchemaKind, item.GetName(), name, err)
+		}
+		groupVersionKinds, _ := schema.Extensions[openAPIGroupVersionKindKey].([]any)
+		for _, groupVersionKind := range groupVersionKinds {
+			gvk, ok := groupVersionKind.(map[string]any)
+			if !ok {
+				continue
+			}
+			apiVersion := fmt.Sprint(gvk["version"])
+			if group := fmt.Sprint(gvk["group"]); gvk["group"] != nil && group != "" {
+				apiVersion = group + "/" + apiVersion
+			}
+			schemas[kyaml.TypeMeta{APIVersion: apiVersion, Kind: fmt.Sprint(gvk["kind"])}] = &outputSchema{
+				schema:  schema,
+				source:  source,
+				resolve: resolve,
+			}
+		}
+	}
+	return nil
+}
+
+// toSchema converts a decoded json value to an OpenAPI schema
+func toSchema(value any) (*spec.Schema, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	schema := &spec.Schema{}
+	if err := schema.UnmarshalJSON(content); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// lookup returns the schema of typeMeta, from the package or built into kyaml, nil when there is none
+func (schemas OutputSchemas) lookup(typeMeta kyaml.TypeMeta) *outputSchema {
+	if schema, found := schemas[typeMeta]; found {
+		return schema
+	}
+	builtIn := openapi.SchemaForResourceType(typeMeta)
+	if builtIn.IsMissingOrNull() {
+		return nil
+	}
+	return &outputSchema{
+		schema: builtIn.Schema,
+		source: builtInSchemaSource,
+		resolve: func(ref *spec.Ref) (*spec.Schema, error) {
+			return openapi.Resolve(ref, openapi.Schema())
+		},
+	}
+}
+
+// validateOutputSchema checks a ytt output document that is a resource against the schema of its apiVersion and kind
+// Every field error is reported with a reference to the output resource, documents without schema are skipped
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - schemas: schemas of the package, nil when schema validation is disabled
+//   - document: parsed ytt output document, before secret fields are moved out
+//   - index: position of the document in ytt output
+//   - item: output resource the document is written to
+//
+// Returns:
+//   - error: when the document does not match its schema
+func validateOutputSchema(results *logger.Collector, schemas OutputSchemas, document *kyaml.RNode, index int, item *kyaml.RNode) error {
+	if schemas == nil || document.YNode().Kind != kyaml.MappingNode {
+		return nil
+	}
+	typeMeta := kyaml.TypeMeta{APIVersion: document.GetApiVersion(), Kind: document.GetKind()}
+	if typeMeta.APIVersion == "" || typeMeta.Kind == "" {
+		return nil
+	}
+	schema := schemas.lookup(typeMeta)
+	if schema == nil {
+		results.LogReferencedDebug(fmt.Sprintf("No schema found for ytt output document %d: %s/%s", index, typeMeta.APIVersion, typeMeta.Kind),
+			logger.Reference{Item: item, Field: config.YttOutputElementKey}, nil)
+		return nil
+	}
+
+	validator := &schemaValidator{resolve: schema.resolve, following: map[string]bool{}}
+	validator.validate(document.YNode(), schema.schema, "$", false)
+	for _, fieldError := range validator.errors {
+		results.LogReferencedError(fieldError, logger.Reference{Item: item, Field: config.YttOutputElementKey}, map[string]string{
+			"document_index": strconv.Itoa(index),
+			"schema":         schema.source,
+		})
+	}
+	if len(validator.errors) > 0 {
+		return fmt.Errorf("ytt output document %d for %s does not match schema of %s/%s: %d errors",
+			index, item.GetName(), typeMeta.APIVersion, typeMeta.Kind, len(validator.errors))
+	}
+	return nil
+}
+
+// schemaValidator collects field errors of a document walked against its schema
+//
+// following: references followed at a path and not yet left, a reference reached again at the same
+// path never descends into the document and would recurse forever
+type schemaValidator struct {
+	resolve   func(ref *spec.Ref) (*spec.Schema, error)
+	errors    []string
+	following map[string]bool
+}
+
+// fail records a field error at path
+func (validator *schemaValidator) fail(path string, format string, args ...any) {
+	validator.errors = append(validator.errors, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+// validate checks node at path against schema and all of its fields against their property schemas
+// Null values are treated as omitted fields, oneOf, anyOf and not are not checked
+func (validator *schemaValidator) validate(node *kyaml.Node, schema *spec.Schema, path string, quantity bool) {
+	for node.Kind == kyaml.DocumentNode || node.Kind == kyaml.AliasNode {
+		if node.Kind == kyaml.AliasNode {
+			node = node.Alias
+		} else {
+			node = node.Content[0]
+		}
+	}
+	if ref := schema.Ref.String(); ref != "" {
+		key := path + " " + ref
+		if validator.following[key] {
+			validator.fail(path, "schema reference %s is circular", ref)
+			return
+		}
+		resolved, err := validator.resolve(&schema.Ref)
+		if err != nil || resolved == nil {
+			validator.fail(path, "schema reference %s cannot be resolved: %v", ref, err)
+			return
+		}
+		validator.following[key] = true
+		validator.validate(node, resolved, path, strings.HasSuffix(ref, openAPIQuantityRefSuffix))
+		delete(validator.following, key)
+		return
+	}
+	for i := range schema.AllOf {
+		validator.validate(node, &schema.AllOf[i], path, quantity)
+	}
+	actual := nodeType(node)
+	if actual == "null" {
+		return
+	}
+	if !validator.matchesType(schema, actual, quantity) {
+		validator.fail(path, "expected %s, got %s", strings.Join(schema.Type, " or "), actual)
+		return
+	}
+
+	validator.validateScalar(node, schema, path, actual)
+	switch node.Kind {
+	case kyaml.MappingNode:
+		validator.validateFields(node, schema, path)
+	case kyaml.SequenceNode:
+		if schema.MinItems != nil && int64(len(node.Content)) < *schema.MinItems {
+			validator.fail(path, "must have at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && int64(len(node.Content)) > *schema.MaxItems {
+			validator.fail(path, "must have at most %d items", *schema.MaxItems)
+		}
+		if schema.Items != nil && schema.Items.Schema != nil {
+			for i, element := range node.Content {
+				validator.validate(element, schema.Items.Schema, fmt.Sprintf("%s[%d]", path, i), false)
+			}
+		}
+	}
+}
+
+// validateFields checks required and unknown fields of a map and its fields against their property schemas
+func (validator *schemaValidator) validateFields(node *kyaml.Node, schema *spec.Schema, path string) {
+	present := map[string]bool{}
+	preserveUnknown, _ := schema.Extensions.GetBool(openAPIPreserveUnknownKey)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		present[key] = true
+		fieldPath := childPath(path, key)
+		if property, found := schema.Properties[key]; found {
+			validator.validate(value, &property, fieldPath, false)
+			continue
+		}
+		switch additional := schema.AdditionalProperties; {
+		case additional != nil && additional.Schema != nil:
+			validator.validate(value, additional.Schema, fieldPath, false)
+		case additional != nil && !additional.Allows && !preserveUnknown:
+			validator.fail(fieldPath, "unknown field")
+		case additional == nil && len(schema.Properties) > 0 && !preserveUnknown:
+			validator.fail(fieldPath, "unknown field")
+		}
+	}
+	for _, required := range schema.Required {
+		if !present[required] {
+			validator.fail(path, "missing required field %s", required)
+		}
+	}
+}
+
+// validateScalar checks enum, bounds, length and pattern of a scalar
+func (validator *schemaValidator) validateScalar(node *kyaml.Node, schema *spec.Schema, path string, actual string) {
+	if node.Kind != kyaml.ScalarNode {
+		return
+	}
+	if len(schema.Enum) > 0 {
+		var value any
+		_ = node.Decode(&value)
+		encoded, _ := json.Marshal(value)
+		allowed := make([]string, 0, len(schema.Enum))
+		matched := false
+		for _, enum := range schema.Enum {
+			encodedEnum, _ := json.Marshal(enum)
+			matched = matched || string(encodedEnum) == string(encoded)
+			allowed = append(allowed, fmt.Sprint(enum))
+		}
+		if !matched {
+			validator.fail(path, "must be one of [%s], got %s", strings.Join(allowed, " "), node.Value)
+		}
+	}
+	if actual == "integer" || actual == "number" {
+		number, err := strconv.ParseFloat(node.Value, 64)
+		if err != nil {
+			return
+		}
+		if schema.Minimum != nil && (number < *schema.Minimum || schema.ExclusiveMinimum && number == *schema.Minimum) {
+			validator.fail(path, "must be at least %v, got %s", *schema.Minimum, node.Value)
+		}
+		if schema.Maximum != nil && (number > *schema.Maximum || schema.ExclusiveMaximum && number == *schema.Maximum) {
+			validator.fail(path, "must be at most %v, got %s", *schema.Maximum, node.Value)
+		}
+	}
+	if actual == "string" {
+		length := int64(len([]rune(node.Value)))
+		if schema.MinLength != nil && length < *schema.MinLength {
+			validator.fail(path, "must be at least %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			validator.fail(path, "must be at most %d characters", *schema.MaxLength)
+		}
+		if schema.Pattern != "" {
+			if pattern, err := regexp.Compile(schema.Pattern); err == nil && !pattern.MatchString(node.Value) {
+				validator.fail(path, "must match pattern %s", schema.Pattern)
+			}
+		}
+	}
+}
+
+// matchesType checks whether a value of type actual is allowed by the type of schema
+// Integers are numbers, quantities and int-or-string fields accept numbers and strings
+func (validator *schemaValidator) matchesType(schema *spec.Schema, actual string, quantity bool) bool {
+	intOrString, _ := schema.Extensions.GetBool(openAPIIntOrStringKey)
+	if len(schema.Type) == 0 && !intOrString {
+		return true
+	}
+	if intOrString || schema.Format == "int-or-string" {
+		return actual == "integer" || actual == "string"
+	}
+	for _, expected := range schema.Type {
+		switch {
+		case expected == actual:
+			return true
+		case expected == "number" && actual == "integer":
+			return true
+		case expected == "string" && quantity && (actual == "integer" || actual == "number"):
+			return true
+		}
+	}
+	return false
+}
+
+// nodeType returns the OpenAPI type of a yaml node
+func nodeType(node *kyaml.Node) string {
+	switch node.Kind {
+	case kyaml.MappingNode:
+		return "object"
+	case kyaml.SequenceNode:
+		return "array"
+	}
+	switch node.ShortTag() {
+	case kyaml.NodeTagNull:
+		return "null"
+	case kyaml.NodeTagBool:
+		return "boolean"
+	case kyaml.NodeTagInt:
+		return "integer"
+	case kyaml.NodeTagFloat:
+		return "number"
+	}
+	return "string"
+}
+
+// childPath appends key to a JSONPath, quoting keys that are not plain names, e.g. $.data['values.yaml']
+func childPath(path string, key string) string {
+	if fieldNameRegexp.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "['" + strings.ReplaceAll(key, "'", "\\'") + "']"
+}
@@ -0,0 +1,310 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// schemaItems a CustomResourceDefinition and an OpenAPISchema with a reference between its schemas
+func schemaItems() []*kyaml.RNode {
+	return []*kyaml.RNode{
+		kyaml.MustParse(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: amfdeployments.nf.example.com
+spec:
+  group: nf.example.com
+  names: {kind: AmfDeployment}
+  versions:
+    - name: v1alpha1
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            apiVersion: {type: string}
+            kind: {type: string}
+            metadata: {type: object}
+            spec:
+              type: object
+              required: [capacity]
+              properties:
+                capacity: {type: integer, minimum: 1, maximum: 100}
+                mode: {type: string, enum: [active, standby]}
+                plmn: {type: string, pattern: '^[0-9]{5,6}$'}
+                interfaces: {type: array, maxItems: 2, items: {type: string}}
+                labels: {type: object, additionalProperties: {type: string}}
+                extra: {type: object, x-kubernetes-preserve-unknown-fields: true}
+`),
+		kyaml.MustParse(`
+apiVersion: v1
+kind: OpenAPISchema
+metadata:
+  name: smf-schema
+values:
+  openapi: 3.0.0
+  components:
+    schemas:
+      SmfConfig:
+        type: object
+        x-kubernetes-group-version-kind: [{group: nf.example.com, version: v1, kind: SmfConfig}]
+        properties:
+          apiVersion: {type: string}
+          kind: {type: string}
+          dnn: {$ref: '#/components/schemas/Dnn'}
+      Dnn:
+        type: object
+        additionalProperties: false
+        properties:
+          name: {type: string}
+      NetworkSlice:
+        type: object
+        x-kubernetes-group-version-kind: [{group: nf.example.com, version: v1, kind: NetworkSlice}]
+        properties:
+          apiVersion: {type: string}
+          kind: {type: string}
+          parent: {$ref: '#/components/schemas/NetworkSlice'}
+          sst: {$ref: '#/components/schemas/Sst'}
+      Sst:
+        allOf: [{$ref: '#/components/schemas/SstValue'}]
+      SstValue:
+        allOf: [{$ref: '#/components/schemas/Sst'}]
+`),
+	}
+}
+
+func TestValidateOutputSchema(t *testing.T) {
+	schemas, err := ReadOutputSchemas(logger.NewCollector(), schemaItems()...)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Test structure
+	tests := []struct {
+		name           string
+		document       string
+		expectedErr    string
+		expectedErrors []string
+		expectedSource string
+	}{ // Test list
+
+		// Built-in Kubernetes schemas, quantities and int-or-string fields accept numbers
+		{
+			"Test valid built-in resource",
+			`
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: amf, labels: {app: amf}}
+spec:
+  replicas: 2
+  selector: {matchLabels: {app: amf}}
+  template:
+    spec:
+      containers:
+        - name: amf
+          image: free5gc/amf
+          resources: {limits: {cpu: 1, memory: 512Mi}}
+          livenessProbe: {httpGet: {port: 8080}}
+`,
+			"",
+			nil,
+			"",
+		},
+
+		// Typos and wrong types in built-in resources
+		{
+			"Test invalid built-in resource",
+			`
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: amf}
+spec:
+  replica: 2
+  minReadySeconds: "10"
+  template:
+    spec:
+      containers:
+        - {name: amf, imagePullPolicy: [Always]}
+`,
+			"ytt output document 0 for amf-values does not match schema of apps/v1/Deployment: 4 errors",
+			[]string{
+				"$.spec.replica: unknown field",
+				"$.spec.minReadySeconds: expected integer, got string",
+				"$.spec.template.spec.containers[0].imagePullPolicy: expected string, got array",
+				"$.spec: missing required field selector",
+			},
+			"built-in Kubernetes schema",
+		},
+
+		// CustomResourceDefinitions of the package
+		{
+			"Test invalid custom resource",
+			`
+apiVersion: nf.example.com/v1alpha1
+kind: AmfDeployment
+spec:
+  mode: primary
+  plmn: "0011"
+  interfaces: [n1, n2, n11]
+  labels: {tier: 1}
+  extra: {anything: goes}
+  capacity: 0
+`,
+			"ytt output document 0 for amf-values does not match schema of nf.example.com/v1alpha1/AmfDeployment: 5 errors",
+			[]string{
+				"$.spec.mode: must be one of [active standby], got primary",
+				"$.spec.plmn: must match pattern ^[0-9]{5,6}$",
+				"$.spec.interfaces: must have at most 2 items",
+				"$.spec.labels.tier: expected string, got integer",
+				"$.spec.capacity: must be at least 1, got 0",
+			},
+			"CustomResourceDefinition amfdeployments.nf.example.com",
+		},
+
+		// Missing required fields of custom resources
+		{
+			"Test missing required field",
+			"apiVersion: nf.example.com/v1alpha1\nkind: AmfDeployment\nspec: {}\n",
+			"ytt output document 0 for amf-values does not match schema of nf.example.com/v1alpha1/AmfDeployment: 1 errors",
+			[]string{"$.spec: missing required field capacity"},
+			"CustomResourceDefinition amfdeployments.nf.example.com",
+		},
+
+		// References resolved within OpenAPISchema documents
+		{
+			"Test invalid OpenAPISchema resource",
+			"apiVersion: nf.example.com/v1\nkind: SmfConfig\ndnn: {name: internet, mtu: 1500}\n",
+			"ytt output document 0 for amf-values does not match schema of nf.example.com/v1/SmfConfig: 1 errors",
+			[]string{"$.dnn.mtu: unknown field"},
+			"OpenAPISchema smf-schema",
+		},
+
+		// Recursive references follow the document, circular ones stop at the first repeat
+		{
+			"Test recursive and circular references",
+			"apiVersion: nf.example.com/v1\nkind: NetworkSlice\nparent: {parent: {sst: 1}}\n",
+			"ytt output document 0 for amf-values does not match schema of nf.example.com/v1/NetworkSlice: 1 errors",
+			[]string{"$.parent.parent.sst: schema reference #/components/schemas/Sst is circular"},
+			"OpenAPISchema smf-schema",
+		},
+
+		// Documents that are no resources or have no schema are skipped
+		{
+			"Test document without apiVersion",
+			"amf: {replicas: two}\n",
+			"",
+			nil,
+			"",
+		},
+		{
+			"Test resource without schema",
+			"apiVersion: nf.example.com/v2\nkind: AmfDeployment\nspec: {}\n",
+			"",
+			nil,
+			"",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := logger.NewCollector()
+			item := kyaml.MustParse("apiVersion: v1\nkind: Configuration\nmetadata:\n  name: amf-values\ndata: {}\n")
+
+			// Execute function
+			err := validateOutputSchema(results, schemas, kyaml.MustParse(tt.document), 0, item)
+
+			// Assert response
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr)
+			}
+			var gotErrors []string
+			for _, result := range results.Results {
+				if result.Severity == framework.Severity(logger.LogLevelStrings[logger.LogLevelError]) {
+					gotErrors = append(gotErrors, result.Message)
+					assert.Equal(t, "amf-values", result.ResourceRef.Name)
+					assert.Equal(t, tt.expectedSource, result.Tags["schema"])
+				}
+			}
+			assert.Equal(t, tt.expectedErrors, gotErrors)
+		})
+	}
+}
+
+func TestReadOutputSchemasErrors(t *testing.T) {
+	// Test structure
+	tests := []struct {
+		name        string
+		item        string
+		expectedErr string
+	}{ // Test list
+		{
+			"Test OpenAPISchema without values",
+			"apiVersion: v1\nkind: OpenAPISchema\nmetadata:\n  name: empty\n",
+			"OpenAPISchema empty has no values",
+		},
+		{
+			"Test invalid CustomResourceDefinition",
+			"apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: broken\nspec:\n  versions: v1\n",
+			"CustomResourceDefinition broken is invalid",
+		},
+		{
+			"Test invalid CustomResourceDefinition schema",
+			"apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: broken\nspec:\n  versions: [{name: v1, schema: {openAPIV3Schema: {type: 1}}}]\n",
+			"CustomResourceDefinition broken has an invalid schema for version v1",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := logger.NewCollector()
+
+			// Execute function
+			_, err := ReadOutputSchemas(results, kyaml.MustParse(tt.item))
+
+			// Assert response
+			assert.ErrorContains(t, err, tt.expectedErr)
+			assert.Equal(t, err.Error(), results.Results[0].Message)
+		})
+	}
+}
+
+func TestUnmarshalYttOutputSchemaValidation(t *testing.T) {
+	schemas, err := ReadOutputSchemas(logger.NewCollector(), schemaItems()...)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	outputs := []*kyaml.RNode{
+		kyaml.MustParse("apiVersion: v1\nkind: Configuration\nmetadata:\n  name: amf-values\ndata: {}\n"),
+	}
+	yttOutput := "apiVersion: nf.example.com/v1alpha1\nkind: AmfDeployment\nspec: {capacity: 500}\n"
+
+	// Execute function
+	err = UnmarshalYttOutput(logger.NewCollector(), strings.NewReader(yttOutput), outputs, OutputOptions{Schemas: schemas})
+
+	// Invalid documents are not written
+	assert.EqualError(t, err, "ytt output document 0 for amf-values does not match schema of nf.example.com/v1alpha1/AmfDeployment: 1 errors")
+	assert.Equal(t, "{}", outputs[0].Field("data").Value.MustString()[:2])
+}
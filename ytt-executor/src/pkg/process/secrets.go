@@ -0,0 +1,246 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/fileWriter"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Identifiers of Kubernetes Secret resources
+const (
+	secretAPIVersion    = "v1"            // apiVersion of Secret resources
+	secretKind          = "Secret"        // kind of Secret resources
+	secretDataKey       = "data"          // key holding base64 encoded Secret data
+	secretStringDataKey = "stringData"    // key holding plain Secret data
+	secretValuesDir     = "secret-values" // directory data values files of bound Secrets are written to
+)
+
+// isSecret checks if item is a v1 Secret
+func isSecret(item *kyaml.RNode) bool {
+	return item.GetApiVersion() == secretAPIVersion && item.GetKind() == secretKind
+}
+
+// FindSecrets returns all v1 Secrets of items
+func FindSecrets(items []*kyaml.RNode) (secrets []*kyaml.RNode) {
+	for _, item := range items {
+		if isSecret(item) {
+			secrets = append(secrets, item)
+		}
+	}
+	return secrets
+}
+
+// getSecretValue returns the config.YttSecretValue binding item as data values
+//
+// Parameters:
+//   - item: yaml.RNode to check
+//
+// Returns:
+//   - config.YttSecretValue: binding of item
+//   - bool: whether item is a v1 Secret bound in config.YttSecretValues
+func getSecretValue(item *kyaml.RNode) (config.YttSecretValue, bool) {
+	if !isSecret(item) {
+		return config.YttSecretValue{}, false
+	}
+	for _, secretValue := range config.YttSecretValues {
+		if secretValue.Name == item.GetName() {
+			return secretValue, true
+		}
+	}
+	return config.YttSecretValue{}, false
+}
+
+// decodeSecretData reads base64 decoded data of a Secret, stringData takes precedence like in Kubernetes
+//
+// Parameters:
+//   - item: v1 Secret
+//
+// Returns:
+//   - map[string]string: decoded Secret data
+//   - error: when data is not base64 encoded
+func decodeSecretData(item *kyaml.RNode) (map[string]string, error) {
+	data := map[string]string{}
+	for key, value := range item.GetDataMap() {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("secret: %s, %s key %s is not base64 encoded", item.GetName(), secretDataKey, key)
+		}
+		data[key] = string(decoded)
+	}
+	if stringData := item.Field(secretStringDataKey); !stringData.IsNilOrEmpty() {
+		err := stringData.Value.VisitFields(func(field *kyaml.MapNode) error {
+			data[field.Key.YNode().Value] = field.Value.YNode().Value
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// writeSecretValues writes decoded data of a bound Secret to baseDir as a ytt data values file
+//
+// Parameters:
+//   - item: v1 Secret bound in config.YttSecretValues
+//   - secretValue: binding of item
+//   - baseDir: directory to write file to
+//
+// Returns:
+//   - string: name of the written data values file
+//   - error: from decoding Secret data or writing the file
+func writeSecretValues(item *kyaml.RNode, secretValue config.YttSecretValue, baseDir string) (string, error) {
+	data, err := decodeSecretData(item)
+	if err != nil {
+		return "", err
+	}
+
+	// Nest Secret keys under binding path
+	values := kyaml.NewMapRNode(nil)
+	target := values
+	if secretValue.Path != "" {
+		target, err = values.Pipe(kyaml.LookupCreate(kyaml.MappingNode, strings.Split(secretValue.Path, ".")...))
+		if err != nil {
+			return "", err
+		}
+	}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := target.PipeE(kyaml.SetField(key, kyaml.NewStringRNode(data[key]))); err != nil {
+			return "", err
+		}
+	}
+
+	fileName := path.Join(baseDir, secretValuesDir, item.GetName()+".yaml")
+	content, err := values.String()
+	if err != nil {
+		return "", err
+	}
+	return fileName, fileWriter.WriteToFile(fileName, content)
+}
+
+// secretFieldValue an output field taken out of a ytt output document, to be written to its Secret
+//
+// secret: v1 Secret of the package receiving value
+//
+// path: path of the field in the ytt output document
+//
+// key: key of value under data of secret
+//
+// value: field value, scalars as is and anything else as yaml
+type secretFieldValue struct {
+	secret *kyaml.RNode
+	path   string
+	key    string
+	value  string
+}
+
+// takeSecretFields removes config.YttSecretFields found in a ytt output document, without writing any Secret yet
+//
+// Parameters:
+//   - results: logger.Collector of the current run, taken values are registered with its Redactor
+//   - document: parsed ytt output document, taken fields are removed from it
+//   - secrets: v1 Secrets of the package
+//
+// Returns:
+//   - []secretFieldValue: taken fields with their Secrets, for writeSecretFields
+//   - error: when a Secret is missing or a field cannot be removed
+func takeSecretFields(results *logger.Collector, document *kyaml.RNode, secrets []*kyaml.RNode) ([]secretFieldValue, error) {
+	var values []secretFieldValue
+	for _, secretField := range config.YttSecretFields {
+		fieldPath := strings.Split(secretField.Path, ".")
+		field, err := document.Pipe(kyaml.Lookup(fieldPath...))
+		if err != nil || field == nil {
+			continue
+		}
+
+		// Scalars are stored as is, anything else as yaml
+		value := field.YNode().Value
+		if field.YNode().Kind != kyaml.ScalarNode {
+			if value, err = field.String(); err != nil {
+				return nil, err
+			}
+		}
+		if results.Redactor != nil {
+			results.Redactor.AddValue(value)
+		}
+
+		secret := findSecret(secrets, secretField.Secret)
+		if secret == nil {
+			return nil, fmt.Errorf("secret: %s, selected for output field %s but not found in package", secretField.Secret, secretField.Path)
+		}
+		key := secretField.Key
+		if key == "" {
+			key = fieldPath[len(fieldPath)-1]
+		}
+		values = append(values, secretFieldValue{secret: secret, path: secretField.Path, key: key, value: value})
+
+		// Keep secret material out of the output resource
+		err = document.PipeE(kyaml.Lookup(fieldPath[:len(fieldPath)-1]...), kyaml.Clear(fieldPath[len(fieldPath)-1]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// writeSecretFields writes values taken by takeSecretFields base64 encoded to their Secrets
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - values: taken output fields
+//
+// Returns:
+//   - error: when a Secret cannot be written
+func writeSecretFields(results *logger.Collector, values []secretFieldValue) error {
+	for _, value := range values {
+		results.LogReferencedInfo(
+			fmt.Sprintf("Writing output field: %s, to secret key: %s", value.path, value.key),
+			logger.Reference{Item: value.secret, Field: secretDataKey + "." + value.key},
+			nil,
+		)
+		err := value.secret.PipeE(
+			kyaml.LookupCreate(kyaml.MappingNode, secretDataKey),
+			kyaml.SetField(value.key, kyaml.NewStringRNode(base64.StdEncoding.EncodeToString([]byte(value.value)))),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findSecret returns the Secret of secrets with given name, nil when missing
+func findSecret(secrets []*kyaml.RNode, name string) *kyaml.RNode {
+	for _, secret := range secrets {
+		if secret.GetName() == name {
+			return secret
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"os"
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Sample Secret with encoded and plain data
+const sampleSecret = `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: nrf-credentials
+data:
+  token: bnJmLXRva2Vu
+  user: YW1m
+stringData:
+  user: amf-override
+`
+
+func TestWriteSecretValues(t *testing.T) {
+	// Test structure
+	tests := []struct {
+		name          string
+		secret        string
+		secretValue   config.YttSecretValue
+		expected      string
+		expectedError string
+	}{ // Test list
+
+		// Decoded data under binding path, stringData taking precedence
+		{
+			"Test secret values under path",
+			sampleSecret,
+			config.YttSecretValue{Name: "nrf-credentials", Path: "amf.nrf"},
+			"amf:\n  nrf:\n    token: nrf-token\n    user: amf-override\n",
+			"",
+		},
+
+		// Decoded data at data values root
+		{
+			"Test secret values at root",
+			sampleSecret,
+			config.YttSecretValue{Name: "nrf-credentials"},
+			"token: nrf-token\nuser: amf-override\n",
+			"",
+		},
+
+		// Data not base64 encoded
+		{
+			"Test fail on invalid base64 data",
+			"apiVersion: v1\nkind: Secret\nmetadata:\n  name: broken\ndata:\n  token: not-base64!\n",
+			config.YttSecretValue{Name: "broken"},
+			"",
+			"secret: broken, data key token is not base64 encoded",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseDir := t.TempDir()
+			fileName, err := writeSecretValues(kyaml.MustParse(tt.secret), tt.secretValue, baseDir)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			if err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			content, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatalf("failed to read data values file: %v", err)
+			}
+			assert.Equal(t, tt.expected, string(content))
+		})
+	}
+}
+
+func TestTakeAndWriteSecretFields(t *testing.T) {
+	// Move token into amf-secrets and reset after test
+	config.YttSecretFields = []config.YttSecretField{
+		{Path: "amf.nrfToken", Secret: "amf-secrets", Key: "nrf-token"},
+		{Path: "amf.missing", Secret: "unknown-secret"},
+	}
+	defer func() {
+		config.YttSecretFields = nil
+	}()
+
+	t.Run("Test move field to secret", func(t *testing.T) {
+		document := kyaml.MustParse("amf:\n  host: nrf.local\n  nrfToken: nrf-token-value\n")
+		secret := kyaml.MustParse("apiVersion: v1\nkind: Secret\nmetadata:\n  name: amf-secrets\n")
+		redactor, _ := logger.NewRedactor(nil)
+		results := logger.NewCollector()
+		results.Redactor = redactor
+
+		values, err := takeSecretFields(results, document, []*kyaml.RNode{secret})
+		if err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+
+		// Field removed from document, the Secret is only written afterwards
+		assert.Equal(t, "amf:\n  host: nrf.local\n", document.MustString())
+		assert.Empty(t, secret.GetDataMap())
+		if err := writeSecretFields(results, values); err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+
+		// Field written encoded to Secret
+		assert.Equal(t, "<redacted>", redactor.Redact("nrf-token-value"))
+		assert.Equal(t, "data.nrf-token", results.Results[0].Field.Path)
+	})
+
+	t.Run("Test fail on missing secret", func(t *testing.T) {
+		document := kyaml.MustParse("amf:\n  missing: value\n")
+		_, err := takeSecretFields(logger.NewCollector(), document, nil)
+		assert.EqualError(t, err, "secret: unknown-secret, selected for output field amf.missing but not found in package")
+	})
+}
+
+func TestParseAndWriteSecrets(t *testing.T) {
+	// Bind nrf-credentials and reset after test
+	config.YttSecretValues = []config.YttSecretValue{{Name: "nrf-credentials", Path: "nrf"}}
+	defer func() {
+		config.YttSecretValues = nil
+	}()
+
+	t.Run("Test bound secret as data values, unbound skipped", func(t *testing.T) {
+		unbound := kyaml.MustParse("apiVersion: v1\nkind: Secret\nmetadata:\n  name: amf-secrets\n")
+		fileArgs, baseDir, err := ParseAndWriteKYamlRNodesAsYttTemplates(logger.NewCollector(), kyaml.MustParse(sampleSecret), unbound)
+		defer os.RemoveAll(baseDir)
+		if err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+		assert.Equal(t, []string{"--data-values-file", baseDir + "/secret-values/nrf-credentials.yaml"}, fileArgs)
+	})
+
+	t.Run("Test fail on missing bound secret", func(t *testing.T) {
+		_, baseDir, err := ParseAndWriteKYamlRNodesAsYttTemplates(logger.NewCollector())
+		defer os.RemoveAll(baseDir)
+		assert.EqualError(t, err, "secret: nrf-credentials, bound in function config but not found in package")
+	})
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"strings"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Markers of sensitive fields in schemas
+const (
+	schemaSensitiveAnnotation = "#@schema/sensitive" // ytt schema annotation of a sensitive data value
+	openAPISensitiveKey       = "x-sensitive"        // OpenAPI extension of a sensitive property
+	openAPIPropertiesKey      = "properties"         // OpenAPI key holding properties of an object
+)
+
+// RegisterSensitiveFields registers sensitive keys and values of items with the Redactor of results
+//
+// Data of v1 Secrets is always sensitive. Other keys are sensitive when annotated with #@schema/sensitive in a ytt schema, marked x-sensitive: true
+// in an OpenAPI schema or matching the Redactor patterns. Values found under sensitive keys are then
+// masked wherever they appear, e.g. in ytt error messages.
+//
+// Parameters:
+//   - results: logger.Collector of the current run, nothing is registered without Redactor
+//   - items: package resources, including templates and data values
+func RegisterSensitiveFields(results *logger.Collector, items ...*kyaml.RNode) {
+	redactor := results.Redactor
+	if redactor == nil {
+		return
+	}
+
+	// Template content given as string is parsed to find annotated keys
+	var documents []*kyaml.Node
+	for _, item := range items {
+		documents = append(documents, item.YNode())
+		content := item.Field(config.YttNodeContent)
+		if content.IsNilOrEmpty() || content.Value.YNode().Kind != kyaml.ScalarNode {
+			continue
+		}
+		if parsed, err := kyaml.Parse(content.Value.YNode().Value); err == nil {
+			documents = append(documents, parsed.YNode())
+		}
+	}
+
+	// Keys first, so values of every sensitive key are found
+	for _, document := range documents {
+		registerSensitiveKeys(redactor, document)
+	}
+	for _, document := range documents {
+		registerSensitiveValues(redactor, document, false)
+	}
+
+	// Secret data is always sensitive, in encoded and decoded form
+	for _, secret := range FindSecrets(items) {
+		for _, value := range secret.GetDataMap() {
+			redactor.AddValue(value)
+		}
+		if data, err := decodeSecretData(secret); err == nil {
+			for _, value := range data {
+				redactor.AddValue(value)
+			}
+		}
+	}
+}
+
+// registerSensitiveKeys walks node for keys marked sensitive by ytt or OpenAPI schemas
+func registerSensitiveKeys(redactor *logger.Redactor, node *kyaml.Node) {
+	if node.Kind == kyaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if strings.Contains(key.HeadComment, schemaSensitiveAnnotation) || strings.Contains(key.LineComment, schemaSensitiveAnnotation) {
+				redactor.AddKey(key.Value)
+			}
+			if key.Value == openAPIPropertiesKey && value.Kind == kyaml.MappingNode {
+				for j := 0; j+1 < len(value.Content); j += 2 {
+					if isOpenAPISensitive(value.Content[j+1]) {
+						redactor.AddKey(value.Content[j].Value)
+					}
+				}
+			}
+		}
+	}
+	for _, child := range node.Content {
+		registerSensitiveKeys(redactor, child)
+	}
+}
+
+// isOpenAPISensitive checks if an OpenAPI property schema has x-sensitive: true
+func isOpenAPISensitive(property *kyaml.Node) bool {
+	if property.Kind != kyaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(property.Content); i += 2 {
+		if property.Content[i].Value == openAPISensitiveKey && property.Content[i+1].Value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// registerSensitiveValues walks node for scalar values below sensitive keys, skipping OpenAPI schemas
+func registerSensitiveValues(redactor *logger.Redactor, node *kyaml.Node, sensitive bool) {
+	switch node.Kind {
+	case kyaml.ScalarNode:
+		if sensitive {
+			redactor.AddValue(node.Value)
+		}
+	case kyaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == openAPIPropertiesKey && node.Content[i+1].Kind == kyaml.MappingNode {
+				continue
+			}
+			registerSensitiveValues(redactor, node.Content[i+1], sensitive || redactor.IsSensitiveKey(node.Content[i].Value))
+		}
+	default:
+		for _, child := range node.Content {
+			registerSensitiveValues(redactor, child, sensitive)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestRegisterSensitiveFields(t *testing.T) {
+	// Schema with annotated key as map and as string content
+	schemaMap := kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: schema
+ytt_header:
+  header:
+  #@data/values-schema
+ytt_template_content:
+  nrf:
+    #@schema/sensitive
+    nrfToken: ""
+    host: ""
+`)
+	schemaString := kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttTemplate
+metadata:
+  name: schema-string
+ytt_template_content: |
+  #@data/values-schema
+  ---
+  #@schema/sensitive
+  tlsKey: ""
+`)
+
+	// OpenAPI schema with x-sensitive property
+	openAPI := kyaml.MustParse(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: amfs.example.com
+spec:
+  versions:
+  - schema:
+      openAPIV3Schema:
+        properties:
+          smfPassphrase:
+            type: string
+            x-sensitive: true
+`)
+
+	// Data values of the sensitive keys and a pattern key
+	values := kyaml.MustParse(`
+apiVersion: v1alpha1
+kind: YttDataValues
+metadata:
+  name: values
+nrf:
+  nrfToken: nrf-token-value
+  host: nrf.local
+tlsKey: tls-key-value
+smfPassphrase: smf-passphrase-value
+db:
+  password: db-password-value
+`)
+
+	// Register with a collector masking password keys
+	redactor, err := logger.NewRedactor([]string{"password"})
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	results := logger.NewCollector()
+	results.Redactor = redactor
+	RegisterSensitiveFields(results, schemaMap, schemaString, openAPI, values)
+
+	// Schema keys are sensitive
+	assert.True(t, redactor.IsSensitiveKey("nrfToken"))
+	assert.True(t, redactor.IsSensitiveKey("tlsKey"))
+	assert.True(t, redactor.IsSensitiveKey("smfPassphrase"))
+	assert.False(t, redactor.IsSensitiveKey("host"))
+
+	// Values of sensitive keys are masked anywhere, OpenAPI schema content is not
+	assert.Equal(
+		t,
+		"<redacted> <redacted> <redacted> <redacted> nrf.local string",
+		redactor.Redact("nrf-token-value tls-key-value smf-passphrase-value db-password-value nrf.local string"),
+	)
+}
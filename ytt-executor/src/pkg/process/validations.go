@@ -0,0 +1,74 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/expression"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// validateYttOutput checks a ytt output document against config.YttValidations of the output resource it is written to
+// Every failing rule is reported with a reference to the output resource, rules failing to evaluate count as failed
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - document: parsed ytt output document, before secret fields are moved out
+//   - index: position of the document in ytt output
+//   - item: output resource the document is written to
+//
+// Returns:
+//   - error: when any rule fails
+func validateYttOutput(results *logger.Collector, document *kyaml.RNode, index int, item *kyaml.RNode) error {
+	if len(config.YttValidations) == 0 {
+		return nil
+	}
+	self, err := expression.ToValue(document)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, validation := range config.YttValidations {
+		if validation.Output != "" && validation.Output != item.GetName() {
+			continue
+		}
+		valid, err := validation.Program.Eval(map[string]any{"self": self})
+		if valid {
+			continue
+		}
+		failed++
+		message := validation.Message
+		if message == "" {
+			message = fmt.Sprintf("Validation failed: %s", validation.Expression)
+		}
+		detailed := map[string]string{
+			"expression":     validation.Expression,
+			"document_index": strconv.Itoa(index),
+		}
+		if err != nil {
+			detailed["error"] = err.Error()
+		}
+		results.LogReferencedError(message, logger.Reference{Item: item, Field: config.YttOutputElementKey}, detailed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("ytt output document %d for %s failed %d of its validations", index, item.GetName(), failed)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestUnmarshalYttOutputValidations(t *testing.T) {
+	defer config.Reset()
+	yttOutput := "amf: {memory: 512}\n---\nsmf: {memory: 2048}\n"
+
+	// Test structure
+	tests := []struct {
+		name             string
+		validations      string
+		expectedErr      string
+		expectedMessages []string
+		expectedDetails  map[string]string
+	}{ // Test list
+
+		// Rules holding for every document
+		{
+			"Test passing validations",
+			`
+- expression: "self.all(nf, self[nf].memory <= 2048)"
+- expression: self.amf.memory <= 1024
+  output: amf-values
+`,
+			"",
+			nil,
+			nil,
+		},
+
+		// Failing rules are reported against the output resource, no document is written
+		{
+			"Test failing validation",
+			`
+- expression: "self.all(nf, self[nf].memory <= 1024)"
+  message: NF memory must not exceed 1Gi
+`,
+			"ytt output document 1 for smf-values failed 1 of its validations",
+			[]string{"NF memory must not exceed 1Gi"},
+			map[string]string{"expression": "self.all(nf, self[nf].memory <= 1024)", "document_index": "1"},
+		},
+
+		// Rules failing to evaluate fail, with the expression as default message
+		{
+			"Test failing evaluation",
+			`
+- expression: self.amf.memory <= 1024
+`,
+			"ytt output document 1 for smf-values failed 1 of its validations",
+			[]string{"Validation failed: self.amf.memory <= 1024"},
+			map[string]string{
+				"expression":     "self.amf.memory <= 1024",
+				"document_index": "1",
+				"error":          "expression self.amf.memory <= 1024 failed: no such key: amf",
+			},
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Reset()
+			fnConfig := kyaml.NewMapRNode(nil)
+			if err := fnConfig.PipeE(kyaml.SetField("validations", kyaml.MustParse(tt.validations))); err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			if err := config.Configure(logger.NewCollector(), fnConfig); err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			outputs := []*kyaml.RNode{
+				kyaml.MustParse("apiVersion: v1\nkind: Configuration\nmetadata:\n  name: amf-values\ndata: {}\n"),
+				kyaml.MustParse("apiVersion: v1\nkind: Configuration\nmetadata:\n  name: smf-values\ndata: {}\n"),
+			}
+			results := logger.NewCollector()
+
+			// Execute function
+			err := UnmarshalYttOutput(results, strings.NewReader(yttOutput), outputs, OutputOptions{})
+
+			// Assert response
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, "{memory: 2048}", outputs[1].Field("data").Value.Field("smf").Value.MustString()[:14])
+				return
+			}
+			assert.EqualError(t, err, tt.expectedErr)
+			var gotMessages []string
+			for _, result := range results.Results {
+				if result.Severity == framework.Severity(logger.LogLevelStrings[logger.LogLevelError]) {
+					gotMessages = append(gotMessages, result.Message)
+					assert.Equal(t, "smf-values", result.ResourceRef.Name)
+					assert.Equal(t, tt.expectedDetails, result.Tags)
+				}
+			}
+			assert.Equal(t, tt.expectedMessages, gotMessages)
+
+			// The valid first document is not written either
+			assert.Equal(t, "{}", outputs[0].Field("data").Value.MustString()[:2])
+			assert.Equal(t, "{}", outputs[1].Field("data").Value.MustString()[:2])
+		})
+	}
+}
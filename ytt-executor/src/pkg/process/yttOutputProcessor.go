@@ -15,64 +15,104 @@
 package process
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
 
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
 	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
-// UnmarshalYttOutput Parses ytt output into kyaml.RNode and writes it to provided items list under
-// config.YttOutputElementKey
+// OutputOptions destinations and checks of ytt output documents besides output items
+//
+// Secrets: v1 Secrets receiving output fields listed in config.YttSecretFields
+//
+// Schemas: schemas output documents that are resources are validated against, nil to skip schema validation
+type OutputOptions struct {
+	Secrets []*kyaml.RNode
+	Schemas OutputSchemas
+}
+
+// yttOutputDocument a decoded and validated ytt output document, ready to be written
+//
+// item: output RNode receiving value
+//
+// value: document as written under config.YttOutputElementKey, serialized when requested
+//
+// secretFields: fields taken out of the document for their Secrets
+type yttOutputDocument struct {
+	item         *kyaml.RNode
+	value        *kyaml.RNode
+	secretFields []secretFieldValue
+}
+
+// UnmarshalYttOutput Parses ytt output document by document into kyaml.RNode as it is read and writes
+// each document to provided items list under config.YttOutputElementKey
+// Every document is decoded, validated and serialized before the first one is written, so a failing
+// document leaves all outputs and Secrets untouched
 //
 // Parameters:
-//   - yttOutput: bytes.Buffer containing ytt binary output
+//   - results: logger.Collector of the current run
+//   - yttOutput: stream of ytt binary output, read until io.EOF
 //   - items: list of output RNodes to write ytt output to
+//   - options: OutputOptions of the current run
 //
 // Returns:
 //   - error: from parsing ytt output OR insufficient output RNodes available
-func UnmarshalYttOutput(yttOutput bytes.Buffer, items []*kyaml.RNode) error {
-	// Debug raw ytt output
-	logger.LogDetailedDebug("Processing ytt binary output", map[string]string{
-		"rawOutput": yttOutput.String(),
-	})
-
-	// Split bytes.buffer on "---"
-	splitBuffer := bytes.Split(yttOutput.Bytes(), []byte("---"))
-
+func UnmarshalYttOutput(results *logger.Collector, yttOutput io.Reader, items []*kyaml.RNode, options OutputOptions) error {
 	if len(items) <= 0 {
+		if config.YttOutputSelector != nil {
+			return errors.New("no output file matching output selector provided")
+		}
 		return fmt.Errorf("no output file with kind: %s provided", config.YttOutputFileKind)
 	}
 
-	// Check counts of files / ytt output provided / available
-	if len(splitBuffer) > len(items) {
-		// Generate error if not enough output items made available
-		logger.LogDetailedError("Ytt output required more files than available", map[string]string{
-			"ytt_output_count":    strconv.Itoa(len(splitBuffer)),
-			"provided_file_count": strconv.Itoa(len(items)),
-		})
+	// Decode and check each document as ytt emits it
+	var documents []yttOutputDocument
+	decoder := kyaml.NewDecoder(yttOutput)
+	i := 0
+	for ; ; i++ {
+		document := &kyaml.Node{}
+		err := decoder.Decode(document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			reference := logger.Reference{}
+			if i < len(items) {
+				reference.Item = items[i]
+			}
+			results.LogReferencedError("Failed to parse ytt output item", reference, map[string]string{
+				"item_index": strconv.Itoa(i),
+			})
+			return err
+		}
 
-		return errors.New("ytt output contained more files than available")
+		// Skip empty documents, e.g. after a trailing "---", an empty map or list is still a document
+		if isEmptyDocument(document) {
+			i--
+			continue
+		}
+		dataPart := kyaml.NewRNode(document)
 
-		// Generate warning if too many output items made available
-	} else if len(splitBuffer) < len(items) {
-		logger.LogDetailedWarning("Ytt output had more files provided than needed", map[string]string{
-			"ytt_output_count":    strconv.Itoa(len(splitBuffer)),
-			"provided_file_count": strconv.Itoa(len(items)),
-		})
-	}
+		// Generate error if not enough output items made available
+		if i >= len(items) {
+			results.LogDetailedError("Ytt output required more files than available", map[string]string{
+				"ytt_output_count":    fmt.Sprintf("more than %d", len(items)),
+				"provided_file_count": strconv.Itoa(len(items)),
+			})
+			return errors.New("ytt output contained more files than available")
+		}
 
-	// Unmarshal and assemble each item into []kyaml.RNode
-	for i, yttBytePart := range splitBuffer {
 		if items[i].Field(config.YttOutputElementKey) == nil {
-			logger.LogError(fmt.Sprintf(
+			results.LogReferencedError(fmt.Sprintf(
 				"Output file: %s, did not contain required output key: %s",
 				items[i].GetAnnotations()["config.kubernetes.io/path"],
 				config.YttOutputElementKey,
-			))
+			), logger.Reference{Item: items[i], Field: config.YttOutputElementKey}, nil)
 			return fmt.Errorf(
 				"output file: %s, did not contain required output key: %s",
 				items[i].GetAnnotations()["config.kubernetes.io/path"],
@@ -80,37 +120,158 @@ func UnmarshalYttOutput(yttOutput bytes.Buffer, items []*kyaml.RNode) error {
 			)
 		}
 
-		// Parse byteBuffer to kyaml.RNode
-		dataPart, err := kyaml.Parse(string(yttBytePart))
+		// Debug raw ytt output document
+		results.LogDetailedDebug("Processing ytt binary output", map[string]string{
+			"item_index": strconv.Itoa(i),
+			"rawOutput":  dataPart.MustString(),
+		})
+
+		// Deeply nested documents point to runaway recursive templates
+		if config.YttMaxDepth > 0 && documentDepth(dataPart.YNode()) > config.YttMaxDepth {
+			err := fmt.Errorf("ytt output document %d exceeds limit max_depth: %d", i, config.YttMaxDepth)
+			results.LogReferencedError(err.Error(), logger.Reference{Item: items[i]}, nil)
+			return err
+		}
+
+		// Check rules of the document
+		if err := validateYttOutput(results, dataPart, i, items[i]); err != nil {
+			return err
+		}
+		if err := validateOutputSchema(results, options.Schemas, dataPart, i, items[i]); err != nil {
+			return err
+		}
+
+		// Take secret fields out of the document and serialize what remains
+		secretFields, err := takeSecretFields(results, dataPart, options.Secrets)
 		if err != nil {
-			logger.LogDetailedError("Failed to parse ytt output item", map[string]string{
-				"item_index":  strconv.Itoa(i),
-				"output_dump": string(yttBytePart),
-				"full_output": yttOutput.String(),
-			})
+			results.LogReferencedError(err.Error(), logger.Reference{Item: items[i]}, nil)
+			return err
+		}
+		value, err := yttOutputValue(dataPart)
+		if err != nil {
+			results.LogReferencedError(err.Error(), logger.Reference{Item: items[i], Field: config.YttOutputElementKey}, nil)
+			return err
+		}
+		documents = append(documents, yttOutputDocument{item: items[i], value: value, secretFields: secretFields})
+	}
+
+	// Write documents only once all of them are valid
+	for _, document := range documents {
+		if err := writeSecretFields(results, document.secretFields); err != nil {
+			results.LogReferencedError(err.Error(), logger.Reference{Item: document.item}, nil)
 			return err
 		}
 
 		// Generate info message depending on action (write / overwrite)
-		if items[i].Field(config.YttOutputElementKey).Value.IsNilOrEmpty() {
-			logger.LogInfo(fmt.Sprintf(
+		if document.item.Field(config.YttOutputElementKey).Value.IsNilOrEmpty() {
+			results.LogReferencedInfo(fmt.Sprintf(
 				"Overwriting file: %s, %s key",
-				items[i].GetAnnotations()["config.kubernetes.io/path"],
+				document.item.GetAnnotations()["config.kubernetes.io/path"],
 				config.YttOutputElementKey,
-			))
+			), logger.Reference{Item: document.item, Field: config.YttOutputElementKey}, nil)
 		} else {
-			logger.LogInfo(fmt.Sprintf(
+			results.LogReferencedInfo(fmt.Sprintf(
 				"Writing to file: %s, %s key",
-				items[i].GetAnnotations()["config.kubernetes.io/path"],
+				document.item.GetAnnotations()["config.kubernetes.io/path"],
 				config.YttOutputElementKey,
-			))
+			), logger.Reference{Item: document.item, Field: config.YttOutputElementKey}, nil)
 		}
 
 		// Set field in output items
-		err = items[i].PipeE(kyaml.SetField(config.YttOutputElementKey, dataPart))
-		if err != nil {
+		if err := setYttOutputField(document.item, document.value); err != nil {
+			results.LogReferencedError(err.Error(), logger.Reference{Item: document.item, Field: config.YttOutputElementKey}, nil)
 			return err
 		}
 	}
+
+	// Generate warning if too many output items made available
+	if i < len(items) {
+		results.LogDetailedWarning("Ytt output had more files provided than needed", map[string]string{
+			"ytt_output_count":    strconv.Itoa(i),
+			"provided_file_count": strconv.Itoa(len(items)),
+		})
+	}
 	return nil
 }
+
+// isEmptyDocument checks whether a decoded ytt output document holds nothing, i.e. no node or a null scalar
+func isEmptyDocument(document *kyaml.Node) bool {
+	node := document
+	if node.Kind == kyaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return true
+		}
+		node = node.Content[0]
+	}
+	return node.Kind == 0 || (node.Kind == kyaml.ScalarNode && node.Tag == kyaml.NodeTagNull)
+}
+
+// documentDepth returns the number of nested maps and lists of node
+func documentDepth(node *kyaml.Node) int {
+	if node == nil {
+		return 0
+	}
+	childDepth := 0
+	for _, child := range node.Content {
+		childDepth = max(childDepth, documentDepth(child))
+	}
+	if node.Kind == kyaml.MappingNode || node.Kind == kyaml.SequenceNode {
+		return childDepth + 1
+	}
+	return childDepth
+}
+
+// yttOutputValue returns a parsed ytt output document as written to output items, either as yaml or
+// serialized with config.YttOutputFormat
+//
+// Parameters:
+//   - dataPart: parsed ytt output document
+//
+// Returns:
+//   - *kyaml.RNode: dataPart itself, or a string node holding it serialized
+//   - error: from serializing the document
+func yttOutputValue(dataPart *kyaml.RNode) (*kyaml.RNode, error) {
+	// Keep yaml structure when no serialization was requested
+	if config.YttOutputDataKey == "" && config.YttOutputFormat == config.OutputFormatYaml {
+		return dataPart, nil
+	}
+
+	// Serialize document to string
+	serialized, err := encodeYttOutput(dataPart, config.YttOutputFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize ytt output as %s: %v", config.YttOutputFormat, err)
+	}
+	stringNode := kyaml.NewStringRNode(serialized)
+	if strings.Contains(serialized, "\n") {
+		stringNode.YNode().Style = kyaml.LiteralStyle
+	}
+	return stringNode, nil
+}
+
+// setYttOutputField writes a ytt output document prepared by yttOutputValue to item under config.YttOutputElementKey,
+// or under config.YttOutputDataKey of it when set
+//
+// Parameters:
+//   - item: output RNode to write ytt output to
+//   - value: ytt output document as returned by yttOutputValue
+//
+// Returns:
+//   - error: from setting the field
+func setYttOutputField(item *kyaml.RNode, value *kyaml.RNode) error {
+	// Write document directly under output element key
+	if config.YttOutputDataKey == "" {
+		return item.PipeE(kyaml.SetField(config.YttOutputElementKey, value))
+	}
+
+	// Replace empty output element with a map before writing data key
+	if item.Field(config.YttOutputElementKey).Value.IsNilOrEmpty() {
+		err := item.PipeE(kyaml.SetField(config.YttOutputElementKey, kyaml.NewMapRNode(nil)))
+		if err != nil {
+			return err
+		}
+	}
+	return item.PipeE(
+		kyaml.Lookup(config.YttOutputElementKey),
+		kyaml.SetField(config.YttOutputDataKey, value),
+	)
+}
@@ -17,8 +17,11 @@ package process
 import (
 	"bytes"
 	"errors"
+	"io"
+	"strings"
 	"testing"
 
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
 	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
 	"github.com/stretchr/testify/assert"
 	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
@@ -66,7 +69,8 @@ data:
 		sampleOutput.WriteString("yttOutputKey: yttOutputElement\n")
 
 		// Execute function
-		err := UnmarshalYttOutput(sampleOutput, outputCopy)
+		results := logger.NewCollector()
+		err := UnmarshalYttOutput(results, &sampleOutput, outputCopy, OutputOptions{})
 		if err != nil {
 			t.Fatalf("error not expected: %v", err)
 		}
@@ -76,7 +80,7 @@ data:
 		if err != nil {
 			t.Fatalf("error not expected: %v", err)
 		}
-		assert.Equal(t, sampleOutput.String(), data.MustString())
+		assert.Equal(t, "yttOutputKey: yttOutputElement\n", data.MustString())
 
 		// Check second item to be empty / nil
 		data, _ = outputCopy[1].Pipe(kyaml.Get("data"))
@@ -84,9 +88,8 @@ data:
 			t.Fatal("data item should not exist in secondary output.")
 		}
 
-		// Check for generated warning
-		log := logger.LogStack[len(logger.LogStack)-2]
-		assert.Equal(t, "Ytt output had more files provided than needed", log.Message)
+		// Check for generated warning after all documents were read
+		assert.Equal(t, "Ytt output had more files provided than needed", results.Results[len(results.Results)-1].Message)
 	})
 
 	// Happy test when ytt output matches file count
@@ -104,7 +107,8 @@ yttOutputKey2: yttOutputElement2
 `)
 
 		// Execute function
-		err := UnmarshalYttOutput(sampleOutput, outputCopy)
+		results := logger.NewCollector()
+		err := UnmarshalYttOutput(results, &sampleOutput, outputCopy, OutputOptions{})
 		if err != nil {
 			t.Fatalf("error not expected: %v", err)
 		}
@@ -123,17 +127,63 @@ yttOutputKey2: yttOutputElement2
 		}
 		assert.Equal(t, "yttOutputKey2: yttOutputElement2\n", data.MustString())
 
-		// Check final 2 info messages to have correct feedback
-		assert.Equal(
-			t,
-			"Overwriting file: , data key",
-			logger.LogStack[len(logger.LogStack)-1].Message,
-		)
-		assert.Equal(
-			t,
-			"Writing to file: , data key",
-			logger.LogStack[len(logger.LogStack)-2].Message,
+		// Check both info messages to have correct feedback
+		assert.Equal(t, 2, len(results.Results))
+		assert.Equal(t, "Writing to file: , data key", results.Results[0].Message)
+		assert.Equal(t, "Overwriting file: , data key", results.Results[1].Message)
+
+		// Check info messages reference output resources and key
+		assert.Equal(t, "output-2", results.Results[1].ResourceRef.Name)
+		assert.Equal(t, "OutputKind", results.Results[1].ResourceRef.Kind)
+		assert.Equal(t, "data", results.Results[1].Field.Path)
+	})
+
+	// Documents are written as they are decoded, empty documents are skipped
+	t.Run("Streamed output with empty documents", func(t *testing.T) {
+		// Copy output list
+		outputCopy := make([]*kyaml.RNode, len(outputList))
+		copy(outputCopy, outputList)
+
+		// Create sample output stream split inside the second document
+		sampleOutput := io.MultiReader(
+			strings.NewReader("---\nyttOutputKey1: yttOutputElement1\n---\nyttOutput"),
+			strings.NewReader("Key2: yttOutputElement2\n---\n"),
 		)
+
+		// Execute function
+		results := logger.NewCollector()
+		err := UnmarshalYttOutput(results, sampleOutput, outputCopy, OutputOptions{})
+		if err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+
+		// Check both items without warning
+		assert.Equal(t, "yttOutputKey1: yttOutputElement1\n", outputCopy[0].Field("data").Value.MustString())
+		assert.Equal(t, "yttOutputKey2: yttOutputElement2\n", outputCopy[1].Field("data").Value.MustString())
+		assert.Equal(t, 2, len(results.Results))
+	})
+
+	// Empty maps are documents of their own, only null documents are skipped
+	t.Run("Empty map document in output", func(t *testing.T) {
+		// Create three output items
+		var testList []*kyaml.RNode
+		for _, name := range []string{"output-a", "output-b", "output-c"} {
+			testList = append(testList, kyaml.MustParse("apiVersion: v1alpha1\nkind: OutputKind\nmetadata:\n  name: "+name+"\ndata:\n"))
+		}
+
+		// Create sample output with an empty map in the middle
+		sampleOutput := strings.NewReader("a: 1\n---\n{}\n---\nb: 2\n---\n")
+
+		// Execute function
+		err := UnmarshalYttOutput(logger.NewCollector(), sampleOutput, testList, OutputOptions{})
+		if err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+
+		// Check every document went to its own output
+		assert.Equal(t, "a: 1\n", testList[0].Field("data").Value.MustString())
+		assert.Equal(t, "{}\n", testList[1].Field("data").Value.MustString())
+		assert.Equal(t, "b: 2\n", testList[2].Field("data").Value.MustString())
 	})
 
 	// Test when ytt output yields more output than files provided
@@ -153,7 +203,7 @@ yttOutputKey3: yttOutputElement3
 `)
 
 		// Execute function
-		err := UnmarshalYttOutput(sampleOutput, outputCopy)
+		err := UnmarshalYttOutput(logger.NewCollector(), &sampleOutput, outputCopy, OutputOptions{})
 
 		// Check error
 		assert.Equal(
@@ -163,6 +213,31 @@ yttOutputKey3: yttOutputElement3
 		)
 	})
 
+	// Fail when a document is nested deeper than allowed
+	t.Run("Output exceeding max_depth", func(t *testing.T) {
+		// Copy output list
+		outputCopy := make([]*kyaml.RNode, len(outputList))
+		copy(outputCopy, outputList)
+
+		// Set depth limit and reset after test
+		config.YttMaxDepth = 2
+		defer func() {
+			config.YttMaxDepth = 100
+		}()
+
+		// Create sample output bytes.Buffer
+		sampleOutput := bytes.Buffer{}
+		sampleOutput.WriteString("level1:\n  level2:\n  - level3: deep\n")
+
+		// Execute function
+		results := logger.NewCollector()
+		err := UnmarshalYttOutput(results, &sampleOutput, outputCopy, OutputOptions{})
+
+		// Check error and result
+		assert.EqualError(t, err, "ytt output document 0 exceeds limit max_depth: 2")
+		assert.Equal(t, err.Error(), results.Results[len(results.Results)-1].Message)
+	})
+
 	// Fail when trying to parse ytt output into yaml format (This is imporbable to occur with successful ytt output)
 	t.Run("Invalid yaml yttOutput", func(t *testing.T) {
 		// Copy output list
@@ -174,7 +249,7 @@ yttOutputKey3: yttOutputElement3
 		sampleOutput.WriteString("invalid: yaml: item")
 
 		// Execute function
-		err := UnmarshalYttOutput(sampleOutput, outputCopy)
+		err := UnmarshalYttOutput(logger.NewCollector(), &sampleOutput, outputCopy, OutputOptions{})
 
 		// Check error
 		assert.Equal(
@@ -184,6 +259,42 @@ yttOutputKey3: yttOutputElement3
 		)
 	})
 
+	// Serialize ytt output to a string under data key of an empty output element
+	t.Run("Serialized output under data key", func(t *testing.T) {
+		// Set serialization config and reset after test
+		config.YttOutputDataKey = "amfcfg.json"
+		config.YttOutputFormat = config.OutputFormatJson
+		defer func() {
+			config.YttOutputDataKey = ""
+			config.YttOutputFormat = config.OutputFormatYaml
+		}()
+
+		testList := []*kyaml.RNode{kyaml.MustParse(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: amf-config
+data:
+`)}
+
+		// Create sample output bytes.Buffer
+		sampleOutput := bytes.Buffer{}
+		sampleOutput.WriteString("yttOutputKey: yttOutputElement\n")
+
+		// Execute function
+		err := UnmarshalYttOutput(logger.NewCollector(), &sampleOutput, testList, OutputOptions{})
+		if err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+
+		// Check serialized data key
+		assert.Equal(
+			t,
+			"{\n  \"yttOutputKey\": \"yttOutputElement\"\n}\n",
+			testList[0].GetDataMap()["amfcfg.json"],
+		)
+	})
+
 	// Test fail when no key is present in the output file
 	t.Run("Fail on no output element", func(t *testing.T) {
 		// Copy output list
@@ -200,7 +311,7 @@ some: unrelated_data
 		sampleOutput.WriteString("yttOutputKey: yttOutputElement\n")
 
 		// Execute function
-		err := UnmarshalYttOutput(sampleOutput, testList)
+		err := UnmarshalYttOutput(logger.NewCollector(), &sampleOutput, testList, OutputOptions{})
 
 		// Check error
 		assert.Equal(
@@ -209,4 +320,31 @@ some: unrelated_data
 			err,
 		)
 	})
+	// Test a document failing late leaves earlier outputs and Secrets untouched
+	t.Run("Fail before writing any document", func(t *testing.T) {
+		// Set toml serialization with a secret field and reset after test
+		config.YttOutputFormat = config.OutputFormatToml
+		config.YttSecretFields = []config.YttSecretField{{Path: "amf.nrfToken", Secret: "amf-secrets"}}
+		defer func() {
+			config.YttOutputFormat = config.OutputFormatYaml
+			config.YttSecretFields = nil
+		}()
+
+		testList := []*kyaml.RNode{
+			kyaml.MustParse("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: amf-config\ndata: {}\n"),
+			kyaml.MustParse("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: smf-config\ndata: {}\n"),
+		}
+		secret := kyaml.MustParse("apiVersion: v1\nkind: Secret\nmetadata:\n  name: amf-secrets\n")
+
+		// The second document is a list, which toml cannot serialize
+		sampleOutput := strings.NewReader("amf: {nrfToken: token}\n---\n- smf\n")
+
+		// Execute function
+		err := UnmarshalYttOutput(logger.NewCollector(), sampleOutput, testList, OutputOptions{Secrets: []*kyaml.RNode{secret}})
+
+		// Check nothing was written
+		assert.EqualError(t, err, "failed to serialize ytt output as toml: toml output requires a map document, got: !!seq")
+		assert.Equal(t, "{}", testList[0].Field("data").Value.MustString()[:2])
+		assert.Empty(t, secret.GetDataMap())
+	})
 }
@@ -0,0 +1,308 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package renderTest runs test cases declared in YttRenderTest resources of a package in memory,
+// asserting fields of rendered outputs
+package renderTest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/expression"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/pipeline"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/process"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Spec spec of a YttRenderTest resource
+//
+// FunctionConfig: name of the function config resource in the package rendering the test cases
+//
+// Cases: test cases rendered one after another
+type Spec struct {
+	FunctionConfig string `yaml:"function_config"`
+	Cases          []Case `yaml:"cases"`
+}
+
+// Case a single render of the package with inputs applied
+//
+// Name: name of the test case, reported with its results
+//
+// Inputs: resources replacing package resources of the same apiVersion, kind, namespace and name,
+// or added to the package, e.g. a CIQ
+//
+// Assertions: checks of rendered outputs, all must hold
+//
+// Error: part of the error the render is expected to fail with, assertions are skipped then
+type Case struct {
+	Name       string       `yaml:"name"`
+	Inputs     []kyaml.Node `yaml:"inputs,omitempty"`
+	Assertions []Assertion  `yaml:"assertions,omitempty"`
+	Error      string       `yaml:"error,omitempty"`
+}
+
+// Assertion a check of rendered outputs
+//
+// Output: name of the output resource to check, every output when empty
+//
+// Path: JSONPath of a field that must exist, e.g. $.data['values.yaml'].amf.replicas
+//
+// Value: value the field at Path must equal
+//
+// CEL: CEL expression that must be true, the output resource is self
+//
+// Message: reported instead of the default message when the assertion fails
+type Assertion struct {
+	Output  string     `yaml:"output,omitempty"`
+	Path    string     `yaml:"path,omitempty"`
+	Value   kyaml.Node `yaml:"value,omitempty"`
+	CEL     string     `yaml:"cel,omitempty"`
+	Message string     `yaml:"message,omitempty"`
+}
+
+// Run runs test cases of all render tests in items, reporting every passing case as info
+// and every failing assertion as error with a reference to its render test
+// Each case renders copies of items with processor, so the package is left untouched
+//
+// Parameters:
+//   - results: logger.Collector of the current run
+//   - processor: processor rendering a single test case, configured by the function config of its render test
+//   - items: package resources
+//
+// Returns:
+//   - error: when any case fails or a render test is invalid
+func Run(results *logger.Collector, processor framework.ResourceListProcessor, items []*kyaml.RNode) error {
+	var tests, packageItems []*kyaml.RNode
+	for _, item := range items {
+		if item.GetKind() == config.YttRenderTestKind {
+			tests = append(tests, item)
+		} else {
+			packageItems = append(packageItems, item)
+		}
+	}
+	if len(tests) == 0 {
+		results.LogWarning(fmt.Sprintf("No %s resources found, no render tests run", config.YttRenderTestKind))
+		return nil
+	}
+
+	// Cases configure the processor themselves, config of this run is restored afterwards
+	defer config.Reset()
+	total, failed := 0, 0
+	for _, test := range tests {
+		spec, fnConfig, err := readTest(test, packageItems)
+		if err != nil {
+			results.LogReferencedError(err.Error(), logger.Reference{Item: test}, nil)
+			total++
+			failed++
+			continue
+		}
+		for _, testCase := range spec.Cases {
+			total++
+			failures := runCase(processor, test, fnConfig, testCase, packageItems)
+			tags := map[string]string{"test": test.GetName(), "case": testCase.Name}
+			if len(failures) == 0 {
+				results.LogReferencedInfo(fmt.Sprintf("Render test case passed: %s", testCase.Name), logger.Reference{Item: test}, tags)
+				continue
+			}
+			failed++
+			for _, failure := range failures {
+				results.LogReferencedError(fmt.Sprintf("Render test case %s failed: %s", testCase.Name, failure), logger.Reference{Item: test}, tags)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d render test cases failed", failed, total)
+	}
+	return nil
+}
+
+// readTest decodes the spec of test and finds the function config it names among items
+func readTest(test *kyaml.RNode, items []*kyaml.RNode) (Spec, *kyaml.RNode, error) {
+	var spec Spec
+	specNode := test.Field("spec")
+	if specNode.IsNilOrEmpty() {
+		return spec, nil, fmt.Errorf("render test %s has no spec", test.GetName())
+	}
+	if err := specNode.Value.YNode().Decode(&spec); err != nil {
+		return spec, nil, fmt.Errorf("render test %s is invalid: %v", test.GetName(), err)
+	}
+	if spec.FunctionConfig == "" {
+		return spec, nil, fmt.Errorf("render test %s has no function_config", test.GetName())
+	}
+	for i, testCase := range spec.Cases {
+		if testCase.Name == "" {
+			return spec, nil, fmt.Errorf("render test %s has a case without name at index %d", test.GetName(), i)
+		}
+	}
+
+	var fnConfig *kyaml.RNode
+	for _, item := range items {
+		if item.GetName() == spec.FunctionConfig && item.GetKind() != config.KptfileKind {
+			fnConfig = item
+		}
+	}
+	if fnConfig == nil {
+		return spec, nil, fmt.Errorf("render test %s references missing function config: %s", test.GetName(), spec.FunctionConfig)
+	}
+
+	// A function config running tests would run them again for every case
+	config.Reset()
+	if err := config.Configure(logger.NewCollector(), fnConfig.Copy()); err != nil {
+		return spec, nil, fmt.Errorf("render test %s references invalid function config %s: %v", test.GetName(), spec.FunctionConfig, err)
+	}
+	if config.YttMode == config.ModeTest {
+		return spec, nil, fmt.Errorf("render test %s references function config %s, which runs tests instead of rendering", test.GetName(), spec.FunctionConfig)
+	}
+	return spec, fnConfig, nil
+}
+
+// runCase renders testCase and checks its assertions
+//
+// Returns:
+//   - []string: failure messages, none when the case passed
+func runCase(processor framework.ResourceListProcessor, test *kyaml.RNode, fnConfig *kyaml.RNode, testCase Case, items []*kyaml.RNode) []string {
+	inputs := make([]*kyaml.RNode, 0, len(testCase.Inputs))
+	for i := range testCase.Inputs {
+		inputs = append(inputs, kyaml.NewRNode(&testCase.Inputs[i]))
+	}
+	caseItems, err := pipeline.OverrideItems(items, inputs, pipeline.ItemPath(test))
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	// Render with defaults and the function config only, as a render job would
+	config.Reset()
+	resourceList := &framework.ResourceList{Items: caseItems, FunctionConfig: fnConfig.Copy()}
+	renderErr := processor.Process(resourceList)
+	switch {
+	case testCase.Error != "" && renderErr == nil:
+		return []string{fmt.Sprintf("expected render to fail with: %s", testCase.Error)}
+	case testCase.Error != "" && !strings.Contains(renderErr.Error(), testCase.Error):
+		return []string{fmt.Sprintf("expected render to fail with: %s, got: %v", testCase.Error, renderErr)}
+	case testCase.Error != "":
+		return nil
+	case renderErr != nil:
+		return []string{fmt.Sprintf("render failed: %v", renderErr)}
+	}
+
+	// Outputs are identified by the config the case was rendered with
+	var outputs []*kyaml.RNode
+	for _, item := range resourceList.Items {
+		if process.IsOutputItem(item) {
+			outputs = append(outputs, item)
+		}
+	}
+	var failures []string
+	for i, assertion := range testCase.Assertions {
+		failures = append(failures, checkAssertion(assertion, i, outputs)...)
+	}
+	return failures
+}
+
+// hasValue checks whether a value is given, null included
+func (assertion Assertion) hasValue() bool {
+	return assertion.Value.Kind != 0
+}
+
+// checkAssertion checks assertion against every output it names
+//
+// Parameters:
+//   - assertion: assertion to check
+//   - index: position of the assertion in its case, for messages
+//   - outputs: rendered output resources
+//
+// Returns:
+//   - []string: failure messages, none when the assertion holds
+func checkAssertion(assertion Assertion, index int, outputs []*kyaml.RNode) []string {
+	if assertion.hasValue() && assertion.Path == "" {
+		return []string{fmt.Sprintf("assertion %d has a value without path", index)}
+	}
+	if assertion.Path == "" && assertion.CEL == "" {
+		return []string{fmt.Sprintf("assertion %d has neither path nor cel", index)}
+	}
+	var program *expression.Program
+	if assertion.CEL != "" {
+		var err error
+		if program, err = expression.Compile(assertion.CEL, "self"); err != nil {
+			return []string{fmt.Sprintf("assertion %d: %v", index, err)}
+		}
+	}
+	var expected any
+	if assertion.hasValue() {
+		if err := assertion.Value.Decode(&expected); err != nil {
+			return []string{fmt.Sprintf("assertion %d has an invalid value: %v", index, err)}
+		}
+	}
+
+	var failures []string
+	checked := 0
+	for _, output := range outputs {
+		if assertion.Output != "" && output.GetName() != assertion.Output {
+			continue
+		}
+		checked++
+		self, err := expression.ToValue(output)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("output %s could not be read: %v", output.GetName(), err))
+			continue
+		}
+		if failure := checkOutput(assertion, program, expected, output.GetName(), self); failure != "" {
+			failures = append(failures, failure)
+		}
+	}
+	if checked == 0 {
+		if assertion.Output != "" {
+			return []string{fmt.Sprintf("assertion %d names missing output: %s", index, assertion.Output)}
+		}
+		return []string{fmt.Sprintf("assertion %d found no outputs", index)}
+	}
+	return failures
+}
+
+// checkOutput checks assertion against a single output, returning a failure message or "" when it holds
+func checkOutput(assertion Assertion, program *expression.Program, expected any, name string, self any) string {
+	fail := func(message string) string {
+		if assertion.Message != "" {
+			return fmt.Sprintf("output %s: %s", name, assertion.Message)
+		}
+		return fmt.Sprintf("output %s: %s", name, message)
+	}
+	if assertion.Path != "" {
+		actual, found, err := expression.Lookup(self, assertion.Path)
+		if err != nil {
+			return fmt.Sprintf("output %s: %v", name, err)
+		}
+		if !found {
+			return fail(fmt.Sprintf("%s not found", assertion.Path))
+		}
+		if assertion.hasValue() && !reflect.DeepEqual(actual, expected) {
+			return fail(fmt.Sprintf("%s is %v, expected %v", assertion.Path, actual, expected))
+		}
+	}
+	if program != nil {
+		holds, err := program.Eval(map[string]any{"self": self})
+		if err != nil {
+			return fmt.Sprintf("output %s: %v", name, err)
+		}
+		if !holds {
+			return fail(fmt.Sprintf("%s is false", assertion.CEL))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renderTest
+
+import (
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/internal/testUtil"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/config"
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// packageItems package with a Ciq, two outputs and their function config
+func packageItems() []*kyaml.RNode {
+	return []*kyaml.RNode{
+		kyaml.MustParse("apiVersion: v1\nkind: RenderConfig\nmetadata:\n  name: amf-day0\noutput:\n  kind: AmfConfiguration\n"),
+		kyaml.MustParse("apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\nreplicas: 1\n"),
+		kyaml.MustParse("apiVersion: v1\nkind: AmfConfiguration\nmetadata:\n  name: amf-values\ndata: {}\n"),
+		kyaml.MustParse("apiVersion: v1\nkind: AmfConfiguration\nmetadata:\n  name: amf-extra\ndata: {}\n"),
+	}
+}
+
+func TestRun(t *testing.T) {
+	defer config.Reset()
+
+	// Test structure
+	tests := []struct {
+		name             string
+		spec             string
+		expectedErr      string
+		expectedMessages []string
+	}{ // Test list
+
+		// Inputs replace the package Ciq, field values and CEL on named and all outputs
+		{
+			"Test passing cases",
+			`
+function_config: amf-day0
+cases:
+  - name: package-ciq
+    assertions:
+      - {path: $.data.replicas, value: 1}
+  - name: three-replicas
+    inputs:
+      - {apiVersion: v1, kind: Ciq, metadata: {name: amf}, replicas: 3}
+    assertions:
+      - {output: amf-values, path: "$['data'].replicas", value: 3}
+      - {cel: self.data.replicas >= 3}
+      - {path: $.metadata.name}
+  - name: no-ciq
+    inputs:
+      - {apiVersion: v1, kind: Ciq, metadata: {name: amf}}
+    error: has no replicas
+`,
+			"",
+			[]string{
+				"Render test case passed: package-ciq",
+				"Render test case passed: three-replicas",
+				"Render test case passed: no-ciq",
+			},
+		},
+
+		// Every failing assertion is reported
+		{
+			"Test failing assertions",
+			`
+function_config: amf-day0
+cases:
+  - name: regression
+    assertions:
+      - {output: amf-values, path: $.data.replicas, value: 2}
+      - {output: amf-values, cel: self.data.replicas > 1, message: at least two replicas required}
+      - {output: amf-values, path: $.data.instances}
+      - {output: amf-missing, path: $.data}
+      - {path: $.data.replicas, value: "1"}
+  - name: unexpected-success
+    error: has no replicas
+`,
+			"2 of 2 render test cases failed",
+			[]string{
+				"Render test case regression failed: output amf-values: $.data.replicas is 1, expected 2",
+				"Render test case regression failed: output amf-values: at least two replicas required",
+				"Render test case regression failed: output amf-values: $.data.instances not found",
+				"Render test case regression failed: assertion 3 names missing output: amf-missing",
+				"Render test case regression failed: output amf-values: $.data.replicas is 1, expected 1",
+				"Render test case regression failed: output amf-extra: $.data.replicas is 1, expected 1",
+				"Render test case unexpected-success failed: expected render to fail with: has no replicas",
+			},
+		},
+
+		// Invalid assertions fail their case
+		{
+			"Test invalid assertions",
+			`
+function_config: amf-day0
+cases:
+  - name: invalid
+    assertions:
+      - {output: amf-values}
+      - {value: 1}
+      - {cel: "1 + 2"}
+  - name: render-error
+    inputs:
+      - {apiVersion: v1, kind: Ciq, metadata: {name: amf}}
+`,
+			"2 of 2 render test cases failed",
+			[]string{
+				"Render test case invalid failed: assertion 0 has neither path nor cel",
+				"Render test case invalid failed: assertion 1 has a value without path",
+				"Render test case invalid failed: assertion 2: expression 1 + 2 evaluates to int, expected bool",
+				"Render test case render-error failed: render failed: ciq has no replicas",
+			},
+		},
+
+		// Invalid render tests
+		{
+			"Test missing function config",
+			"function_config: amf-day1\ncases: []\n",
+			"1 of 1 render test cases failed",
+			[]string{"render test amf-tests references missing function config: amf-day1"},
+		},
+		{
+			"Test function config running tests",
+			"function_config: amf-validate\ncases: []\n",
+			"1 of 1 render test cases failed",
+			[]string{"render test amf-tests references function config amf-validate, which runs tests instead of rendering"},
+		},
+		{
+			"Test case without name",
+			"function_config: amf-day0\ncases: [{assertions: []}]\n",
+			"1 of 1 render test cases failed",
+			[]string{"render test amf-tests has a case without name at index 0"},
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := kyaml.MustParse("apiVersion: v1alpha1\nkind: YttRenderTest\nmetadata:\n  name: amf-tests\n")
+			if err := test.PipeE(kyaml.SetField("spec", kyaml.MustParse(tt.spec))); err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			validate := kyaml.MustParse("apiVersion: v1\nkind: RenderConfig\nmetadata:\n  name: amf-validate\nmode: test\n")
+
+			// The Kptfile shares its name with the function config, as kpt init names both after the package
+			kptfile := kyaml.MustParse("apiVersion: kpt.dev/v1\nkind: Kptfile\nmetadata:\n  name: amf-day0\n")
+			items := append(packageItems(), validate, test, kptfile)
+			results := logger.NewCollector()
+
+			// Execute function
+			err := Run(results, testUtil.CopyProcessor{Field: "replicas"}, items)
+
+			// Assert response
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			var gotMessages []string
+			for _, result := range results.Results {
+				gotMessages = append(gotMessages, result.Message)
+			}
+			assert.Equal(t, tt.expectedMessages, gotMessages)
+
+			// Package resources are left untouched
+			assert.Equal(t, "{}", items[2].Field("data").Value.MustString()[:2])
+		})
+	}
+}
+
+func TestRunWithoutTests(t *testing.T) {
+	results := logger.NewCollector()
+
+	// Execute function
+	err := Run(results, testUtil.CopyProcessor{Field: "replicas"}, packageItems())
+
+	// Assert response
+	assert.NoError(t, err)
+	assert.Equal(t, "No YttRenderTest resources found, no render tests run", results.Results[0].Message)
+}
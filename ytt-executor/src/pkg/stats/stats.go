@@ -0,0 +1,212 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stats to record timings and sizes of a render job
+package stats
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Render phases timed by Render.Measure
+const (
+	PhaseWriteTemplates  = "write_templates"  // ParseAndWriteKYamlRNodesAsYttTemplates
+	PhaseExecuteYtt      = "execute_ytt"      // ExecuteYttForTemplate
+	PhaseUnmarshalOutput = "unmarshal_output" // UnmarshalYttOutput
+)
+
+// now returns current time, replaced in tests
+var now = time.Now
+
+// phase duration of a single render phase
+type phase struct {
+	name     string
+	duration time.Duration
+}
+
+// Render statistics of a single render job
+//
+// Job: name of the render job, used as job label of metrics
+//
+// InputResources: number of resources passed to the function, including package sources
+//
+// InputFiles: number of files passed to ytt
+//
+// InputBytes: total size of files passed to ytt
+//
+// OutputBytes: size of ytt output
+//
+// OutputDocuments: number of documents in ytt output
+//
+// Succeeded: whether the render job finished without error
+type Render struct {
+	Job             string
+	InputResources  int
+	InputFiles      int
+	InputBytes      int64
+	OutputBytes     int
+	OutputDocuments int
+	Succeeded       bool
+
+	started time.Time
+	phases  []phase
+}
+
+// NewRender starts statistics of a render job
+func NewRender(job string) *Render {
+	return &Render{Job: job, started: now()}
+}
+
+// Measure starts timing phase, the returned function stops it
+//
+// Parameters:
+//   - name: name of the phase, one of the Phase constants
+//
+// Returns:
+//   - func(): records duration of phase when called
+func (render *Render) Measure(name string) func() {
+	start := now()
+	return func() {
+		render.phases = append(render.phases, phase{name: name, duration: now().Sub(start)})
+	}
+}
+
+// blockingReader sums the time spent waiting in Read of reader
+type blockingReader struct {
+	reader  io.Reader
+	blocked time.Duration
+}
+
+// Read reads from reader and adds the time spent to blocked
+func (reader *blockingReader) Read(p []byte) (int, error) {
+	start := now()
+	defer func() { reader.blocked += now().Sub(start) }()
+	return reader.reader.Read(p)
+}
+
+// MeasureReader starts timing phase consuming reader, the returned function stops it
+// Time spent waiting for data from reader is not part of phase, so a phase consuming a stream
+// overlaps the phase producing it without being charged for it
+//
+// Parameters:
+//   - name: name of the phase, one of the Phase constants
+//   - reader: stream consumed during phase
+//
+// Returns:
+//   - io.Reader: reader to consume during phase instead of reader
+//   - func(): records duration of phase when called
+func (render *Render) MeasureReader(name string, reader io.Reader) (io.Reader, func()) {
+	timed := &blockingReader{reader: reader}
+	start := now()
+	return timed, func() {
+		render.phases = append(render.phases, phase{name: name, duration: now().Sub(start) - timed.blocked})
+	}
+}
+
+// CountInputFiles adds files passed to ytt as -f or --data-values-file arguments to InputFiles and InputBytes
+//
+// Parameters:
+//   - yttArgs: ytt arguments, -f values may be given as <relative_name>=<file_name>
+func (render *Render) CountInputFiles(yttArgs []string) {
+	for i := 0; i+1 < len(yttArgs); i++ {
+		if yttArgs[i] != "-f" && yttArgs[i] != "--data-values-file" {
+			continue
+		}
+		fileName := yttArgs[i+1]
+		if _, name, found := strings.Cut(fileName, "="); found {
+			fileName = name
+		}
+		render.InputFiles++
+		if info, err := os.Stat(fileName); err == nil {
+			render.InputBytes += info.Size()
+		}
+		i++
+	}
+}
+
+// Tags returns statistics as details of a result, durations in seconds
+func (render *Render) Tags() map[string]string {
+	tags := map[string]string{
+		"job":              render.Job,
+		"input_resources":  strconv.Itoa(render.InputResources),
+		"input_files":      strconv.Itoa(render.InputFiles),
+		"input_bytes":      strconv.FormatInt(render.InputBytes, 10),
+		"output_bytes":     strconv.Itoa(render.OutputBytes),
+		"output_documents": strconv.Itoa(render.OutputDocuments),
+		"total_seconds":    formatSeconds(now().Sub(render.started)),
+	}
+	for _, phase := range render.phases {
+		tags[phase.name+"_seconds"] = formatSeconds(phase.duration)
+	}
+	return tags
+}
+
+// Prometheus returns statistics in Prometheus text exposition format
+func (render *Render) Prometheus() string {
+	var builder strings.Builder
+	job := fmt.Sprintf("job=%q", render.Job)
+
+	writeMetric := func(name string, help string, samples ...string) {
+		fmt.Fprintf(&builder, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, sample := range samples {
+			builder.WriteString(name + sample + "\n")
+		}
+	}
+
+	var phaseSamples []string
+	for _, phase := range render.phases {
+		phaseSamples = append(phaseSamples, fmt.Sprintf("{%s,phase=%q} %s", job, phase.name, formatSeconds(phase.duration)))
+	}
+	writeMetric("ytt_render_phase_duration_seconds", "Duration of render phases.", phaseSamples...)
+	writeMetric("ytt_render_duration_seconds", "Duration of the render job.", fmt.Sprintf("{%s} %s", job, formatSeconds(now().Sub(render.started))))
+	writeMetric("ytt_render_input_resources", "Resources passed to the function.", fmt.Sprintf("{%s} %d", job, render.InputResources))
+	writeMetric("ytt_render_input_files", "Files passed to ytt.", fmt.Sprintf("{%s} %d", job, render.InputFiles))
+	writeMetric("ytt_render_input_bytes", "Total size of files passed to ytt.", fmt.Sprintf("{%s} %d", job, render.InputBytes))
+	writeMetric("ytt_render_output_bytes", "Size of ytt output.", fmt.Sprintf("{%s} %d", job, render.OutputBytes))
+	writeMetric("ytt_render_output_documents", "Documents in ytt output.", fmt.Sprintf("{%s} %d", job, render.OutputDocuments))
+	succeeded := 0
+	if render.Succeeded {
+		succeeded = 1
+	}
+	writeMetric("ytt_render_success", "Whether the render job succeeded.", fmt.Sprintf("{%s} %d", job, succeeded))
+	return builder.String()
+}
+
+// WritePrometheus writes Prometheus text of statistics to fileName, replacing it atomically for scrapers
+//
+// Parameters:
+//   - fileName: path of the metrics file
+//
+// Returns:
+//   - error: from writing the file
+func (render *Render) WritePrometheus(fileName string) error {
+	tempName := fileName + ".tmp"
+	if err := os.WriteFile(tempName, []byte(render.Prometheus()), 0o644); err != nil {
+		return fmt.Errorf("failed to write metrics file: %v", err)
+	}
+	if err := os.Rename(tempName, fileName); err != nil {
+		return fmt.Errorf("failed to write metrics file: %v", err)
+	}
+	return nil
+}
+
+// formatSeconds formats duration as seconds with millisecond precision
+func formatSeconds(duration time.Duration) string {
+	return strconv.FormatFloat(duration.Seconds(), 'f', 3, 64)
+}
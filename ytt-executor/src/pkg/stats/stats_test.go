@@ -0,0 +1,122 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock replaces now with a clock advancing by step on every call
+func fakeClock(t *testing.T, step time.Duration) {
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		current = current.Add(step)
+		return current
+	}
+	t.Cleanup(func() {
+		now = time.Now
+	})
+}
+
+// sampleRender render job with one input file and a timed phase
+func sampleRender(t *testing.T) *Render {
+	fakeClock(t, 250*time.Millisecond)
+	fileName := filepath.Join(t.TempDir(), "template.yaml")
+	if err := os.WriteFile(fileName, []byte("amf: 1\n"), 0o644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+
+	render := NewRender("amf-site-1")
+	stop := render.Measure(PhaseExecuteYtt)
+	stop()
+	render.InputResources = 3
+	render.CountInputFiles([]string{"-f", "lib/template.yaml=" + fileName, "--data-values-file", fileName, "--file-mark", "x:type=data"})
+	render.OutputBytes = 42
+	render.OutputDocuments = 2
+	render.Succeeded = true
+	return render
+}
+
+func TestRenderMeasureReader(t *testing.T) {
+	fakeClock(t, 250*time.Millisecond)
+	render := NewRender("amf-site-1")
+
+	// Two reads, data and io.EOF, are each charged one step of blocked time
+	reader, stop := render.MeasureReader(PhaseUnmarshalOutput, strings.NewReader("amf: 1\n"))
+	data, err := io.ReadAll(reader)
+	stop()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "amf: 1\n", string(data))
+	assert.Equal(t, "0.750", render.Tags()["unmarshal_output_seconds"])
+}
+
+func TestRenderTags(t *testing.T) {
+	render := sampleRender(t)
+	assert.Equal(t, map[string]string{
+		"job":                 "amf-site-1",
+		"input_resources":     "3",
+		"input_files":         "2",
+		"input_bytes":         "14",
+		"output_bytes":        "42",
+		"output_documents":    "2",
+		"execute_ytt_seconds": "0.250",
+		"total_seconds":       "0.750",
+	}, render.Tags())
+}
+
+func TestRenderWritePrometheus(t *testing.T) {
+	render := sampleRender(t)
+	fileName := filepath.Join(t.TempDir(), "render.prom")
+	if err := render.WritePrometheus(fileName); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("failed to read metrics file: %v", err)
+	}
+	assert.Equal(t, `# HELP ytt_render_phase_duration_seconds Duration of render phases.
+# TYPE ytt_render_phase_duration_seconds gauge
+ytt_render_phase_duration_seconds{job="amf-site-1",phase="execute_ytt"} 0.250
+# HELP ytt_render_duration_seconds Duration of the render job.
+# TYPE ytt_render_duration_seconds gauge
+ytt_render_duration_seconds{job="amf-site-1"} 0.750
+# HELP ytt_render_input_resources Resources passed to the function.
+# TYPE ytt_render_input_resources gauge
+ytt_render_input_resources{job="amf-site-1"} 3
+# HELP ytt_render_input_files Files passed to ytt.
+# TYPE ytt_render_input_files gauge
+ytt_render_input_files{job="amf-site-1"} 2
+# HELP ytt_render_input_bytes Total size of files passed to ytt.
+# TYPE ytt_render_input_bytes gauge
+ytt_render_input_bytes{job="amf-site-1"} 14
+# HELP ytt_render_output_bytes Size of ytt output.
+# TYPE ytt_render_output_bytes gauge
+ytt_render_output_bytes{job="amf-site-1"} 42
+# HELP ytt_render_output_documents Documents in ytt output.
+# TYPE ytt_render_output_documents gauge
+ytt_render_output_documents{job="amf-site-1"} 2
+# HELP ytt_render_success Whether the render job succeeded.
+# TYPE ytt_render_success gauge
+ytt_render_success{job="amf-site-1"} 1
+`, string(content))
+}
@@ -0,0 +1,355 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package templateTest renders test cases of a template package and compares rendered outputs with golden files,
+// modeled on kyaml frameworktestutil
+package templateTest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/pkg/pipeline"
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Default test case layout
+const (
+	DefaultTestDataDirectory = "testdata"   // Directory of test cases, relative to the package
+	DefaultCiqFilename       = "ciq.yaml"   // Resources of a test case replacing package resources
+	DefaultExpectedDirectory = "expected"   // Directory of golden files of a test case, named by output path
+	DefaultErrorFilename     = "errors.txt" // Error a test case is expected to fail with
+)
+
+// GoldenChecker renders every test case under TestDataDirectory of a package through the Kptfile pipeline
+// and compares outputs with golden files
+//
+// A test case is a directory holding CiqFilename, whose resources replace package resources of the same
+// apiVersion, kind, namespace and name or are added to the package, and golden files of every output
+// under ExpectedDirectory, e.g. expected/amf/configmap_amf-values-day0.yaml, or an ExpectedErrorFilename
+// holding part of the error the render is expected to fail with
+//
+// PackagePath: package directory holding a Kptfile
+//
+// TestDataDirectory: directory of test cases relative to PackagePath, DefaultTestDataDirectory when empty,
+// its files are not package resources
+//
+// CiqFilename: DefaultCiqFilename when empty
+//
+// ExpectedDirectory: DefaultExpectedDirectory when empty
+//
+// ExpectedErrorFilename: DefaultErrorFilename when empty
+//
+// Images: image name parts identifying pipeline entries of the render function, pipeline.DefaultImages when nil
+//
+// UpdateExpectedFromActual: write rendered outputs or errors to golden files instead of comparing them
+//
+// Processor: returns the processor running a single render job
+type GoldenChecker struct {
+	PackagePath              string
+	TestDataDirectory        string
+	CiqFilename              string
+	ExpectedDirectory        string
+	ExpectedErrorFilename    string
+	Images                   []string
+	UpdateExpectedFromActual bool
+	Processor                func() framework.ResourceListProcessor
+}
+
+// CaseResult outcome of a single test case
+//
+// Name: name of the test case directory
+//
+// Failures: unified diffs of outputs differing from golden files and other mismatches
+//
+// Updated: golden files written or removed
+type CaseResult struct {
+	Name     string
+	Failures []string
+	Updated  []string
+}
+
+// Passed checks whether the test case rendered as expected
+func (result CaseResult) Passed() bool {
+	return len(result.Failures) == 0
+}
+
+// setDefaults fills unset fields with defaults
+func (checker *GoldenChecker) setDefaults() {
+	if checker.TestDataDirectory == "" {
+		checker.TestDataDirectory = DefaultTestDataDirectory
+	}
+	if checker.CiqFilename == "" {
+		checker.CiqFilename = DefaultCiqFilename
+	}
+	if checker.ExpectedDirectory == "" {
+		checker.ExpectedDirectory = DefaultExpectedDirectory
+	}
+	if checker.ExpectedErrorFilename == "" {
+		checker.ExpectedErrorFilename = DefaultErrorFilename
+	}
+	if checker.Images == nil {
+		checker.Images = pipeline.DefaultImages
+	}
+}
+
+// Run renders all test cases in order of their directory names
+//
+// Returns:
+//   - []CaseResult: outcome of every test case
+//   - error: when the package or its test cases cannot be read
+func (checker *GoldenChecker) Run() ([]CaseResult, error) {
+	checker.setDefaults()
+
+	// Test cases are never package resources
+	_, packageItems, jobs, err := pipeline.ReadPackage(checker.PackagePath, checker.Images, checker.TestDataDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(checker.PackagePath, checker.TestDataDirectory))
+	if err != nil {
+		return nil, fmt.Errorf("package %s has no test cases: %v", checker.PackagePath, err)
+	}
+	var results []CaseResult
+	for _, entry := range entries {
+		caseDir := filepath.Join(checker.PackagePath, checker.TestDataDirectory, entry.Name())
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(caseDir, checker.CiqFilename)); err != nil {
+			continue
+		}
+		result, err := checker.runCase(entry.Name(), caseDir, packageItems, jobs)
+		if err != nil {
+			return results, fmt.Errorf("test case %s: %v", entry.Name(), err)
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("package %s has no test cases with %s under %s", checker.PackagePath, checker.CiqFilename, checker.TestDataDirectory)
+	}
+	return results, nil
+}
+
+// runCase renders a single test case and compares or updates its golden files
+//
+// Parameters:
+//   - name: name of the test case
+//   - caseDir: directory of the test case
+//   - items: package resources
+//   - jobs: pipeline entries of the render function
+//
+// Returns:
+//   - CaseResult: outcome of the test case
+//   - error: when files of the test case cannot be read or written
+func (checker *GoldenChecker) runCase(name string, caseDir string, items []*kyaml.RNode, jobs []pipeline.Job) (CaseResult, error) {
+	result := CaseResult{Name: name}
+	caseItems, err := checker.caseItems(name, caseDir, items)
+	if err != nil {
+		return result, err
+	}
+	expectedDir := filepath.Join(caseDir, checker.ExpectedDirectory)
+	errorFile := filepath.Join(caseDir, checker.ExpectedErrorFilename)
+
+	// Render, keeping results to explain failures
+	var renderLog bytes.Buffer
+	rendered, outputs, renderErr := pipeline.Run(&renderLog, checker.Processor(), caseItems, jobs, framework.Error)
+	actual := map[string]string{}
+	if renderErr == nil {
+		files, err := pipeline.SerializePackage(rendered)
+		if err != nil {
+			return result, err
+		}
+		for _, output := range outputs {
+			actual[output] = files[output]
+		}
+	}
+
+	if checker.UpdateExpectedFromActual {
+		return checker.updateCase(result, expectedDir, errorFile, actual, renderErr)
+	}
+
+	// Expected errors replace golden files
+	expectedError, err := os.ReadFile(errorFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return result, err
+	}
+	if err == nil {
+		switch {
+		case renderErr == nil:
+			result.Failures = append(result.Failures, fmt.Sprintf("expected render to fail with: %s", strings.TrimSpace(string(expectedError))))
+		case !strings.Contains(renderErr.Error(), strings.TrimSpace(string(expectedError))):
+			result.Failures = append(result.Failures, fmt.Sprintf("expected render to fail with: %s, got: %v", strings.TrimSpace(string(expectedError)), renderErr))
+		}
+		return result, nil
+	}
+	if renderErr != nil {
+		result.Failures = append(result.Failures, fmt.Sprintf("render failed: %v\n%s", renderErr, renderLog.String()))
+		return result, nil
+	}
+
+	expected, err := readFiles(expectedDir)
+	if err != nil {
+		return result, err
+	}
+	for _, fileName := range sortedKeys(actual, expected) {
+		expectedContent, isExpected := expected[fileName]
+		actualContent, isRendered := actual[fileName]
+		switch {
+		case !isRendered:
+			result.Failures = append(result.Failures, fmt.Sprintf("expected output not rendered: %s", fileName))
+		case !isExpected || expectedContent != actualContent:
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(expectedContent),
+				B:        difflib.SplitLines(actualContent),
+				FromFile: path.Join(checker.ExpectedDirectory, fileName),
+				ToFile:   fileName,
+				Context:  2,
+			})
+			if err != nil {
+				return result, err
+			}
+			result.Failures = append(result.Failures, diff)
+		}
+	}
+	return result, nil
+}
+
+// caseItems returns package resources with resources of the test case applied
+// Resources replacing a package resource keep its file, others are added under the test case directory
+func (checker *GoldenChecker) caseItems(name string, caseDir string, items []*kyaml.RNode) ([]*kyaml.RNode, error) {
+	content, err := os.ReadFile(filepath.Join(caseDir, checker.CiqFilename))
+	if err != nil {
+		return nil, err
+	}
+	ciqItems, err := (&kio.ByteReader{Reader: bytes.NewReader(content), OmitReaderAnnotations: true}).Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s could not be read: %v", checker.CiqFilename, err)
+	}
+
+	ciqPath := path.Join(filepath.ToSlash(checker.TestDataDirectory), name, checker.CiqFilename)
+	return pipeline.OverrideItems(items, ciqItems, ciqPath)
+}
+
+// updateCase writes the render error or rendered outputs as golden files, removing stale golden files
+func (checker *GoldenChecker) updateCase(result CaseResult, expectedDir string, errorFile string, actual map[string]string, renderErr error) (CaseResult, error) {
+	if renderErr != nil {
+		if err := os.WriteFile(errorFile, []byte(renderErr.Error()+"\n"), 0o644); err != nil {
+			return result, err
+		}
+		result.Updated = append(result.Updated, filepath.Base(errorFile))
+		return result, nil
+	}
+	if err := os.Remove(errorFile); err == nil {
+		result.Updated = append(result.Updated, filepath.Base(errorFile))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return result, err
+	}
+
+	expected, err := readFiles(expectedDir)
+	if err != nil {
+		return result, err
+	}
+	for _, fileName := range sortedKeys(actual, expected) {
+		goldenFile := filepath.Join(expectedDir, filepath.FromSlash(fileName))
+		content, isRendered := actual[fileName]
+		expectedContent, isExpected := expected[fileName]
+		switch {
+		case !isRendered:
+			if err := os.Remove(goldenFile); err != nil {
+				return result, err
+			}
+		case !isExpected || expectedContent != content:
+			if err := os.MkdirAll(filepath.Dir(goldenFile), 0o755); err != nil {
+				return result, err
+			}
+			if err := os.WriteFile(goldenFile, []byte(content), 0o644); err != nil {
+				return result, err
+			}
+		default:
+			continue
+		}
+		result.Updated = append(result.Updated, path.Join(checker.ExpectedDirectory, fileName))
+	}
+	return result, nil
+}
+
+// readFiles reads all files under dir by slash separated relative path, none when dir does not exist
+func readFiles(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(fileName string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && fileName == dir {
+			return filepath.SkipDir
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(dir, fileName)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(relative)] = string(content)
+		return nil
+	})
+	return files, err
+}
+
+// sortedKeys returns keys of all maps in order, once each
+func sortedKeys(maps ...map[string]string) []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, files := range maps {
+		for key := range files {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteResults prints the outcome of every test case to out
+func WriteResults(out io.Writer, results []CaseResult) {
+	for _, result := range results {
+		status := "PASS"
+		if !result.Passed() {
+			status = "FAIL"
+		}
+		fmt.Fprintf(out, "%s %s\n", status, result.Name)
+		for _, updated := range result.Updated {
+			fmt.Fprintf(out, "  updated: %s\n", updated)
+		}
+		for _, failure := range result.Failures {
+			fmt.Fprintf(out, "  %s\n", strings.ReplaceAll(strings.TrimRight(failure, "\n"), "\n", "\n  "))
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 Ericsson AB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templateTest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nephio-experimental/ytt-declarative-configuration/internal/testUtil"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+)
+
+// testPackage package rendering out.yaml from the site of ciq.yaml
+func testPackage(t *testing.T, cases map[string]string) string {
+	packageDir := t.TempDir()
+	testUtil.WriteFiles(t, packageDir, map[string]string{
+		"Kptfile":  "apiVersion: kpt.dev/v1\nkind: Kptfile\nmetadata:\n  name: amf\npipeline:\n  mutators:\n    - image: render-ytt\n",
+		"ciq.yaml": "apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\nsite: lab\n",
+		"out.yaml": "apiVersion: v1\nkind: Configuration\nmetadata:\n  name: amf\ndata:\n  site: none\n",
+	})
+	testUtil.WriteFiles(t, filepath.Join(packageDir, DefaultTestDataDirectory), cases)
+	return packageDir
+}
+
+func TestGoldenCheckerRun(t *testing.T) {
+	out := "apiVersion: v1\nkind: Configuration\nmetadata:\n  name: amf\ndata:\n  site: %s\n"
+
+	// Test structure
+	tests := []struct {
+		name             string
+		cases            map[string]string
+		expectedFailures map[string][]string
+		expectedErr      string
+	}{ // Test list
+
+		// Resources of a case replace package resources with the same identity
+		{
+			"Test matching golden file",
+			map[string]string{
+				"edge/ciq.yaml":              "apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\nsite: edge\n",
+				"edge/expected/out.yaml":     fmt.Sprintf(out, "edge"),
+				"package/ciq.yaml":           "apiVersion: v1\nkind: Notes\nmetadata:\n  name: amf\n",
+				"package/expected/out.yaml":  fmt.Sprintf(out, "lab"),
+				"README.md":                  "not a test case",
+				"notACase/expected/out.yaml": "",
+			},
+			map[string][]string{"edge": nil, "package": nil},
+			"",
+		},
+
+		// Diffs name the golden file
+		{
+			"Test differing golden file",
+			map[string]string{
+				"edge/ciq.yaml":          "apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\nsite: edge\n",
+				"edge/expected/out.yaml": fmt.Sprintf(out, "core"),
+			},
+			map[string][]string{"edge": {"--- expected/out.yaml\n+++ out.yaml\n@@ -4,4 +4,4 @@\n   name: amf\n data:\n-  site: core\n+  site: edge\n \n"}},
+			"",
+		},
+
+		// Golden files of files never rendered
+		{
+			"Test golden file not rendered",
+			map[string]string{
+				"edge/ciq.yaml":            "apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\nsite: edge\n",
+				"edge/expected/out.yaml":   fmt.Sprintf(out, "edge"),
+				"edge/expected/other.yaml": fmt.Sprintf(out, "edge"),
+			},
+			map[string][]string{"edge": {"expected output not rendered: other.yaml"}},
+			"",
+		},
+
+		// Expected errors, matched in part
+		{
+			"Test expected error",
+			map[string]string{
+				"nosite/ciq.yaml":   "apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\n",
+				"nosite/errors.txt": "has no site\n",
+				"edge/ciq.yaml":     "apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\nsite: edge\n",
+				"edge/errors.txt":   "has no site\n",
+			},
+			map[string][]string{"edge": {"expected render to fail with: has no site"}, "nosite": nil},
+			"",
+		},
+
+		// Unexpected errors
+		{
+			"Test unexpected error",
+			map[string]string{
+				"nosite/ciq.yaml": "apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\n",
+			},
+			map[string][]string{"nosite": {"render failed: [1] render-ytt: ciq has no site\n"}},
+			"",
+		},
+
+		// Test data without cases
+		{
+			"Test no test cases",
+			map[string]string{"README.md": "no cases"},
+			nil,
+			"has no test cases with ciq.yaml under testdata",
+		},
+	}
+
+	// Loop through test cases
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := &GoldenChecker{
+				PackagePath: testPackage(t, tt.cases),
+				Processor:   func() framework.ResourceListProcessor { return testUtil.CopyProcessor{Field: "site"} },
+			}
+
+			// Execute function
+			results, err := checker.Run()
+
+			// Assert response
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			gotFailures := map[string][]string{}
+			for _, result := range results {
+				gotFailures[result.Name] = result.Failures
+			}
+			assert.Equal(t, tt.expectedFailures, gotFailures)
+		})
+	}
+}
+
+func TestGoldenCheckerUpdate(t *testing.T) {
+	packageDir := testPackage(t, map[string]string{
+		"edge/ciq.yaml":            "apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\nsite: edge\n",
+		"edge/errors.txt":          "has no site\n",
+		"edge/expected/stale.yaml": "stale",
+		"nosite/ciq.yaml":          "apiVersion: v1\nkind: Ciq\nmetadata:\n  name: amf\n",
+	})
+	checker := &GoldenChecker{
+		PackagePath:              packageDir,
+		UpdateExpectedFromActual: true,
+		Processor:                func() framework.ResourceListProcessor { return testUtil.CopyProcessor{Field: "site"} },
+	}
+
+	// Execute function
+	results, err := checker.Run()
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// Golden files follow the render, stale ones are removed
+	assert.Equal(t, []string{"errors.txt", "expected/out.yaml", "expected/stale.yaml"}, results[0].Updated)
+	assert.Equal(t, []string{"errors.txt"}, results[1].Updated)
+	content, _ := os.ReadFile(filepath.Join(packageDir, "testdata", "edge", "expected", "out.yaml"))
+	assert.Equal(t, "apiVersion: v1\nkind: Configuration\nmetadata:\n  name: amf\ndata:\n  site: edge\n", string(content))
+	content, _ = os.ReadFile(filepath.Join(packageDir, "testdata", "nosite", "errors.txt"))
+	assert.Equal(t, "[1] render-ytt: ciq has no site\n", string(content))
+	assert.NoFileExists(t, filepath.Join(packageDir, "testdata", "edge", "errors.txt"))
+	assert.NoFileExists(t, filepath.Join(packageDir, "testdata", "edge", "expected", "stale.yaml"))
+
+	// Updated golden files pass
+	checker.UpdateExpectedFromActual = false
+	results, err = checker.Run()
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	for _, result := range results {
+		assert.Empty(t, result.Failures, result.Name)
+	}
+}